@@ -0,0 +1,240 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"go.uber.org/zap"
+)
+
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+
+	defaultRetries = 3
+	maxFired       = 1000
+	retryBaseDelay = 500 * time.Millisecond
+	requestTimeout = 10 * time.Second
+)
+
+// Webhook is an endpoint the alerts are posted to. Format is json (the Event itself) or slack (an incoming webhook message)
+type Webhook struct {
+	URL    string `json:"url"`
+	Format string `json:"format"`
+}
+
+// Config describes the budget alerts. Thresholds are percents of the limit of each budget window.
+// In test mode the payloads are logged instead of posted
+type Config struct {
+	Thresholds []int     `json:"thresholds"`
+	Webhooks   []Webhook `json:"webhooks"`
+	Retries    int       `json:"retries"`
+	Test       bool      `json:"test"`
+}
+
+// Event is a budget window whose spending crossed a threshold
+type Event struct {
+	Period    string            `json:"period"`
+	TimeZone  string            `json:"time_zone"`
+	Key       string            `json:"key"`
+	Threshold int               `json:"threshold_percent"`
+	Limit     currency.MicroUSD `json:"limit_micro_usd"`
+	Spent     currency.MicroUSD `json:"spent_micro_usd"`
+	Time      time.Time         `json:"time"`
+}
+
+type Notifier struct {
+	config Config
+	client *http.Client
+	logger *zap.SugaredLogger
+	wg     sync.WaitGroup
+	sleep  func(time.Duration)
+
+	mu    sync.Mutex
+	fired map[string]bool
+}
+
+// LoadConfig reads the alert config from a json file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = defaultRetries
+	}
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	if len(c.Thresholds) == 0 {
+		return errors.New("at least one alert threshold is required")
+	}
+	for _, t := range c.Thresholds {
+		if t <= 0 {
+			return fmt.Errorf("invalid alert threshold %d: must be a positive percent", t)
+		}
+	}
+	if len(c.Webhooks) == 0 && !c.Test {
+		return errors.New("at least one webhook is required outside of test mode")
+	}
+	for _, w := range c.Webhooks {
+		if w.URL == "" {
+			return errors.New("webhook url cannot be empty")
+		}
+		switch w.Format {
+		case "", FormatJSON, FormatSlack:
+		default:
+			return fmt.Errorf("invalid webhook format %q", w.Format)
+		}
+	}
+	if c.Retries < 0 {
+		return errors.New("retries cannot be negative")
+	}
+	return nil
+}
+
+// New creates new notifier
+func New(cfg Config, logger *zap.SugaredLogger) *Notifier {
+	return &Notifier{
+		config: cfg,
+		client: &http.Client{Timeout: requestTimeout},
+		logger: logger,
+		sleep:  time.Sleep,
+		fired:  make(map[string]bool),
+	}
+}
+
+// Crossed returns the thresholds reached by the spending of the window period stored under key
+// that this notifier hasn't marked fired yet. The caller marks them with MarkFired once the store has recorded them,
+// so a threshold that failed to be recorded is returned again on the next call.
+// Other replicas may fire the same thresholds, so the caller dedupes them in the store
+func (n *Notifier) Crossed(key string, spent, limit currency.MicroUSD) []int {
+	if limit <= 0 {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var crossed []int
+	for _, t := range n.config.Thresholds {
+		if int64(spent)*100 >= int64(limit)*int64(t) && !n.fired[firedID(key, t)] {
+			crossed = append(crossed, t)
+		}
+	}
+	return crossed
+}
+
+// MarkFired marks the threshold of the window period stored under key fired, so Crossed doesn't return it again
+func (n *Notifier) MarkFired(key string, threshold int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	//Old periods never fire again, forget them once there are too many
+	if len(n.fired) > maxFired {
+		clear(n.fired)
+	}
+	n.fired[firedID(key, threshold)] = true
+}
+
+func firedID(key string, threshold int) string {
+	return fmt.Sprintf("%s_%d", key, threshold)
+}
+
+// Send posts the event to every webhook in the background, retrying failed deliveries
+func (n *Notifier) Send(event Event) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := n.Notify(context.Background(), event); err != nil {
+			n.logger.Errorw("failed to deliver budget alert", "key", event.Key, "threshold", event.Threshold, "error", err)
+		}
+	}()
+}
+
+// Notify posts the event to every webhook, retrying each with jittered exponential backoff
+func (n *Notifier) Notify(ctx context.Context, event Event) error {
+	n.logger.Infow("budget threshold crossed", "period", event.Period, "key", event.Key, "threshold", event.Threshold, "spent", event.Spent, "limit", event.Limit)
+	var errs []error
+	for _, w := range n.config.Webhooks {
+		body, err := payload(w.Format, event)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if n.config.Test {
+			n.logger.Infow("budget alert test mode, not posting", "url", w.URL, "payload", string(body))
+			continue
+		}
+		if err := n.post(ctx, w.URL, body); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", w.URL, err))
+		}
+	}
+	if n.config.Test && len(n.config.Webhooks) == 0 {
+		body, _ := payload(FormatJSON, event)
+		n.logger.Infow("budget alert test mode, not posting", "payload", string(body))
+	}
+	return errors.Join(errs...)
+}
+
+// Close waits for the alerts being delivered
+func (n *Notifier) Close() {
+	n.wg.Wait()
+}
+
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	var err error
+	for attempt := 0; attempt <= n.config.Retries; attempt++ {
+		if attempt > 0 {
+			delay := retryBaseDelay << (attempt - 1)
+			n.sleep(delay/2 + rand.N(delay/2+1))
+		}
+		if err = n.postOnce(ctx, url, body); err == nil {
+			return nil
+		}
+		n.logger.Debugw("budget alert delivery failed", "url", url, "attempt", attempt+1, "error", err)
+	}
+	return err
+}
+
+func (n *Notifier) postOnce(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// payload encodes the event in the webhook format
+func payload(format string, event Event) ([]byte, error) {
+	if format == FormatSlack {
+		return json.Marshal(map[string]string{
+			"text": fmt.Sprintf(":warning: %s budget (%s) is at %d%%: spent %d of %d micro USD in period %s",
+				event.Period, event.TimeZone, event.Threshold, event.Spent, event.Limit, event.Key),
+		})
+	}
+	return json.Marshal(event)
+}
@@ -0,0 +1,80 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNotifier_Crossed(t *testing.T) {
+	n := New(Config{Thresholds: []int{50, 80, 100}}, zap.NewNop().Sugar())
+
+	assert.Empty(t, n.Crossed("2026-10-19", 499, 1000))
+	assert.Equal(t, []int{50}, n.Crossed("2026-10-19", 500, 1000))
+	//Thresholds are returned until they are marked fired, then fire once per key
+	assert.Equal(t, []int{50}, n.Crossed("2026-10-19", 700, 1000))
+	n.MarkFired("2026-10-19", 50)
+	assert.Empty(t, n.Crossed("2026-10-19", 700, 1000))
+	assert.Equal(t, []int{80, 100}, n.Crossed("2026-10-19", 1200, 1000))
+	assert.Equal(t, []int{50}, n.Crossed("2026-10-20", 600, 1000))
+	//Windows without a limit never alert
+	assert.Empty(t, n.Crossed("2026-10-21", 600, 0))
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	var calls, failures atomic.Int32
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	n := New(Config{Thresholds: []int{80}, Webhooks: []Webhook{{URL: srv.URL, Format: FormatSlack}}, Retries: 2}, zap.NewNop().Sugar())
+	n.sleep = func(time.Duration) {}
+	//Fail the first attempt to check the retry
+	failures.Store(1)
+	event := Event{Period: "daily", TimeZone: "UTC", Key: "2026-10-19", Threshold: 80, Limit: 1000, Spent: 800, Time: time.Now()}
+	assert.NoError(t, n.Notify(context.Background(), event))
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Contains(t, got["text"], "daily budget (UTC) is at 80%")
+
+	//Retries are bounded
+	calls.Store(0)
+	failures.Store(10)
+	assert.Error(t, n.Notify(context.Background(), event))
+	assert.Equal(t, int32(3), calls.Load())
+
+	//Test mode doesn't post
+	calls.Store(0)
+	failures.Store(0)
+	n.config.Test = true
+	assert.NoError(t, n.Notify(context.Background(), event))
+	assert.Equal(t, int32(0), calls.Load())
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"thresholds": [50, 100], "webhooks": [{"url": "https://example.com/hook"}]}`), 0o600))
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultRetries, cfg.Retries)
+
+	assert.Error(t, (&Config{Thresholds: []int{50}}).validate())
+	assert.NoError(t, (&Config{Thresholds: []int{50}, Test: true}).validate())
+	assert.Error(t, (&Config{Thresholds: []int{0}, Test: true}).validate())
+	assert.Error(t, (&Config{Thresholds: []int{50}, Webhooks: []Webhook{{URL: "x", Format: "teams"}}}).validate())
+}
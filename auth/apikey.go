@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ScopeAll = "*"
+	//ScopeAdmin grants the admin rpcs, which are not covered by ScopeAll
+	ScopeAdmin   = "admin"
+	adminService = "/sentencegen.Admin/"
+	keyPrefix    = "sg_"
+	keyBytes     = 32
+)
+
+var (
+	ErrMissingKey  = errors.New("missing api key")
+	ErrKeyNotFound = errors.New("api key not found")
+	ErrKeyExists   = errors.New("api key already exists")
+	ErrKeyRevoked  = errors.New("api key revoked")
+	ErrKeyExpired  = errors.New("api key expired")
+	ErrScopeDenied = errors.New("method not allowed for api key")
+)
+
+// APIKey is a stored api key. Only the hash of the key is persisted
+type APIKey struct {
+	Name      string    `json:"name" firestore:"name"`
+	Hash      string    `json:"hash" firestore:"hash"`
+	Scopes    []string  `json:"scopes" firestore:"scopes"`
+	CreatedAt time.Time `json:"created_at" firestore:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty" firestore:"expires_at"`
+	Revoked   bool      `json:"revoked" firestore:"revoked"`
+	RevokedAt time.Time `json:"revoked_at,omitempty" firestore:"revoked_at"`
+}
+
+// KeyStore persists hashed api keys
+type KeyStore interface {
+	GetKey(ctx context.Context, hash string) (*APIKey, error)
+	ListKeys(ctx context.Context) ([]*APIKey, error)
+	SaveKey(ctx context.Context, key *APIKey) error
+	RevokeKey(ctx context.Context, name string) error
+}
+
+// GenerateKey creates a new random api key and returns it together with its hash
+func GenerateKey() (string, string, error) {
+	b := make([]byte, keyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key := keyPrefix + hex.EncodeToString(b)
+	return key, HashKey(key), nil
+}
+
+// HashKey returns the hex encoded sha256 hash of the key
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Expired reports whether the key is expired at the given time
+func (k *APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// Allows reports whether the key scopes allow the given full grpc method name.
+// Scopes can be "*", a full method name ("/sentencegen.SentenceGen/Translate") or just the rpc name ("Translate")
+func (k *APIKey) Allows(fullMethod string) bool {
+	return scopesAllow(k.Scopes, fullMethod)
+}
+
+func scopesAllow(scopes []string, fullMethod string) bool {
+	rpc := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	admin := strings.HasPrefix(fullMethod, adminService)
+	for _, scope := range scopes {
+		if admin && scope == ScopeAdmin || !admin && (scope == ScopeAll || scope == fullMethod || scope == rpc) {
+			return true
+		}
+	}
+	return false
+}
+
+type Authenticator struct {
+	store  KeyStore
+	logger *zap.SugaredLogger
+}
+
+// NewAuthenticator creates new api key authenticator backed by the key store
+func NewAuthenticator(store KeyStore, logger *zap.SugaredLogger) *Authenticator {
+	return &Authenticator{store: store, logger: logger}
+}
+
+// Authenticate validates the api key for the given full grpc method name and returns the principal it belongs to
+func (a *Authenticator) Authenticate(ctx context.Context, key, fullMethod string) (*Principal, error) {
+	if key == "" {
+		return nil, ErrMissingKey
+	}
+
+	hash := HashKey(key)
+	stored, err := a.store.GetKey(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	//Guard against a store that returns a key with a different hash
+	if subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(hash)) != 1 {
+		return nil, ErrKeyNotFound
+	}
+
+	switch {
+	case stored.Revoked:
+		a.logger.Debugw("revoked api key used", "name", stored.Name)
+		return nil, ErrKeyRevoked
+	case stored.Expired(time.Now()):
+		a.logger.Debugw("expired api key used", "name", stored.Name, "expires_at", stored.ExpiresAt)
+		return nil, ErrKeyExpired
+	case !stored.Allows(fullMethod):
+		a.logger.Debugw("api key scope denied", "name", stored.Name, "method", fullMethod)
+		return nil, ErrScopeDenied
+	}
+
+	return &Principal{
+		Name:   stored.Name,
+		Kind:   KindAPIKey,
+		Scopes: stored.Scopes,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const (
+	translateMethod = "/sentencegen.SentenceGen/Translate"
+	reportMethod    = "/sentencegen.Admin/GetSpendingReport"
+)
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileKeyStore(filepath.Join(t.TempDir(), "keys.json"))
+	assert.NoError(t, err)
+	a := NewAuthenticator(store, zap.NewNop().Sugar())
+
+	newKey := func(name string, scopes []string, expiresAt time.Time) string {
+		key, hash, err := GenerateKey()
+		assert.NoError(t, err)
+		assert.NoError(t, store.SaveKey(ctx, &APIKey{Name: name, Hash: hash, Scopes: scopes, CreatedAt: time.Now(), ExpiresAt: expiresAt}))
+		return key
+	}
+
+	valid := newKey("valid", []string{"Translate"}, time.Time{})
+	expired := newKey("expired", []string{ScopeAll}, time.Now().Add(-time.Minute))
+	revoked := newKey("revoked", []string{ScopeAll}, time.Time{})
+	assert.NoError(t, store.RevokeKey(ctx, "revoked"))
+	all := newKey("all", []string{ScopeAll}, time.Time{})
+	admin := newKey("admin", []string{ScopeAdmin}, time.Time{})
+
+	p, err := a.Authenticate(ctx, valid, translateMethod)
+	assert.NoError(t, err)
+	assert.Equal(t, "valid", p.Name)
+	assert.Equal(t, KindAPIKey, p.Kind)
+
+	_, err = a.Authenticate(ctx, valid, "/sentencegen.SentenceGen/GenerateSentence")
+	assert.ErrorIs(t, err, ErrScopeDenied)
+
+	//The admin rpcs need the admin scope, all other rpcs don't accept it
+	_, err = a.Authenticate(ctx, all, reportMethod)
+	assert.ErrorIs(t, err, ErrScopeDenied)
+	_, err = a.Authenticate(ctx, admin, translateMethod)
+	assert.ErrorIs(t, err, ErrScopeDenied)
+	p, err = a.Authenticate(ctx, admin, reportMethod)
+	assert.NoError(t, err)
+	assert.True(t, p.HasScope(ScopeAdmin))
+
+	_, err = a.Authenticate(ctx, expired, translateMethod)
+	assert.ErrorIs(t, err, ErrKeyExpired)
+
+	_, err = a.Authenticate(ctx, revoked, translateMethod)
+	assert.ErrorIs(t, err, ErrKeyRevoked)
+
+	_, err = a.Authenticate(ctx, "sg_unknown", translateMethod)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	_, err = a.Authenticate(ctx, "", translateMethod)
+	assert.ErrorIs(t, err, ErrMissingKey)
+}
+
+func TestFileKeyStore_SaveKey(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	store, err := NewFileKeyStore(path)
+	assert.NoError(t, err)
+
+	_, hash, err := GenerateKey()
+	assert.NoError(t, err)
+	assert.NoError(t, store.SaveKey(ctx, &APIKey{Name: "app", Hash: hash, Scopes: []string{ScopeAll}}))
+	assert.ErrorIs(t, store.SaveKey(ctx, &APIKey{Name: "app", Hash: "other"}), ErrKeyExists)
+
+	//A second store reading the same file sees the key
+	other, err := NewFileKeyStore(path)
+	assert.NoError(t, err)
+	key, err := other.GetKey(ctx, hash)
+	assert.NoError(t, err)
+	assert.Equal(t, "app", key.Name)
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileKeyStore keeps hashed api keys in a json file.
+// The file is re-read when it changes on disk, so keys issued or revoked by the admin command apply without a restart
+type FileKeyStore struct {
+	path    string
+	mu      sync.Mutex
+	keys    map[string]*APIKey
+	modTime time.Time
+	size    int64
+}
+
+// NewFileKeyStore creates new file key store. The file is created on the first write if it doesn't exist
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{path: path, keys: make(map[string]*APIKey)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetKey returns the key with the given hash
+func (s *FileKeyStore) GetKey(_ context.Context, hash string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	key, ok := s.keys[hash]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	k := *key
+	return &k, nil
+}
+
+// ListKeys returns all the stored keys
+func (s *FileKeyStore) ListKeys(_ context.Context) ([]*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		k := *key
+		keys = append(keys, &k)
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+// SaveKey stores a new key. Key names must be unique
+func (s *FileKeyStore) SaveKey(_ context.Context, key *APIKey) error {
+	if key == nil {
+		return errors.New("key cannot be nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	for _, k := range s.keys {
+		if k.Name == key.Name || k.Hash == key.Hash {
+			return ErrKeyExists
+		}
+	}
+	k := *key
+	s.keys[key.Hash] = &k
+	return s.save()
+}
+
+// RevokeKey marks the key with the given name as revoked
+func (s *FileKeyStore) RevokeKey(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	for _, k := range s.keys {
+		if k.Name == name {
+			k.Revoked = true
+			k.RevokedAt = time.Now().UTC()
+			return s.save()
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// load reads the file if it has changed since the last read. Must be called with mu held
+func (s *FileKeyStore) load() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.keys = make(map[string]*APIKey)
+		s.modTime = time.Time{}
+		s.size = 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var keys []*APIKey
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return err
+		}
+	}
+	s.keys = make(map[string]*APIKey, len(keys))
+	for _, k := range keys {
+		s.keys[k.Hash] = k
+	}
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+// save writes all the keys to the file. Must be called with mu held
+func (s *FileKeyStore) save() error {
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	//Write to a temporary file first so readers never see a partially written file
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+func sortKeys(keys []*APIKey) {
+	slices.SortFunc(keys, func(a, b *APIKey) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"go.uber.org/zap"
+)
+
+const (
+	discoveryPath   = "/.well-known/openid-configuration"
+	minJWKSRefresh  = 30 * time.Second
+	clockLeeway     = time.Minute
+	jwksHTTPTimeout = 10 * time.Second
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid bearer token")
+	ErrUnknownKey   = errors.New("unknown token signing key")
+)
+
+var signatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// VerifierConfig configures the bearer token verifier
+type VerifierConfig struct {
+	//Issuer is the expected "iss" claim
+	Issuer string
+	//Audience is the expected "aud" claim. Empty means the audience is not checked
+	Audience string
+	//JWKS is a local file path or an http(s) url of the key set.
+	//If empty the key set url is discovered from the issuer
+	JWKS string
+	//RefreshInterval is how often the key set is reloaded
+	RefreshInterval time.Duration
+	//AdminScope is the token scope that grants the admin rpcs. Empty means tokens never grant them,
+	//whatever scopes the provider issues
+	AdminScope string
+}
+
+type Verifier struct {
+	config     VerifierConfig
+	httpClient *http.Client
+	logger     *zap.SugaredLogger
+
+	mu          sync.Mutex
+	jwksSource  string
+	keys        jose.JSONWebKeySet
+	refreshedAt time.Time
+}
+
+type tokenClaims struct {
+	jwt.Claims
+	Scope string `json:"scope"`
+}
+
+// NewVerifier creates new bearer token verifier and loads the key set
+func NewVerifier(ctx context.Context, cfg VerifierConfig, logger *zap.SugaredLogger) (*Verifier, error) {
+	if cfg.Issuer == "" {
+		return nil, errors.New("issuer cannot be empty")
+	}
+	v := &Verifier{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: jwksHTTPTimeout},
+		logger:     logger,
+		jwksSource: cfg.JWKS,
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.refresh(ctx); err != nil {
+		logger.Errorw("failed to load jwks", "error", err)
+		return nil, err
+	}
+	logger.Infow("token verifier initialized", "issuer", cfg.Issuer, "jwks", v.jwksSource, "keys", len(v.keys.Keys))
+	return v, nil
+}
+
+// Verify verifies the signature and the claims of the token and returns the user principal
+func (v *Verifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	tok, err := jwt.ParseSigned(token, signatureAlgorithms)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+	if len(tok.Headers) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := v.key(ctx, tok.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims tokenClaims
+	if err := tok.Claims(key.Key, &claims); err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+
+	expected := jwt.Expected{Issuer: v.config.Issuer, Time: time.Now()}
+	if v.config.Audience != "" {
+		expected.AnyAudience = jwt.Audience{v.config.Audience}
+	}
+	if err := claims.ValidateWithLeeway(expected, clockLeeway); err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+	if claims.Expiry == nil || claims.Subject == "" {
+		return nil, errors.Join(ErrInvalidToken, errors.New("token must have exp and sub claims"))
+	}
+
+	return &Principal{
+		Name:   claims.Subject,
+		Kind:   KindUser,
+		Scopes: v.scopes(claims.Scope),
+	}, nil
+}
+
+// scopes returns the scopes granted by the scope claim. The provider decides who gets which scope,
+// so only the configured admin scope maps to ScopeAdmin and an "admin" scope of the provider is dropped
+func (v *Verifier) scopes(claim string) []string {
+	var scopes []string
+	for _, scope := range strings.Fields(claim) {
+		switch {
+		case v.config.AdminScope != "" && scope == v.config.AdminScope:
+			scopes = append(scopes, ScopeAdmin)
+		case scope != ScopeAdmin:
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// key returns the key with the given id. The key set is reloaded when it is stale or the key is unknown, so rotated keys are picked up
+func (v *Verifier) key(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	stale := time.Since(v.refreshedAt) > v.config.RefreshInterval && v.config.RefreshInterval > 0
+	if !stale {
+		if key := v.lookup(kid); key != nil {
+			return key, nil
+		}
+	}
+
+	//Don't let tokens with random key ids hammer the jwks endpoint
+	if stale || time.Since(v.refreshedAt) > minJWKSRefresh {
+		if err := v.refresh(ctx); err != nil {
+			//Keep serving the keys we already have
+			v.logger.Errorw("failed to refresh jwks", "error", err)
+		}
+	}
+
+	if key := v.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// lookup finds the signing key by id. Tokens without a key id are accepted only when the set has a single key. Must be called with mu held
+func (v *Verifier) lookup(kid string) *jose.JSONWebKey {
+	if kid == "" {
+		if len(v.keys.Keys) == 1 {
+			return &v.keys.Keys[0]
+		}
+		return nil
+	}
+	for i := range v.keys.Keys {
+		if v.keys.Keys[i].KeyID == kid && v.keys.Keys[i].Use != "enc" {
+			return &v.keys.Keys[i]
+		}
+	}
+	return nil
+}
+
+// refresh reloads the key set. Must be called with mu held
+func (v *Verifier) refresh(ctx context.Context) error {
+	if v.jwksSource == "" {
+		source, err := v.discover(ctx)
+		if err != nil {
+			return err
+		}
+		v.jwksSource = source
+	}
+
+	var data []byte
+	var err error
+	if isURL(v.jwksSource) {
+		data, err = v.fetch(ctx, v.jwksSource)
+	} else {
+		data, err = os.ReadFile(v.jwksSource)
+	}
+	if err != nil {
+		return err
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	if len(keys.Keys) == 0 {
+		return errors.New("jwks has no keys")
+	}
+
+	v.keys = keys
+	v.refreshedAt = time.Now()
+	v.logger.Debugw("jwks refreshed", "jwks", v.jwksSource, "keys", len(keys.Keys))
+	return nil
+}
+
+// discover gets the jwks url from the issuer openid configuration
+func (v *Verifier) discover(ctx context.Context) (string, error) {
+	data, err := v.fetch(ctx, strings.TrimSuffix(v.config.Issuer, "/")+discoveryPath)
+	if err != nil {
+		return "", err
+	}
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", err
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("openid configuration has no jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
+
+func (v *Verifier) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
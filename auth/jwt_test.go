@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "sengen"
+)
+
+type testKey struct {
+	id      string
+	private *rsa.PrivateKey
+}
+
+func newTestKey(t *testing.T, id string) *testKey {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	return &testKey{id: id, private: private}
+}
+
+// writeJWKS writes the public keys to a jwks file
+func writeJWKS(t *testing.T, path string, keys ...*testKey) {
+	set := jose.JSONWebKeySet{}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, jose.JSONWebKey{Key: &k.private.PublicKey, KeyID: k.id, Algorithm: string(jose.RS256), Use: "sig"})
+	}
+	data, err := json.Marshal(set)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func (k *testKey) sign(t *testing.T, claims jwt.Claims) string {
+	return k.signScope(t, claims, "sentences translations")
+}
+
+func (k *testKey) signScope(t *testing.T, claims jwt.Claims, scope string) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: k.private}, (&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", k.id))
+	assert.NoError(t, err)
+	token, err := jwt.Signed(signer).Claims(claims).Claims(map[string]interface{}{"scope": scope}).Serialize()
+	assert.NoError(t, err)
+	return token
+}
+
+func validClaims() jwt.Claims {
+	now := time.Now()
+	return jwt.Claims{
+		Issuer:   testIssuer,
+		Subject:  "user-1",
+		Audience: jwt.Audience{testAudience},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	key := newTestKey(t, "key-1")
+	writeJWKS(t, path, key)
+
+	v, err := NewVerifier(ctx, VerifierConfig{Issuer: testIssuer, Audience: testAudience, JWKS: path, RefreshInterval: time.Hour}, zap.NewNop().Sugar())
+	assert.NoError(t, err)
+
+	p, err := v.Verify(ctx, key.sign(t, validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", p.Name)
+	assert.Equal(t, KindUser, p.Kind)
+	assert.Equal(t, []string{"sentences", "translations"}, p.Scopes)
+
+	expired := validClaims()
+	expired.Expiry = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	_, err = v.Verify(ctx, key.sign(t, expired))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "https://evil.example.com"
+	_, err = v.Verify(ctx, key.sign(t, wrongIssuer))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	wrongAudience := validClaims()
+	wrongAudience.Audience = jwt.Audience{"other"}
+	_, err = v.Verify(ctx, key.sign(t, wrongAudience))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	//Token signed by a key that is not in the set but claims a known key id
+	forged := newTestKey(t, "key-1")
+	_, err = v.Verify(ctx, forged.sign(t, validClaims()))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = v.Verify(ctx, "not-a-token")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerifier_KeyRotation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	oldKey := newTestKey(t, "old")
+	writeJWKS(t, path, oldKey)
+
+	v, err := NewVerifier(ctx, VerifierConfig{Issuer: testIssuer, JWKS: path, RefreshInterval: time.Hour}, zap.NewNop().Sugar())
+	assert.NoError(t, err)
+
+	//The provider rotates to a new key. Unknown key ids trigger a reload once the minimum refresh interval passed
+	newKey := newTestKey(t, "new")
+	writeJWKS(t, path, newKey)
+	v.refreshedAt = time.Now().Add(-2 * minJWKSRefresh)
+
+	p, err := v.Verify(ctx, newKey.sign(t, validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", p.Name)
+
+	_, err = v.Verify(ctx, oldKey.sign(t, validClaims()))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestVerifier_AdminScope(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	key := newTestKey(t, "key-1")
+	writeJWKS(t, path, key)
+
+	//The provider's admin scope grants nothing by default
+	v, err := NewVerifier(ctx, VerifierConfig{Issuer: testIssuer, JWKS: path}, zap.NewNop().Sugar())
+	assert.NoError(t, err)
+	p, err := v.Verify(ctx, key.signScope(t, validClaims(), "admin sentences"))
+	assert.NoError(t, err)
+	assert.False(t, p.HasScope(ScopeAdmin))
+	assert.Equal(t, []string{"sentences"}, p.Scopes)
+
+	//Only the configured scope grants the admin rpcs
+	v, err = NewVerifier(ctx, VerifierConfig{Issuer: testIssuer, JWKS: path, AdminScope: "sengen:admin"}, zap.NewNop().Sugar())
+	assert.NoError(t, err)
+	p, err = v.Verify(ctx, key.signScope(t, validClaims(), "admin"))
+	assert.NoError(t, err)
+	assert.False(t, p.HasScope(ScopeAdmin))
+	p, err = v.Verify(ctx, key.signScope(t, validClaims(), "sengen:admin"))
+	assert.NoError(t, err)
+	assert.True(t, p.HasScope(ScopeAdmin))
+}
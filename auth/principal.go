@@ -0,0 +1,45 @@
+package auth
+
+import "context"
+
+const (
+	KindAPIKey = "api_key"
+	KindUser   = "user"
+	//KindClientCert is a caller authenticated by the client certificate of a mutual tls connection
+	KindClientCert = "client_cert"
+)
+
+// Principal is the authenticated caller of an rpc
+type Principal struct {
+	Name   string
+	Kind   string
+	Scopes []string
+}
+
+// ID returns the principal identifier in the "kind:name" form
+func (p *Principal) ID() string {
+	return p.Kind + ":" + p.Name
+}
+
+// HasScope reports whether the principal was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx that carries the principal
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx, if any
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
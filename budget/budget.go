@@ -0,0 +1,159 @@
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	//The alpine image has no zoneinfo, so reset time zones are embedded
+	_ "time/tzdata"
+
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+)
+
+type Period string
+
+const (
+	Hourly  Period = "hourly"
+	Daily   Period = "daily"
+	Weekly  Period = "weekly"
+	Monthly Period = "monthly"
+)
+
+// Window is a spending limit that resets at the start of every period in its time zone.
+// Weeks start on Monday
+type Window struct {
+	Period   Period
+	Limit    currency.MicroUSD
+	Location *time.Location
+}
+
+type windowConfig struct {
+	Period   Period            `json:"period"`
+	Limit    currency.MicroUSD `json:"limit_micro_usd"`
+	TimeZone string            `json:"time_zone"`
+}
+
+// LoadWindows reads the budget windows from a json file. An empty time zone means UTC
+func LoadWindows(path string) ([]Window, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var windows []Window
+	if err := json.Unmarshal(data, &windows); err != nil {
+		return nil, err
+	}
+	return windows, nil
+}
+
+// UnmarshalJSON decodes the window from {period, limit_micro_usd, time_zone}. An empty time zone means UTC
+func (w *Window) UnmarshalJSON(data []byte) error {
+	var c windowConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return err
+	}
+	*w = Window{Period: c.Period, Limit: c.Limit, Location: normalize(loc)}
+	return nil
+}
+
+// normalize returns UTC for the zones that keep UTC time all year, like Etc/UTC or Etc/GMT, so their windows
+// share the keys of the UTC windows. Other zones are returned as they are
+func normalize(loc *time.Location) *time.Location {
+	if loc == nil {
+		return nil
+	}
+	year := time.Now().Year()
+	for month := range 24 {
+		if _, offset := time.Date(year, time.Month(month+1), 1, 0, 0, 0, 0, loc).Zone(); offset != 0 {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// Validate checks that every window has a known period and a positive limit and that no two windows count the same spending
+func Validate(windows []Window) error {
+	now := time.Now()
+	seen := make(map[string]bool, len(windows))
+	for _, w := range windows {
+		switch w.Period {
+		case Hourly, Daily, Weekly, Monthly:
+		default:
+			return fmt.Errorf("invalid budget period %q", w.Period)
+		}
+		if w.Limit <= 0 {
+			return fmt.Errorf("%s budget limit must be positive", w.Period)
+		}
+		if w.Location == nil {
+			return fmt.Errorf("%s budget has no time zone", w.Period)
+		}
+		w.Location = normalize(w.Location)
+		key := w.Key(now)
+		if seen[key] {
+			return errors.New("duplicate budget window " + key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// Start returns the start of the window period that t falls into
+func (w Window) Start(t time.Time) time.Time {
+	t = t.In(w.Location)
+	year, month, day := t.Date()
+	switch w.Period {
+	case Hourly:
+		//Building the hour from the wall clock would be ambiguous in the hour repeated when daylight saving time ends
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case Weekly:
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, w.Location)
+	case Monthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, w.Location)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, w.Location)
+	}
+}
+
+// End returns the end of the window period that t falls into, when the budget resets
+func (w Window) End(t time.Time) time.Time {
+	start := w.Start(t)
+	switch w.Period {
+	case Hourly:
+		return start.Add(time.Hour)
+	case Weekly:
+		return start.AddDate(0, 0, 7)
+	case Monthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// Key identifies the spending of the window period that t falls into.
+// The daily UTC window keeps the plain "2006-01-02" key that spending was stored under before budget windows existed.
+// Hours are keyed by their start in UTC, so the hour repeated when daylight saving time ends gets a key of its own
+func (w Window) Key(t time.Time) string {
+	start := w.Start(t)
+	if w.Period == Daily && w.Location == time.UTC {
+		return start.Format(time.DateOnly)
+	}
+
+	layout := time.DateOnly
+	switch w.Period {
+	case Hourly:
+		start = start.UTC()
+		layout = "2006-01-02T15"
+	case Monthly:
+		layout = "2006-01"
+	}
+	//Time zone names have slashes that can't be used in firestore doc ids
+	zone := strings.ReplaceAll(w.Location.String(), "/", "-")
+	return string(w.Period) + "_" + zone + "_" + start.Format(layout)
+}
@@ -0,0 +1,101 @@
+package budget
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow_Key(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	assert.NoError(t, err)
+
+	//Sunday 20:30 UTC is Monday 05:30 in Tokyo
+	now := time.Date(2026, 10, 18, 20, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		window Window
+		key    string
+		start  time.Time
+	}{
+		{Window{Period: Daily, Location: time.UTC}, "2026-10-18", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{Window{Period: Hourly, Location: time.UTC}, "hourly_UTC_2026-10-18T20", time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)},
+		{Window{Period: Weekly, Location: time.UTC}, "weekly_UTC_2026-10-12", time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)},
+		{Window{Period: Monthly, Location: time.UTC}, "monthly_UTC_2026-10", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{Window{Period: Daily, Location: tokyo}, "daily_Asia-Tokyo_2026-10-19", time.Date(2026, 10, 19, 0, 0, 0, 0, tokyo)},
+		{Window{Period: Weekly, Location: tokyo}, "weekly_Asia-Tokyo_2026-10-19", time.Date(2026, 10, 19, 0, 0, 0, 0, tokyo)},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.key, tt.window.Key(now))
+		assert.True(t, tt.start.Equal(tt.window.Start(now)), tt.key)
+		//The next period starts where this one ends
+		assert.NotEqual(t, tt.key, tt.window.Key(tt.window.End(now)))
+		assert.Equal(t, tt.key, tt.window.Key(tt.window.End(now).Add(-time.Nanosecond)))
+	}
+}
+
+func TestLoadWindows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budgets.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[
+		{"period": "monthly", "limit_micro_usd": 300000000, "time_zone": "Asia/Tokyo"},
+		{"period": "hourly", "limit_micro_usd": 1000000}
+	]`), 0o600))
+
+	windows, err := LoadWindows(path)
+	assert.NoError(t, err)
+	assert.Len(t, windows, 2)
+	assert.Equal(t, "Asia/Tokyo", windows[0].Location.String())
+	assert.Equal(t, time.UTC, windows[1].Location)
+	assert.NoError(t, Validate(windows))
+
+	//The same window twice would count every request twice
+	assert.Error(t, Validate(append(windows, windows[0])))
+	assert.Error(t, Validate([]Window{{Period: "yearly", Limit: 1, Location: time.UTC}}))
+	assert.Error(t, Validate([]Window{{Period: Daily, Location: time.UTC}}))
+}
+
+func TestWindow_KeyDaylightSaving(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	w := Window{Period: Hourly, Location: newYork}
+
+	//01:30 happens twice on 2026-11-01 in New York, first in EDT and then in EST
+	first := time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	assert.Equal(t, first.In(newYork).Hour(), second.In(newYork).Hour())
+	assert.Equal(t, "hourly_America-New_York_2026-11-01T05", w.Key(first))
+	assert.Equal(t, "hourly_America-New_York_2026-11-01T06", w.Key(second))
+	assert.True(t, w.Start(second).Equal(time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC)))
+	assert.True(t, w.End(first).Equal(w.Start(second)))
+
+	//02:00 is skipped on 2026-03-08, the hour after 01:59 EST is 03:00 EDT
+	before := time.Date(2026, 3, 8, 6, 59, 0, 0, time.UTC)
+	after := before.Add(time.Minute)
+	assert.NotEqual(t, w.Key(before), w.Key(after))
+	assert.True(t, w.End(before).Equal(w.Start(after)))
+	assert.Equal(t, 3, w.Start(after).In(newYork).Hour())
+}
+
+func TestValidate_UTCAliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budgets.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"period": "daily", "limit_micro_usd": 1000000, "time_zone": "Etc/UTC"}]`), 0o600))
+	windows, err := LoadWindows(path)
+	assert.NoError(t, err)
+	assert.Equal(t, time.UTC, windows[0].Location)
+
+	//Zones that keep UTC time count the same spending as UTC
+	etcUTC, err := time.LoadLocation("Etc/UTC")
+	assert.NoError(t, err)
+	etcGMT, err := time.LoadLocation("Etc/GMT")
+	assert.NoError(t, err)
+	assert.Error(t, Validate([]Window{{Period: Daily, Limit: 1, Location: time.UTC}, {Period: Daily, Limit: 2, Location: etcUTC}}))
+	assert.Error(t, Validate([]Window{{Period: Weekly, Limit: 1, Location: etcGMT}, {Period: Weekly, Limit: 2, Location: etcUTC}}))
+
+	//London keeps UTC time in winter only
+	london, err := time.LoadLocation("Europe/London")
+	assert.NoError(t, err)
+	assert.NoError(t, Validate([]Window{{Period: Daily, Limit: 1, Location: time.UTC}, {Period: Daily, Limit: 2, Location: london}}))
+}
@@ -0,0 +1,197 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+const (
+	//ClientAuthOptional verifies the client certificates presented, callers without one authenticate with api keys or tokens
+	ClientAuthOptional = "optional"
+	//ClientAuthRequire rejects connections without a client certificate signed by the client ca
+	ClientAuthRequire = "require"
+
+	//reloadDelay collects the bursts of events of a certificate rotation into a single reload
+	reloadDelay = 100 * time.Millisecond
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid tls config")
+	ErrNoClientCA    = errors.New("client ca file has no certificates")
+)
+
+// Config configures the server certificate and the verification of client certificates
+type Config struct {
+	CertFile string
+	KeyFile  string
+	//ClientCAFile is the pem bundle client certificates are verified against, empty turns mutual tls off
+	ClientCAFile string
+	//ClientAuth is optional or require, it only applies with a client ca
+	ClientAuth string
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.Join(ErrInvalidConfig, errors.New("certificate and key files must be set"))
+	}
+	switch c.ClientAuth {
+	case ClientAuthOptional, ClientAuthRequire:
+	default:
+		return errors.Join(ErrInvalidConfig, errors.New("client auth must be optional or require"))
+	}
+	return nil
+}
+
+// Reloader keeps the certificate and the client ca loaded from the files and reloads them when the files change,
+// so rotated certificates apply to new connections without a restart
+type Reloader struct {
+	cfg    Config
+	logger *zap.SugaredLogger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+// New creates new reloader and loads the files
+func New(cfg Config, logger *zap.SugaredLogger) (*Reloader, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	r := &Reloader{cfg: cfg, logger: logger}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the files again. On error the previous certificate and client ca are kept
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		data, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return ErrNoClientCA
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.pool = &cert, pool
+	return nil
+}
+
+// Certificate returns the current server certificate
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// TLSConfig returns the server tls config. Every handshake uses the current certificate and client ca
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				//grpc requires h2, the http gateway and grpc-web also serve http/1.1
+				NextProtos: []string{"h2", "http/1.1"},
+			}
+			if r.pool != nil {
+				cfg.ClientCAs = r.pool
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				if r.cfg.ClientAuth == ClientAuthRequire {
+					cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				}
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// Watch reloads the files when they change until ctx is done. The directories are watched rather than the files,
+// so files replaced by renames and the symlink swaps of kubernetes secrets are noticed too
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	var dirs []string
+	for i, f := range files {
+		if abs, err := filepath.Abs(f); err == nil {
+			files[i] = abs
+		}
+		if dir := filepath.Dir(files[i]); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+			if err := watcher.Add(dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			//Kubernetes swaps the ..data symlink of the directory, the files themselves don't change
+			if slices.Contains(files, event.Name) || filepath.Base(event.Name) == "..data" {
+				timer.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			r.logger.Errorw("certificate watcher failed", "error", err)
+		case <-timer.C:
+			if err := r.Reload(); err != nil {
+				r.logger.Errorw("failed to reload certificates, keeping the previous ones", "error", err)
+				continue
+			}
+			r.logger.Infow("certificates reloaded", "cert_file", r.cfg.CertFile, "client_ca_file", r.cfg.ClientCAFile)
+		}
+	}
+}
+
+// SubjectName returns the common name of the subject of the certificate, or the whole subject without one
+func SubjectName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
@@ -0,0 +1,135 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeCert writes a self signed certificate with the common name and its key to the files
+func writeCert(t *testing.T, certFile, keyFile, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, Config{CertFile: "cert.pem", KeyFile: "key.pem", ClientAuth: ClientAuthRequire}.Validate())
+	assert.NoError(t, Config{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem", ClientAuth: ClientAuthOptional}.Validate())
+	assert.ErrorIs(t, Config{CertFile: "cert.pem", ClientAuth: ClientAuthRequire}.Validate(), ErrInvalidConfig)
+	assert.ErrorIs(t, Config{CertFile: "cert.pem", KeyFile: "key.pem", ClientAuth: "always"}.Validate(), ErrInvalidConfig)
+}
+
+func TestReloader_TLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	caFile, caKeyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	writeCert(t, certFile, keyFile, "server")
+	writeCert(t, caFile, caKeyFile, "clients")
+
+	r, err := New(Config{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire}, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	cfg, err := r.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "server", commonName(t, &cfg.Certificates[0]))
+	assert.Equal(t, tls.NoClientCert, cfg.ClientAuth)
+	assert.Contains(t, cfg.NextProtos, "h2")
+
+	r, err = New(Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: ClientAuthRequire}, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	cfg, err = r.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+	assert.NotNil(t, cfg.ClientCAs)
+
+	r, err = New(Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: ClientAuthOptional}, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	cfg, err = r.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, cfg.ClientAuth)
+
+	//The ca bundle must hold certificates
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+	_, err = New(Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: ClientAuthOptional}, zap.NewNop().Sugar())
+	assert.ErrorIs(t, err, ErrNoClientCA)
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "first")
+
+	r, err := New(Config{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire}, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, r.Certificate()))
+
+	writeCert(t, certFile, keyFile, "second")
+	require.NoError(t, r.Reload())
+	assert.Equal(t, "second", commonName(t, r.Certificate()))
+
+	//A broken file keeps the previous certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0o600))
+	assert.Error(t, r.Reload())
+	assert.Equal(t, "second", commonName(t, r.Certificate()))
+}
+
+func TestReloader_Watch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "first")
+
+	r, err := New(Config{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire}, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Watch(ctx) }()
+
+	//Rotate the certificate by renaming new files over the old ones
+	assert.Eventually(t, func() bool {
+		writeCert(t, certFile+".tmp", keyFile+".tmp", "rotated")
+		require.NoError(t, os.Rename(keyFile+".tmp", keyFile))
+		require.NoError(t, os.Rename(certFile+".tmp", certFile))
+		time.Sleep(2 * reloadDelay)
+		return commonName(t, r.Certificate()) == "rotated"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
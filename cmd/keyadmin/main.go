@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/auth"
+	"github.com/dafraer/sentence-gen-grpc-server/config"
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+const usage = `usage:
+  keyadmin issue -name <name> [-scopes GenerateSentence,Translate] [-ttl 720h]
+  keyadmin revoke -name <name>
+  keyadmin list`
+
+var errUsage = errors.New(usage)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code := 1
+		if errors.Is(err, errUsage) {
+			code = 2
+		}
+		os.Exit(code)
+	}
+}
+
+// run opens the key store and runs the command. It only needs the key store settings of the server, not its whole config
+func run() error {
+	if len(os.Args) < 2 {
+		return errUsage
+	}
+	godotenv.Load()
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		return err
+	}
+	sugar := logger.Sugar()
+
+	ctx := context.Background()
+
+	//Open the key store configured for the server
+	var keyStore auth.KeyStore
+	switch os.Getenv("API_KEY_STORE") {
+	case config.KeyStoreFile:
+		path := os.Getenv("API_KEYS_FILE")
+		if path == "" {
+			return errors.New("API_KEYS_FILE must be set when API_KEY_STORE is file")
+		}
+		keyStore, err = auth.NewFileKeyStore(path)
+		if err != nil {
+			return err
+		}
+	case config.KeyStoreFirestore:
+		projectID := os.Getenv("PROJECT_ID")
+		if projectID == "" {
+			return errors.New("PROJECT_ID must be set when API_KEY_STORE is firestore")
+		}
+		//Keys aren't sharded, so the spending shards don't matter here
+		store, err := db.New(ctx, sugar, projectID, 1)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		keyStore = store
+	case config.KeyStoreNone:
+		return errors.New("API_KEY_STORE is not configured")
+	default:
+		return errors.New("invalid API_KEY_STORE")
+	}
+
+	switch os.Args[1] {
+	case "issue":
+		return issue(ctx, keyStore, os.Args[2:])
+	case "revoke":
+		return revoke(ctx, keyStore, os.Args[2:])
+	case "list":
+		return list(ctx, keyStore)
+	default:
+		return errUsage
+	}
+}
+
+// issue creates a new api key and prints it. The key itself is never stored and can't be shown again
+func issue(ctx context.Context, keyStore auth.KeyStore, args []string) error {
+	fs := flag.NewFlagSet("issue", flag.ExitOnError)
+	name := fs.String("name", "", "unique key name")
+	scopes := fs.String("scopes", auth.ScopeAll, "comma separated list of allowed rpcs")
+	ttl := fs.Duration("ttl", 0, "key lifetime, 0 means the key never expires")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	key, hash, err := auth.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	apiKey := &auth.APIKey{
+		Name:      *name,
+		Hash:      hash,
+		Scopes:    strings.Split(*scopes, ","),
+		CreatedAt: now,
+	}
+	if *ttl > 0 {
+		apiKey.ExpiresAt = now.Add(*ttl)
+	}
+	if err := keyStore.SaveKey(ctx, apiKey); err != nil {
+		return err
+	}
+
+	fmt.Println(key)
+	return nil
+}
+
+// revoke revokes the api key with the given name
+func revoke(ctx context.Context, keyStore auth.KeyStore, args []string) error {
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	name := fs.String("name", "", "key name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return keyStore.RevokeKey(ctx, *name)
+}
+
+// list prints all the api keys without their hashes
+func list(ctx context.Context, keyStore auth.KeyStore) error {
+	keys, err := keyStore.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, k := range keys {
+		state := "active"
+		switch {
+		case k.Revoked:
+			state = "revoked"
+		case k.Expired(now):
+			state = "expired"
+		}
+		expires := "never"
+		if !k.ExpiresAt.IsZero() {
+			expires = k.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\tscopes=%s\texpires=%s\n", k.Name, state, strings.Join(k.Scopes, ","), expires)
+	}
+	return nil
+}
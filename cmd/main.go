@@ -4,14 +4,22 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"time"
 
+	"github.com/dafraer/sentence-gen-grpc-server/alert"
+	"github.com/dafraer/sentence-gen-grpc-server/auth"
+	"github.com/dafraer/sentence-gen-grpc-server/certs"
 	"github.com/dafraer/sentence-gen-grpc-server/config"
 	"github.com/dafraer/sentence-gen-grpc-server/db"
 	"github.com/dafraer/sentence-gen-grpc-server/gemini"
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	"github.com/dafraer/sentence-gen-grpc-server/metrics"
+	"github.com/dafraer/sentence-gen-grpc-server/plan"
+	"github.com/dafraer/sentence-gen-grpc-server/ratelimit"
 	"github.com/dafraer/sentence-gen-grpc-server/server"
 	"github.com/dafraer/sentence-gen-grpc-server/service"
+	"github.com/dafraer/sentence-gen-grpc-server/tracing"
 	"github.com/dafraer/sentence-gen-grpc-server/tts"
-	"go.uber.org/zap"
 )
 
 func main() {
@@ -22,7 +30,7 @@ func main() {
 	}
 
 	//Create logger
-	logger, err := zap.NewDevelopment()
+	logger, err := logging.New(cfg.Logging)
 	if err != nil {
 		panic(err)
 	}
@@ -32,8 +40,23 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
+	//Export traces of the rpcs and the gemini, tts and firestore calls
+	if cfg.TraceExporter != "" {
+		shutdown, err := tracing.Setup(ctx, cfg.TraceExporter, cfg.TraceSampleRatio, sugar)
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(shutdownCtx); err != nil {
+				sugar.Errorw("failed to flush traces", "error", err)
+			}
+		}()
+	}
+
 	//Create firestore client
-	store, err := db.New(ctx, sugar, cfg.ProjectID)
+	store, err := db.New(ctx, sugar, cfg.ProjectID, cfg.SpendingShards)
 	if err != nil {
 		panic(err)
 	}
@@ -43,14 +66,29 @@ func main() {
 		}
 	}(store)
 
+	//Put the in-process aggregator in front of the store if spending is flushed in batches
+	var spendingStore service.SpendingStore = store
+	if cfg.SpendingFlush > 0 {
+		aggregator, err := db.NewAggregator(ctx, store, sugar, cfg.SpendingFlush)
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			if err := aggregator.Close(); err != nil {
+				sugar.Errorw("failed to flush spending", "error", err)
+			}
+		}()
+		spendingStore = aggregator
+	}
+
 	//Create gemini client
-	geminiClient, err := gemini.New(ctx, sugar, cfg.GeminiModel)
+	geminiClient, err := gemini.New(ctx, sugar, cfg.GeminiModel, cfg.GeminiMaxOutput, cfg.GeminiThinking, cfg.GeminiUpstream)
 	if err != nil {
 		panic(err)
 	}
 
 	//Create tts client
-	ttsClient, err := tts.New(ctx, sugar)
+	ttsClient, err := tts.New(ctx, sugar, cfg.TTSUpstream)
 	if err != nil {
 		panic(err)
 	}
@@ -60,11 +98,111 @@ func main() {
 		}
 	}()
 
+	//Create budget alert notifier
+	var notifier *alert.Notifier
+	if cfg.AlertsFile != "" {
+		alerts, err := alert.LoadConfig(cfg.AlertsFile)
+		if err != nil {
+			panic(err)
+		}
+		notifier = alert.New(*alerts, sugar)
+		defer notifier.Close()
+	}
+
+	//Serve prometheus metrics on their own address
+	var m *metrics.Metrics
+	if cfg.MetricsAddress != "" {
+		m = metrics.New()
+		go func() {
+			if err := m.Serve(ctx, cfg.MetricsAddress, sugar); err != nil {
+				sugar.Errorw("metrics server failed", "error", err)
+			}
+		}()
+	}
+
 	//Create new service
-	srvc := service.New(ttsClient, geminiClient, sugar, store, cfg)
+	srvc := service.New(ttsClient, geminiClient, sugar, spendingStore, cfg, notifier, m)
+
+	//Create api key authenticator
+	var authenticator *auth.Authenticator
+	switch cfg.APIKeyStore {
+	case config.KeyStoreFile:
+		keyStore, err := auth.NewFileKeyStore(cfg.APIKeysFile)
+		if err != nil {
+			panic(err)
+		}
+		authenticator = auth.NewAuthenticator(keyStore, sugar)
+	case config.KeyStoreFirestore:
+		authenticator = auth.NewAuthenticator(store, sugar)
+	}
+
+	//Create bearer token verifier for end users signed in with the oidc provider
+	var verifier *auth.Verifier
+	if cfg.OIDCIssuer != "" {
+		verifier, err = auth.NewVerifier(ctx, auth.VerifierConfig{
+			Issuer:          cfg.OIDCIssuer,
+			Audience:        cfg.OIDCAudience,
+			JWKS:            cfg.OIDCJWKS,
+			RefreshInterval: cfg.OIDCJWKSRefresh,
+			AdminScope:      cfg.OIDCAdminScope,
+		}, sugar)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if authenticator == nil && verifier == nil {
+		sugar.Warnw("authentication is disabled")
+	}
+
+	//Create rate limiter
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimitsFile != "" {
+		limits, err := ratelimit.LoadConfig(cfg.RateLimitsFile)
+		if err != nil {
+			panic(err)
+		}
+		limiter = ratelimit.New(*limits)
+	}
+
+	//Create plan registry. Plans assigned at runtime are kept in firestore
+	var plans *plan.Registry
+	if cfg.PlansFile != "" {
+		planConfig, err := plan.LoadConfig(cfg.PlansFile)
+		if err != nil {
+			panic(err)
+		}
+		plans, err = plan.New(ctx, *planConfig, store, cfg.PlanRefresh, sugar)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	//Load the certificates and reload them when they are rotated
+	var reloader *certs.Reloader
+	if cfg.TLS != nil {
+		reloader, err = certs.New(*cfg.TLS, sugar)
+		if err != nil {
+			panic(err)
+		}
+		go func() {
+			if err := reloader.Watch(ctx); err != nil {
+				sugar.Errorw("failed to watch certificates, rotated certificates need a restart", "error", err)
+			}
+		}()
+	}
 
 	//Create new grpc server
-	srv := server.NewServer(srvc, sugar)
+	srv := server.NewServer(srvc, authenticator, verifier, limiter, plans, m, server.Options{
+		Reflection:     cfg.GRPCReflection,
+		Channelz:       cfg.GRPCChannelz,
+		Tracing:        cfg.TraceExporter != "",
+		HealthInterval: cfg.HealthInterval,
+		GatewayAddress: cfg.GatewayAddress,
+		GRPCWebAddress: cfg.GRPCWebAddress,
+		CORSOrigins:    cfg.CORSOrigins,
+		TLS:            reloader,
+	}, sugar)
 
 	//Run the server
 	if err := srv.Run(ctx, cfg.Address); err != nil {
@@ -4,18 +4,75 @@ import (
 	"errors"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/dafraer/sentence-gen-grpc-server/budget"
+	"github.com/dafraer/sentence-gen-grpc-server/certs"
 	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/degrade"
+	"github.com/dafraer/sentence-gen-grpc-server/gemini"
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	"github.com/dafraer/sentence-gen-grpc-server/pricing"
+	"github.com/dafraer/sentence-gen-grpc-server/tracing"
+	"github.com/dafraer/sentence-gen-grpc-server/tts"
+	"github.com/dafraer/sentence-gen-grpc-server/upstream"
 	"github.com/joho/godotenv"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	KeyStoreNone      = ""
+	KeyStoreFile      = "file"
+	KeyStoreFirestore = "firestore"
 )
 
 type Config struct {
 	DailyQuota        currency.MicroUSD
+	BudgetsFile       string
+	PricingFile       string
+	Pricing           *pricing.Table
+	Budgets           []budget.Window
 	ProjectID         string
 	Address           string
 	GeminiModel       string
 	GeminiInputPrice  currency.MicroUSD
 	GeminiOutputPrice currency.MicroUSD
+	GeminiMaxOutput   int32
+	GeminiThinking    int32
+	GeminiUpstream    upstream.Config
+	TTSUpstream       upstream.Config
+	APIKeyStore       string
+	APIKeysFile       string
+	OIDCIssuer        string
+	OIDCAudience      string
+	OIDCJWKS          string
+	OIDCJWKSRefresh   time.Duration
+	OIDCAdminScope    string
+	RateLimitsFile    string
+	AlertsFile        string
+	DegradationFile   string
+	Degradation       []degrade.Policy
+	ResultCacheSize   int
+	AudioReserve      int
+	PlansFile         string
+	PlanRefresh       time.Duration
+	ExchangeRatesFile string
+	GRPCReflection    bool
+	GRPCChannelz      bool
+	HealthInterval    time.Duration
+	MetricsAddress    string
+	GatewayAddress    string
+	GRPCWebAddress    string
+	CORSOrigins       []string
+	TLS               *certs.Config
+	Logging           logging.Config
+	TraceExporter     string
+	TraceSampleRatio  float64
+	ExchangeRates     currency.Rates
+	SpendingFlush     time.Duration
+	SpendingShards    int
+	LedgerRetention   time.Duration
 }
 
 // New creates new config from the .env file
@@ -23,31 +80,377 @@ func New() (*Config, error) {
 	//Ignore the error because if we don't have .env file we are in a docker container
 	godotenv.Load()
 
-	quota, err := strconv.Atoi(os.Getenv("DAILY_QUOTA"))
-	if err != nil {
+	//DAILY_QUOTA may be left empty when the budget windows come from BUDGETS_FILE
+	//Amounts need a unit: $5 or 5usd, or 5000000micro
+	var quota currency.MicroUSD
+	var err error
+	if v := os.Getenv("DAILY_QUOTA"); v != "" {
+		quota, err = currency.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//Gemini prices may be left empty when the prices come from PRICING_FILE
+	var inputPrice, outputPrice currency.MicroUSD
+	if v := os.Getenv("GEMINI_INPUT_PRICE"); v != "" {
+		inputPrice, err = currency.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if v := os.Getenv("GEMINI_OUTPUT_PRICE"); v != "" {
+		outputPrice, err = currency.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	maxOutput := 8192
+	if v := os.Getenv("GEMINI_MAX_OUTPUT_TOKENS"); v != "" {
+		maxOutput, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//Thinking is capped so the output reserved per call stays close to what the answers need.
+	//The budget must be in the range of every model that thinks, models without thinking ignore it
+	thinkingBudget := 1024
+	if v := os.Getenv("GEMINI_THINKING_BUDGET"); v != "" {
+		thinkingBudget, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	jwksRefresh := time.Hour
+	if v := os.Getenv("OIDC_JWKS_REFRESH"); v != "" {
+		jwksRefresh, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	planRefresh := time.Minute
+	if v := os.Getenv("PLAN_REFRESH"); v != "" {
+		planRefresh, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	healthInterval := 10 * time.Second
+	if v := os.Getenv("HEALTH_CHECK_INTERVAL"); v != "" {
+		healthInterval, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//Logs are written like in development unless configured otherwise
+	logConfig := logging.Config{
+		Format:    os.Getenv("LOG_FORMAT"),
+		Level:     zapcore.DebugLevel,
+		Redaction: os.Getenv("LOG_REDACTION"),
+		HashKey:   os.Getenv("LOG_HASH_KEY"),
+	}
+	if logConfig.Format == "" {
+		logConfig.Format = logging.FormatConsole
+	}
+	//User supplied text is kept out of the logs unless configured otherwise, hashed if there is a key to hash it with
+	if logConfig.Redaction == "" {
+		logConfig.Redaction = logging.RedactRemove
+		if logConfig.HashKey != "" {
+			logConfig.Redaction = logging.RedactHash
+		}
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		logConfig.Level, err = zapcore.ParseLevel(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if v := os.Getenv("LOG_SAMPLING"); v != "" {
+		logConfig.Sampling, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := logConfig.Validate(); err != nil {
 		return nil, err
 	}
 
-	inputPrice, err := strconv.Atoi(os.Getenv("GEMINI_INPUT_PRICE"))
+	//Browsers may only call grpc-web from the listed origins
+	var corsOrigins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			corsOrigins = append(corsOrigins, origin)
+		}
+	}
+
+	//Upstream calls are retried three times, gemini may think for a while before answering
+	geminiUpstream, err := upstreamPolicy("GEMINI", upstream.Config{Timeout: time.Minute, MaxAttempts: 3, InitialBackoff: 500 * time.Millisecond, MaxBackoff: 5 * time.Second, BreakerFailures: 5, BreakerOpenTimeout: 30 * time.Second})
 	if err != nil {
 		return nil, err
 	}
-
-	outputPrice, err := strconv.Atoi(os.Getenv("GEMINI_OUTPUT_PRICE"))
+	ttsUpstream, err := upstreamPolicy("TTS", upstream.Config{Timeout: 15 * time.Second, MaxAttempts: 3, InitialBackoff: 200 * time.Millisecond, MaxBackoff: 2 * time.Second, BreakerFailures: 5, BreakerOpenTimeout: 30 * time.Second})
 	if err != nil {
 		return nil, err
 	}
 
+	//The listeners serve plaintext unless a certificate is set, client certificates are required with a client ca by default
+	var tlsConfig *certs.Config
+	if certFile, keyFile, caFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"), os.Getenv("TLS_CLIENT_CA_FILE"); certFile != "" || keyFile != "" || caFile != "" {
+		tlsConfig = &certs.Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: os.Getenv("TLS_CLIENT_AUTH")}
+		if tlsConfig.ClientAuth == "" {
+			tlsConfig.ClientAuth = certs.ClientAuthRequire
+		}
+		if err := tlsConfig.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	//Every trace is sampled unless a ratio is set
+	traceSampleRatio := 1.0
+	if v := os.Getenv("TRACE_SAMPLE_RATIO"); v != "" {
+		traceSampleRatio, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//Reflection and channelz are off unless switched on
+	var reflection, channelz bool
+	if v := os.Getenv("GRPC_REFLECTION"); v != "" {
+		reflection, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if v := os.Getenv("GRPC_CHANNELZ"); v != "" {
+		channelz, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//Zero means spending is written to firestore on every request
+	var spendingFlush time.Duration
+	if v := os.Getenv("SPENDING_FLUSH_INTERVAL"); v != "" {
+		spendingFlush, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//Zero disables the ledger of requests
+	var ledgerRetention time.Duration
+	if v := os.Getenv("LEDGER_RETENTION"); v != "" {
+		ledgerRetention, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//Results are cached to be served when the budget is exhausted, zero disables the cache
+	resultCacheSize := 1000
+	if v := os.Getenv("RESULT_CACHE_SIZE"); v != "" {
+		resultCacheSize, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//The generated sentence isn't known when its audio is reserved, so this many characters are reserved for it.
+	//Longer sentences are still spoken and billed for their actual length
+	sentenceAudioReserve := 300
+	if v := os.Getenv("SENTENCE_AUDIO_RESERVE"); v != "" {
+		sentenceAudioReserve, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//One shard means all spending of a day is written to a single doc
+	spendingShards := 1
+	if v := os.Getenv("SPENDING_SHARDS"); v != "" {
+		spendingShards, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	cfg := &Config{
-		GeminiInputPrice:  currency.MicroUSD(inputPrice),
-		GeminiOutputPrice: currency.MicroUSD(outputPrice),
-		DailyQuota:        currency.MicroUSD(quota),
+		GeminiInputPrice:  inputPrice,
+		GeminiOutputPrice: outputPrice,
+		GeminiMaxOutput:   int32(maxOutput),
+		GeminiThinking:    int32(thinkingBudget),
+		GeminiUpstream:    geminiUpstream,
+		TTSUpstream:       ttsUpstream,
+		DailyQuota:        quota,
+		BudgetsFile:       os.Getenv("BUDGETS_FILE"),
+		PricingFile:       os.Getenv("PRICING_FILE"),
 		ProjectID:         os.Getenv("PROJECT_ID"),
 		Address:           os.Getenv("ADDRESS"),
 		GeminiModel:       os.Getenv("GEMINI_MODEL"),
+		APIKeyStore:       os.Getenv("API_KEY_STORE"),
+		APIKeysFile:       os.Getenv("API_KEYS_FILE"),
+		OIDCIssuer:        os.Getenv("OIDC_ISSUER"),
+		OIDCAudience:      os.Getenv("OIDC_AUDIENCE"),
+		OIDCJWKS:          os.Getenv("OIDC_JWKS"),
+		OIDCJWKSRefresh:   jwksRefresh,
+		OIDCAdminScope:    os.Getenv("OIDC_ADMIN_SCOPE"),
+		RateLimitsFile:    os.Getenv("RATE_LIMITS_FILE"),
+		AlertsFile:        os.Getenv("ALERTS_FILE"),
+		DegradationFile:   os.Getenv("DEGRADATION_FILE"),
+		ResultCacheSize:   resultCacheSize,
+		AudioReserve:      sentenceAudioReserve,
+		PlansFile:         os.Getenv("PLANS_FILE"),
+		PlanRefresh:       planRefresh,
+		ExchangeRatesFile: os.Getenv("EXCHANGE_RATES_FILE"),
+		GRPCReflection:    reflection,
+		GRPCChannelz:      channelz,
+		HealthInterval:    healthInterval,
+		MetricsAddress:    os.Getenv("METRICS_ADDRESS"),
+		GatewayAddress:    os.Getenv("GATEWAY_ADDRESS"),
+		GRPCWebAddress:    os.Getenv("GRPC_WEB_ADDRESS"),
+		CORSOrigins:       corsOrigins,
+		TLS:               tlsConfig,
+		Logging:           logConfig,
+		TraceExporter:     os.Getenv("TRACE_EXPORTER"),
+		TraceSampleRatio:  traceSampleRatio,
+		SpendingFlush:     spendingFlush,
+		SpendingShards:    spendingShards,
+		LedgerRetention:   ledgerRetention,
 	}
-	if cfg.DailyQuota == 0 || cfg.ProjectID == "" || cfg.Address == "" || cfg.GeminiModel == "" || cfg.GeminiInputPrice == 0 || cfg.GeminiOutputPrice == 0 {
+	if cfg.ProjectID == "" || cfg.Address == "" || cfg.GeminiModel == "" || cfg.GeminiMaxOutput <= 0 || cfg.GeminiThinking < 0 || cfg.SpendingShards <= 0 || cfg.LedgerRetention < 0 || cfg.ResultCacheSize < 0 || cfg.AudioReserve <= 0 || cfg.HealthInterval <= 0 {
 		return nil, errors.New("invalid configuration")
 	}
+
+	//DAILY_QUOTA is the daily budget reset at midnight UTC
+	if cfg.DailyQuota > 0 {
+		cfg.Budgets = append(cfg.Budgets, budget.Window{Period: budget.Daily, Limit: cfg.DailyQuota, Location: time.UTC})
+	}
+	if cfg.BudgetsFile != "" {
+		windows, err := budget.LoadWindows(cfg.BudgetsFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Budgets = append(cfg.Budgets, windows...)
+	}
+	if len(cfg.Budgets) == 0 {
+		return nil, errors.New("DAILY_QUOTA or BUDGETS_FILE must be set")
+	}
+	if err := budget.Validate(cfg.Budgets); err != nil {
+		return nil, err
+	}
+
+	//Without a pricing table the gemini model is priced with GEMINI_INPUT_PRICE and GEMINI_OUTPUT_PRICE
+	if cfg.PricingFile != "" {
+		cfg.Pricing, err = pricing.Load(cfg.PricingFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if cfg.GeminiInputPrice == 0 || cfg.GeminiOutputPrice == 0 {
+			return nil, errors.New("GEMINI_INPUT_PRICE and GEMINI_OUTPUT_PRICE must be set without PRICING_FILE")
+		}
+		cfg.Pricing = pricing.Default(cfg.GeminiModel, cfg.GeminiInputPrice, cfg.GeminiOutputPrice)
+	}
+	now := time.Now()
+	if _, err := cfg.Pricing.Model(cfg.GeminiModel, now); err != nil {
+		return nil, err
+	}
+	if err := gemini.ValidateThinking(cfg.GeminiModel, cfg.GeminiThinking); err != nil {
+		return nil, err
+	}
+	for _, tier := range []string{tts.Chirp3HD, tts.Standard} {
+		if _, err := cfg.Pricing.Voice(tier, now); err != nil {
+			return nil, err
+		}
+	}
+
+	//The models and voice tiers requests are degraded to must be priced too
+	if cfg.DegradationFile != "" {
+		cfg.Degradation, err = degrade.LoadPolicies(cfg.DegradationFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range cfg.Degradation {
+		if p.GeminiModel != "" {
+			if _, err := cfg.Pricing.Model(p.GeminiModel, now); err != nil {
+				return nil, err
+			}
+			if err := gemini.ValidateThinking(p.GeminiModel, cfg.GeminiThinking); err != nil {
+				return nil, err
+			}
+		}
+		if p.TTSVoice != "" && p.TTSVoice != tts.Chirp3HD && p.TTSVoice != tts.Standard {
+			return nil, errors.New("invalid degradation voice tier " + p.TTSVoice)
+		}
+		if p.CacheOnly && cfg.ResultCacheSize == 0 {
+			return nil, errors.New("cache only degradation requires RESULT_CACHE_SIZE")
+		}
+	}
+
+	//Reports can be shown in other currencies with these rates
+	if cfg.ExchangeRatesFile != "" {
+		cfg.ExchangeRates, err = currency.LoadRates(cfg.ExchangeRatesFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch cfg.APIKeyStore {
+	case KeyStoreNone, KeyStoreFirestore:
+	case KeyStoreFile:
+		if cfg.APIKeysFile == "" {
+			return nil, errors.New("API_KEYS_FILE must be set when API_KEY_STORE is file")
+		}
+	default:
+		return nil, errors.New("invalid API_KEY_STORE")
+	}
+
+	switch cfg.TraceExporter {
+	case "", tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		return nil, errors.New("invalid TRACE_EXPORTER")
+	}
+	if cfg.TraceSampleRatio < 0 || cfg.TraceSampleRatio > 1 {
+		return nil, errors.New("TRACE_SAMPLE_RATIO must be between 0 and 1")
+	}
 	return cfg, nil
 }
+
+// upstreamPolicy reads the timeout, retries and circuit breaker of an upstream from the variables starting with prefix.
+// Unset variables keep the defaults
+func upstreamPolicy(prefix string, policy upstream.Config) (upstream.Config, error) {
+	var err error
+	for name, d := range map[string]*time.Duration{
+		"_TIMEOUT":              &policy.Timeout,
+		"_RETRY_BACKOFF":        &policy.InitialBackoff,
+		"_RETRY_MAX_BACKOFF":    &policy.MaxBackoff,
+		"_BREAKER_OPEN_TIMEOUT": &policy.BreakerOpenTimeout,
+	} {
+		if v := os.Getenv(prefix + name); v != "" {
+			if *d, err = time.ParseDuration(v); err != nil {
+				return policy, err
+			}
+		}
+	}
+	if v := os.Getenv(prefix + "_MAX_ATTEMPTS"); v != "" {
+		if policy.MaxAttempts, err = strconv.Atoi(v); err != nil {
+			return policy, err
+		}
+	}
+	if v := os.Getenv(prefix + "_BREAKER_FAILURES"); v != "" {
+		failures, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return policy, err
+		}
+		policy.BreakerFailures = uint32(failures)
+	}
+	return policy, policy.Validate()
+}
@@ -1,16 +1,190 @@
 package currency
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
 type (
+	// MicroUSD is an exact amount of millionths of a US dollar
 	MicroUSD int64
-	USD      int64
+	// USD is an exact decimal amount of US dollars, e.g. "4.90" or "0.000002"
+	USD string
 )
 
 const conversionRate = 1_000_000
 
+var (
+	ErrOverflow  = errors.New("amount overflows")
+	ErrPrecision = errors.New("amount is more precise than a micro dollar")
+	ErrSyntax    = errors.New("invalid amount")
+)
+
+// ParseUSD parses a decimal US dollar amount such as "4.9", "$0.000002" or "-1". It fails with ErrPrecision below a micro dollar
+func ParseUSD(s string) (MicroUSD, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "$")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: %q", ErrSyntax, s)
+	}
+	if len(strings.TrimRight(frac, "0")) > 6 {
+		return 0, fmt.Errorf("%w: %q", ErrPrecision, s)
+	}
+	frac = (frac + "000000")[:6]
+
+	var w, f int64
+	var err error
+	if whole != "" {
+		if w, err = strconv.ParseInt(whole, 10, 64); err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrOverflow, s)
+		}
+	}
+	if f, err = strconv.ParseInt(frac, 10, 64); err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrSyntax, s)
+	}
+	m, err := Mul(MicroUSD(w), conversionRate)
+	if err != nil {
+		return 0, err
+	}
+	if m, err = Add(m, MicroUSD(f)); err != nil {
+		return 0, err
+	}
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+// Parse parses an amount from the config. The unit is required: "$5" and "5usd" are USD, "5000000micro" is micro USD
+func Parse(s string) (MicroUSD, error) {
+	s = strings.TrimSpace(s)
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasSuffix(lower, "micro"):
+		v, err := strconv.ParseInt(strings.TrimSpace(s[:len(s)-len("micro")]), 10, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, fmt.Errorf("%w: %q", ErrOverflow, s)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrSyntax, s)
+		}
+		return MicroUSD(v), nil
+	case strings.HasSuffix(lower, "usd"):
+		return ParseUSD(strings.TrimSpace(s[:len(s)-len("usd")]))
+	case strings.HasPrefix(strings.TrimPrefix(s, "-"), "$"):
+		return ParseUSD(s)
+	default:
+		return 0, fmt.Errorf("%w: %q has no unit, write e.g. $5, 5usd or 5000000micro", ErrSyntax, s)
+	}
+}
+
+// USD returns the exact amount in US dollars
 func (m MicroUSD) USD() USD {
-	return USD(int(m) / conversionRate)
+	return USD(m.Decimal())
+}
+
+// MicroUSD converts the amount to micro USD. It fails with ErrPrecision below a micro dollar
+func (u USD) MicroUSD() (MicroUSD, error) {
+	return ParseUSD(string(u))
+}
+
+// UnmarshalJSON decodes a number of micro USD or a string with a unit parsed with Parse
+func (m *MicroUSD) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := Parse(s)
+		if err != nil {
+			return err
+		}
+		*m = v
+		return nil
+	}
+	var v int64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*m = MicroUSD(v)
+	return nil
+}
+
+// Decimal returns the exact amount in USD with at least two decimals, e.g. "4.90" or "0.000002"
+func (m MicroUSD) Decimal() string {
+	sign := ""
+	u := uint64(m)
+	if m < 0 {
+		sign, u = "-", uint64(-m)
+	}
+	frac := strings.TrimRight(fmt.Sprintf("%06d", u%conversionRate), "0")
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	return fmt.Sprintf("%s%d.%s", sign, u/conversionRate, frac)
+}
+
+// Round rounds the amount to a multiple of unit, halves away from zero
+func (m MicroUSD) Round(unit MicroUSD) MicroUSD {
+	if unit <= 0 {
+		return m
+	}
+	r := m % unit
+	switch {
+	case r >= 0 && 2*r >= unit:
+		return m - r + unit
+	case r < 0 && -2*r >= unit:
+		return m - r - unit
+	default:
+		return m - r
+	}
+}
+
+// Format returns the amount rounded to cents, e.g. "$4.90"
+func (m MicroUSD) Format() string {
+	rounded := m.Round(conversionRate / 100)
+	sign := ""
+	if rounded < 0 {
+		sign, rounded = "-", -rounded
+	}
+	return fmt.Sprintf("%s$%d.%02d", sign, rounded/conversionRate, rounded%conversionRate/(conversionRate/100))
+}
+
+// Add returns a+b or ErrOverflow
+func Add(a, b MicroUSD) (MicroUSD, error) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, ErrOverflow
+	}
+	return sum, nil
+}
+
+// Mul returns the amount times n, e.g. a per token price times the tokens, or ErrOverflow
+func Mul(m MicroUSD, n int64) (MicroUSD, error) {
+	if m == 0 || n == 0 {
+		return 0, nil
+	}
+	if (m == math.MinInt64 && n == -1) || (n == math.MinInt64 && m == -1) {
+		return 0, ErrOverflow
+	}
+	neg := (m < 0) != (n < 0)
+	hi, lo := bits.Mul64(abs(int64(m)), abs(n))
+	if hi != 0 || lo > math.MaxInt64 {
+		return 0, ErrOverflow
+	}
+	if neg {
+		return -MicroUSD(lo), nil
+	}
+	return MicroUSD(lo), nil
 }
 
-func (u USD) MicroUSD() MicroUSD {
-	return MicroUSD(int(u) * conversionRate)
+func abs(v int64) uint64 {
+	if v < 0 {
+		return uint64(-v)
+	}
+	return uint64(v)
 }
@@ -0,0 +1,150 @@
+package currency
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUSD(t *testing.T) {
+	tests := []struct {
+		in   string
+		want MicroUSD
+	}{
+		{"4.9", 4_900_000},
+		{"$4.90", 4_900_000},
+		{"0.000002", 2},
+		{".5", 500_000},
+		{"3", 3_000_000},
+		{"-1.25", -1_250_000},
+		{"0.0000010", 1},
+	}
+	for _, tt := range tests {
+		got, err := ParseUSD(tt.in)
+		assert.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	_, err := ParseUSD("0.0000001")
+	assert.ErrorIs(t, err, ErrPrecision)
+	_, err = ParseUSD("99999999999999")
+	assert.ErrorIs(t, err, ErrOverflow)
+	for _, in := range []string{"", "$", "1.2.3", "abc", "1e6"} {
+		_, err = ParseUSD(in)
+		assert.Error(t, err, in)
+	}
+
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want MicroUSD
+	}{
+		{"30micro", 30},
+		{"30 micro", 30},
+		{"$0.00003", 30},
+		{"-$1", -1_000_000},
+		{"5usd", 5_000_000},
+		{"5.0 USD", 5_000_000},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		assert.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	//A bare number is ambiguous between USD and micro USD
+	for _, in := range []string{"5", "5.0", "", "micro", "1.5micro", "abcusd"} {
+		_, err := Parse(in)
+		assert.ErrorIs(t, err, ErrSyntax, in)
+	}
+	_, err := Parse("99999999999999999999micro")
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestUSD(t *testing.T) {
+	assert.Equal(t, USD("4.90"), MicroUSD(4_900_000).USD())
+	assert.Equal(t, USD("0.000002"), MicroUSD(2).USD())
+	m, err := USD("4.90").MicroUSD()
+	assert.NoError(t, err)
+	assert.Equal(t, MicroUSD(4_900_000), m)
+	_, err = USD("0.0000001").MicroUSD()
+	assert.ErrorIs(t, err, ErrPrecision)
+}
+
+func TestMicroUSD_Format(t *testing.T) {
+	assert.Equal(t, "4.90", MicroUSD(4_900_000).Decimal())
+	assert.Equal(t, "0.000002", MicroUSD(2).Decimal())
+	assert.Equal(t, "-1.25", MicroUSD(-1_250_000).Decimal())
+
+	assert.Equal(t, "$4.90", MicroUSD(4_900_000).Format())
+	assert.Equal(t, "$0.01", MicroUSD(5_000).Format())
+	assert.Equal(t, "$0.00", MicroUSD(4_999).Format())
+	assert.Equal(t, "-$1.26", MicroUSD(-1_255_000).Format())
+
+	assert.Equal(t, MicroUSD(10), MicroUSD(5).Round(10))
+	assert.Equal(t, MicroUSD(-10), MicroUSD(-5).Round(10))
+	assert.Equal(t, MicroUSD(0), MicroUSD(4).Round(10))
+}
+
+func TestArithmetic(t *testing.T) {
+	sum, err := Add(1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, MicroUSD(3), sum)
+	_, err = Add(math.MaxInt64, 1)
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = Add(math.MinInt64, -1)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	product, err := Mul(-30, 1_000)
+	assert.NoError(t, err)
+	assert.Equal(t, MicroUSD(-30_000), product)
+	_, err = Mul(math.MaxInt64/2, 3)
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = Mul(math.MinInt64, -1)
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestMicroUSD_UnmarshalJSON(t *testing.T) {
+	var prices struct {
+		Input  MicroUSD `json:"input"`
+		Output MicroUSD `json:"output"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"input": 2, "output": "$0.000012"}`), &prices))
+	assert.Equal(t, MicroUSD(2), prices.Input)
+	assert.Equal(t, MicroUSD(12), prices.Output)
+	assert.Error(t, json.Unmarshal([]byte(`{"input": "$0.0000001"}`), &prices))
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"input": "0.000012"}`), &prices), ErrSyntax)
+}
+
+func TestRates_Format(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"EUR": "0.92", "jpy": 151.3, "CHF": "0.8"}`), 0o600))
+	rates, err := LoadRates(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rates["JPY"].Cmp(big.NewRat(1513, 10)))
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"", "$4.90"},
+		{"usd", "$4.90"},
+		{"EUR", "€4.51"},
+		{"JPY", "¥741"},
+		{"CHF", "3.92 CHF"},
+	}
+	for _, tt := range tests {
+		got, err := rates.Format(4_900_000, tt.code)
+		assert.NoError(t, err, tt.code)
+		assert.Equal(t, tt.want, got, tt.code)
+	}
+	_, err = rates.Format(1, "GBP")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
@@ -0,0 +1,86 @@
+package currency
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+const codeUSD = "USD"
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+)
+
+// symbols of the currencies shown with a prefix, the others are shown with their code as a suffix
+var symbols = map[string]string{
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// minorUnits of the currencies without cents
+var minorUnits = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+}
+
+// Rates are exchange rates from USD to other currencies, keyed by ISO 4217 code: how many units of the currency one USD buys
+type Rates map[string]*big.Rat
+
+// LoadRates reads the exchange rates from a json file such as {"EUR": "0.92", "JPY": "151.3"}.
+// Rates are decimal strings so they are exact, numbers are accepted too
+func LoadRates(path string) (Rates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.Number
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	rates := make(Rates, len(raw))
+	for code, v := range raw {
+		rate, ok := new(big.Rat).SetString(v.String())
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate %q for %s", v, code)
+		}
+		rates[strings.ToUpper(code)] = rate
+	}
+	return rates, nil
+}
+
+// Format returns the amount converted to the currency and rounded to its minor unit, e.g. "€4.51" or "742 JPY".
+// An empty code or USD formats the amount in USD. It fails with ErrUnknownCurrency if there is no rate for the currency
+func (r Rates) Format(m MicroUSD, code string) (string, error) {
+	code = strings.ToUpper(code)
+	if code == "" || code == codeUSD {
+		return m.Format(), nil
+	}
+	rate, ok := r[code]
+	if !ok {
+		return "", fmt.Errorf("%w %s", ErrUnknownCurrency, code)
+	}
+
+	digits, ok := minorUnits[code]
+	if !ok {
+		digits = 2
+	}
+	amount := new(big.Rat).Mul(new(big.Rat).SetFrac64(int64(m), conversionRate), rate)
+	neg := amount.Sign() < 0
+	amount.Abs(amount)
+	value := amount.FloatString(digits)
+	if neg && strings.Trim(value, "0.") != "" {
+		value = "-" + value
+	}
+	if symbol, ok := symbols[code]; ok {
+		if strings.HasPrefix(value, "-") {
+			return "-" + symbol + value[1:], nil
+		}
+		return symbol + value, nil
+	}
+	return value + " " + code, nil
+}
@@ -0,0 +1,422 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+const (
+	flushTimeout = 30 * time.Second
+	//maxPendingLedger bounds the ledger batch while the store is unreachable
+	maxPendingLedger = 10000
+)
+
+// flushStore is the store the aggregator flushes to, implemented by Store
+type flushStore interface {
+	GetSpending(ctx context.Context, key string) (*Spending, error)
+	GetPrincipalSpending(ctx context.Context, key string) (map[string]Usage, error)
+	AddSpending(ctx context.Context, keys []string, params *Spending) error
+	ReserveSpending(ctx context.Context, amount currency.MicroUSD, limits []Limit) (*Reservation, error)
+	SettleSpending(ctx context.Context, reservation *Reservation, params *Spending) error
+	MarkAlert(ctx context.Context, key string, threshold int) (bool, error)
+	addLedgerEntries(ctx context.Context, entries []*LedgerEntry) ([]*LedgerEntry, error)
+}
+
+// Aggregator keeps a local running view of the spending in front of the store.
+// Increments are batched in memory and flushed periodically and on Close. After every flush the keys used since the previous flush
+// are re-synced from the store, so replicas see each other's spending with a delay of about one flush interval.
+// Reservations are made in the store, so the quotas hold across replicas. A settled reservation stays held in the store
+// in place of the pending spending until the flush writes the spending and releases it in the same write
+type Aggregator struct {
+	store    flushStore
+	logger   *zap.SugaredLogger
+	interval time.Duration
+
+	//flushMu serializes flushes and the loads of keys missing from the view
+	flushMu sync.Mutex
+
+	mu      sync.Mutex
+	synced  map[string]Spending
+	used    map[string]bool
+	pending map[string]*Spending
+	//reserved is the change of the reservations of this replica since the key was synced,
+	//releases are the reservations of the settled requests the next flush releases
+	reserved map[string]currency.MicroUSD
+	releases map[string]currency.MicroUSD
+	ledger   []*LedgerEntry
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewAggregator creates new spending aggregator, loads the current daily spending and starts flushing every interval
+func NewAggregator(ctx context.Context, store *Store, logger *zap.SugaredLogger, interval time.Duration) (*Aggregator, error) {
+	return newAggregator(ctx, store, logger, interval)
+}
+
+func newAggregator(ctx context.Context, store flushStore, logger *zap.SugaredLogger, interval time.Duration) (*Aggregator, error) {
+	if interval <= 0 {
+		return nil, errors.New("flush interval must be positive")
+	}
+	a := &Aggregator{
+		store:    store,
+		logger:   logger,
+		interval: interval,
+		synced:   make(map[string]Spending),
+		used:     make(map[string]bool),
+		pending:  make(map[string]*Spending),
+		reserved: make(map[string]currency.MicroUSD),
+		releases: make(map[string]currency.MicroUSD),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if err := a.load(ctx, []string{today()}); err != nil {
+		logger.Errorw("failed to load spending into aggregator", "error", err)
+		return nil, err
+	}
+
+	go a.run()
+	logger.Infow("spending aggregator started", "flush_interval", interval)
+	return a, nil
+}
+
+// Close stops the periodic flush and flushes the pending spending
+func (a *Aggregator) Close() error {
+	a.logger.Infow("closing spending aggregator")
+	close(a.stop)
+	<-a.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := a.Flush(ctx); err != nil {
+		a.logger.Errorw("failed to flush spending on close", "error", err)
+		return err
+	}
+	a.logger.Debugw("spending aggregator closed")
+	return nil
+}
+
+// GetDailySpending returns the local view of the daily spending, including the local reservations
+func (a *Aggregator) GetDailySpending(ctx context.Context) (*Spending, error) {
+	return a.GetSpending(ctx, today())
+}
+
+// GetSpending returns the local view of the spending stored under the key, including the local reservations
+func (a *Aggregator) GetSpending(ctx context.Context, key string) (*Spending, error) {
+	if err := a.load(ctx, []string{key}); err != nil {
+		a.logger.Errorw("failed to load spending into aggregator", "error", err)
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sp := a.view(key)
+	return &sp, nil
+}
+
+// GetPrincipalSpending returns the usage of every principal stored under the daily UTC key plus the pending usage.
+// Principals aren't kept in the local view, they are read from the store every time
+func (a *Aggregator) GetPrincipalSpending(ctx context.Context, key string) (map[string]Usage, error) {
+	usages, err := a.store.GetPrincipalSpending(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if pending, ok := a.pending[key]; ok {
+		usages = addUsages(usages, pending.Principals)
+	}
+	return usages, nil
+}
+
+// AddDailySpending adds the spending to the pending daily batch
+func (a *Aggregator) AddDailySpending(ctx context.Context, params *Spending) error {
+	return a.AddSpending(ctx, []string{today()}, params)
+}
+
+// AddSpending adds the spending to the pending batches of the keys
+func (a *Aggregator) AddSpending(_ context.Context, keys []string, params *Spending) error {
+	if params == nil {
+		a.logger.Errorw("failed to add spending: nil params", "error", errors.New("params cannot be nil"))
+		return errors.New("params cannot be nil")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, key := range keys {
+		a.add(key, params)
+	}
+	return nil
+}
+
+// AddLedgerEntry adds the entry to the pending ledger batch
+func (a *Aggregator) AddLedgerEntry(_ context.Context, entry *LedgerEntry) error {
+	if entry == nil {
+		a.logger.Errorw("failed to add ledger entry: nil entry", "error", errors.New("entry cannot be nil"))
+		return errors.New("entry cannot be nil")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ledger = append(a.ledger, entry)
+	a.trimLedger()
+	return nil
+}
+
+// MarkAlert records the alert in the store right away, alerts are rare and must not fire twice
+func (a *Aggregator) MarkAlert(ctx context.Context, key string, threshold int) (bool, error) {
+	return a.store.MarkAlert(ctx, key, threshold)
+}
+
+// ReserveSpending holds amount against the quotas of all the limits in the store, so every replica sees the reservation.
+// It fails with a QuotaExceededError if any limit has no room for it
+func (a *Aggregator) ReserveSpending(ctx context.Context, amount currency.MicroUSD, limits []Limit) (*Reservation, error) {
+	keys := make([]string, len(limits))
+	for i, l := range limits {
+		keys[i] = l.Key
+	}
+	if err := a.load(ctx, keys); err != nil {
+		a.logger.Errorw("failed to load spending into aggregator", "error", err)
+		return nil, err
+	}
+
+	reservation, err := a.store.ReserveSpending(ctx, amount, limits)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, key := range keys {
+		a.reserved[key] += amount
+	}
+	return reservation, nil
+}
+
+// SettleSpending adds the actual spending to the pending batches. The reservation is released by the flush writing them
+func (a *Aggregator) SettleSpending(_ context.Context, reservation *Reservation, params *Spending) error {
+	if reservation == nil || params == nil {
+		a.logger.Errorw("failed to settle spending: nil params", "error", errors.New("params cannot be nil"))
+		return errors.New("params cannot be nil")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, key := range reservation.Keys {
+		a.releases[key] += reservation.Amount
+		a.add(key, params)
+	}
+	return nil
+}
+
+// Flush writes the pending spending to the store, releases the reservations of the settled requests and re-syncs the local view
+func (a *Aggregator) Flush(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "aggregator.Flush")
+	defer func() { tracing.End(span, err) }()
+
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	//Copy the batch. Pending spending stays counted in the view until it is written and re-synced
+	a.mu.Lock()
+	batch := make(map[string]*Spending, len(a.pending))
+	for key, sp := range a.pending {
+		cp := sp.Clone()
+		batch[key] = &cp
+	}
+	releases := make(map[string]currency.MicroUSD, len(a.releases))
+	for key, amount := range a.releases {
+		releases[key] = amount
+		if _, ok := batch[key]; !ok {
+			batch[key] = &Spending{}
+		}
+	}
+	used := a.used
+	a.used = make(map[string]bool)
+	ledger := a.ledger
+	a.ledger = nil
+	a.mu.Unlock()
+
+	var errs []error
+	failed, err := a.store.addLedgerEntries(ctx, ledger)
+	if err != nil {
+		//Keep the failed entries ahead of the ones added meanwhile and retry on the next flush
+		errs = append(errs, err)
+		a.mu.Lock()
+		a.ledger = append(failed, a.ledger...)
+		a.trimLedger()
+		a.mu.Unlock()
+	}
+	for key, sp := range batch {
+		if err := a.store.SettleSpending(ctx, &Reservation{Keys: []string{key}, Amount: releases[key]}, sp); err != nil {
+			//Keep the spending pending and retry on the next flush
+			errs = append(errs, err)
+			delete(batch, key)
+		}
+	}
+
+	//Keys that weren't used since the previous flush are dropped from the view and loaded again when needed.
+	//The reservations made before the reads are in the fresh spending
+	a.mu.Lock()
+	bases := make(map[string]currency.MicroUSD, len(used))
+	for key := range used {
+		bases[key] = a.reserved[key]
+	}
+	a.mu.Unlock()
+	fresh := make(map[string]Spending, len(used))
+	for key := range used {
+		sp, err := a.store.GetSpending(ctx, key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fresh[key] = *sp
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, sp := range batch {
+		if pending, ok := a.pending[key]; ok {
+			pending.Sub(sp)
+			if pending.IsZero() {
+				delete(a.pending, key)
+			}
+		}
+		a.releases[key] -= releases[key]
+		if a.releases[key] <= 0 {
+			delete(a.releases, key)
+		}
+		//Without a fresh read the written spending and the release move to the synced view
+		if _, ok := fresh[key]; !ok {
+			if synced, ok := a.synced[key]; ok {
+				synced.Add(withoutPrincipals(sp))
+				a.synced[key] = synced
+				a.unreserve(key, releases[key])
+			}
+		}
+	}
+	for key := range a.synced {
+		if !used[key] && !a.used[key] {
+			delete(a.synced, key)
+			delete(a.reserved, key)
+		}
+	}
+	for key, sp := range fresh {
+		a.synced[key] = sp
+		a.unreserve(key, bases[key])
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		a.logger.Errorw("failed to flush spending", "error", err)
+		return err
+	}
+	span.SetAttributes(attribute.Int("db.keys", len(batch)), attribute.Int("db.ledger_entries", len(ledger)))
+	a.logger.Debugw("spending flushed", "keys", len(batch), "synced", len(a.synced), "ledger_entries", len(ledger))
+	return nil
+}
+
+func (a *Aggregator) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			_ = a.Flush(ctx)
+			cancel()
+		}
+	}
+}
+
+// load marks the keys as used and reads the ones missing from the local view from the store.
+// A flush writing the pending spending of a key while it is read would leave it out of both the read and the view,
+// so missing keys are read between flushes
+func (a *Aggregator) load(ctx context.Context, keys []string) error {
+	if len(a.missing(keys)) == 0 {
+		return nil
+	}
+
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+	for _, key := range a.missing(keys) {
+		a.mu.Lock()
+		base := a.reserved[key]
+		a.mu.Unlock()
+		sp, err := a.store.GetSpending(ctx, key)
+		if err != nil {
+			return err
+		}
+		a.mu.Lock()
+		a.synced[key] = *sp
+		a.unreserve(key, base)
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// missing marks the keys as used and returns the ones missing from the local view
+func (a *Aggregator) missing(keys []string) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var missing []string
+	for _, key := range keys {
+		a.used[key] = true
+		if _, ok := a.synced[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// trimLedger drops the oldest pending ledger entries above maxPendingLedger. Must be called with mu held
+func (a *Aggregator) trimLedger() {
+	if dropped := len(a.ledger) - maxPendingLedger; dropped > 0 {
+		a.logger.Errorw("ledger batch full, dropping the oldest entries", "dropped", dropped)
+		a.ledger = a.ledger[dropped:]
+	}
+}
+
+// add adds the spending to the pending batch of the key. Must be called with mu held
+func (a *Aggregator) add(key string, params *Spending) {
+	sp, ok := a.pending[key]
+	if !ok {
+		sp = &Spending{}
+		a.pending[key] = sp
+	}
+	sp.Add(params)
+}
+
+// unreserve removes the reservations that became part of the synced spending of the key. Must be called with mu held
+func (a *Aggregator) unreserve(key string, amount currency.MicroUSD) {
+	a.reserved[key] -= amount
+	if a.reserved[key] == 0 {
+		delete(a.reserved, key)
+	}
+}
+
+// view returns the synced spending of the key plus the pending spending and the reservations made since the sync.
+// The reservations of settled requests are left out, their pending spending stands in for them until the flush.
+// The pending principals are left out like the store leaves them out of the spending docs. Must be called with mu held
+func (a *Aggregator) view(key string) Spending {
+	synced := a.synced[key]
+	sp := synced.Clone()
+	if pending, ok := a.pending[key]; ok {
+		sp.Add(withoutPrincipals(pending))
+	}
+	sp.Reserved += a.reserved[key] - a.releases[key]
+	return sp
+}
+
+// withoutPrincipals returns a shallow copy of the spending without its principals
+func withoutPrincipals(sp *Spending) *Spending {
+	cp := *sp
+	cp.Principals = nil
+	return &cp
+}
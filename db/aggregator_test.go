@@ -0,0 +1,295 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var errStore = errors.New("store unavailable")
+
+// memStore keeps the spending in memory like Store keeps it in firestore
+type memStore struct {
+	mu       sync.Mutex
+	spending map[string]Spending
+	//principals are kept apart from the spending like Store keeps them in docs of their own
+	principals map[string]map[string]Usage
+	ledger     []*LedgerEntry
+	//failAdds makes the next spending writes fail
+	failAdds int
+	//read is called by GetSpending after the spending is read and before it is returned,
+	//write by AddSpending before the spending is written
+	read  func(key string)
+	write func(key string)
+}
+
+func newMemStore() *memStore {
+	return &memStore{spending: make(map[string]Spending), principals: make(map[string]map[string]Usage)}
+}
+
+func (m *memStore) GetSpending(_ context.Context, key string) (*Spending, error) {
+	m.mu.Lock()
+	sp := m.spending[key]
+	sp = sp.Clone()
+	read := m.read
+	m.mu.Unlock()
+	if read != nil {
+		read(key)
+	}
+	return &sp, nil
+}
+
+func (m *memStore) AddSpending(ctx context.Context, keys []string, params *Spending) error {
+	return m.SettleSpending(ctx, &Reservation{Keys: keys}, params)
+}
+
+func (m *memStore) ReserveSpending(_ context.Context, amount currency.MicroUSD, limits []Limit) (*Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, len(limits))
+	for i, l := range limits {
+		keys[i] = l.Key
+		sp := m.spending[l.Key]
+		if l.Quota > 0 && sp.Amount+sp.Reserved+amount > l.Quota {
+			return nil, &QuotaExceededError{Key: l.Key}
+		}
+	}
+	for _, key := range keys {
+		sp := m.spending[key]
+		sp.Reserved += amount
+		m.spending[key] = sp
+	}
+	return &Reservation{Keys: keys, Amount: amount}, nil
+}
+
+func (m *memStore) SettleSpending(_ context.Context, reservation *Reservation, params *Spending) error {
+	keys := reservation.Keys
+	m.mu.Lock()
+	write := m.write
+	m.mu.Unlock()
+	if write != nil {
+		for _, key := range keys {
+			write(key)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failAdds > 0 {
+		m.failAdds--
+		return errStore
+	}
+	for _, key := range keys {
+		sp := m.spending[key]
+		sp.Add(withoutPrincipals(params))
+		sp.Reserved -= reservation.Amount
+		m.spending[key] = sp
+		m.principals[key] = addUsages(m.principals[key], params.Principals)
+	}
+	return nil
+}
+
+func (m *memStore) GetPrincipalSpending(_ context.Context, key string) (map[string]Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return addUsages(nil, m.principals[key]), nil
+}
+
+func (m *memStore) MarkAlert(context.Context, string, int) (bool, error) {
+	return true, nil
+}
+
+func (m *memStore) addLedgerEntries(_ context.Context, entries []*LedgerEntry) ([]*LedgerEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ledger = append(m.ledger, entries...)
+	return nil, nil
+}
+
+func (m *memStore) amount(key string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(m.spending[key].Amount)
+}
+
+func (m *memStore) reserved(key string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(m.spending[key].Reserved)
+}
+
+// newTestAggregator creates an aggregator that is only flushed by the test
+func newTestAggregator(t *testing.T, store flushStore) *Aggregator {
+	t.Helper()
+	a, err := newAggregator(context.Background(), store, zap.NewNop().Sugar(), time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = a.Close() })
+	return a
+}
+
+func TestAggregator_FlushAndResync(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	store.spending["k"] = Spending{Amount: 100}
+	a := newTestAggregator(t, store)
+
+	require.NoError(t, a.AddSpending(ctx, []string{"k"}, &Spending{Amount: 10, Requests: 1}))
+	sp, err := a.GetSpending(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, int64(110), int64(sp.Amount))
+	assert.Equal(t, int64(100), store.amount("k"))
+
+	//Another replica's spending shows up after the flush re-syncs the key
+	store.mu.Lock()
+	other := store.spending["k"]
+	other.Amount += 5
+	store.spending["k"] = other
+	store.mu.Unlock()
+
+	require.NoError(t, a.Flush(ctx))
+	assert.Equal(t, int64(115), store.amount("k"))
+	sp, err = a.GetSpending(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, int64(115), int64(sp.Amount))
+}
+
+func TestAggregator_FlushFailure(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	a := newTestAggregator(t, store)
+
+	//Spending that fails to be written stays pending and counted until the next flush writes it
+	require.NoError(t, a.AddSpending(ctx, []string{"k"}, &Spending{Amount: 10}))
+	store.failAdds = 1
+	assert.ErrorIs(t, a.Flush(ctx), errStore)
+	sp, err := a.GetSpending(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), int64(sp.Amount))
+
+	require.NoError(t, a.Flush(ctx))
+	assert.Equal(t, int64(10), store.amount("k"))
+	sp, err = a.GetSpending(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), int64(sp.Amount))
+}
+
+func TestAggregator_ReserveAndSettle(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	a := newTestAggregator(t, store)
+
+	reservation, err := a.ReserveSpending(ctx, 60, []Limit{{Key: "k", Quota: 100}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), store.reserved("k"))
+	sp, err := a.GetSpending(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), int64(sp.Reserved))
+
+	//Reservations are made in the store, so another replica has no room either
+	other := newTestAggregator(t, store)
+	for _, replica := range []*Aggregator{a, other} {
+		_, err = replica.ReserveSpending(ctx, 60, []Limit{{Key: "k", Quota: 100}})
+		var quotaErr *QuotaExceededError
+		require.ErrorAs(t, err, &quotaErr)
+		assert.Equal(t, "k", quotaErr.Key)
+	}
+
+	//The settled reservation is held in the store until the flush writes the spending
+	require.NoError(t, a.SettleSpending(ctx, reservation, &Spending{Amount: 20}))
+	sp, err = a.GetSpending(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), int64(sp.Amount))
+	assert.Zero(t, sp.Reserved)
+	assert.Equal(t, int64(60), store.reserved("k"))
+
+	require.NoError(t, a.Flush(ctx))
+	assert.Equal(t, int64(20), store.amount("k"))
+	assert.Zero(t, store.reserved("k"))
+	sp, err = a.GetSpending(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), int64(sp.Amount))
+	assert.Zero(t, sp.Reserved)
+	_, err = other.ReserveSpending(ctx, 60, []Limit{{Key: "k", Quota: 100}})
+	require.NoError(t, err)
+}
+
+func TestAggregator_LoadDuringFlush(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	a := newTestAggregator(t, store)
+
+	//The key isn't in the view when its pending spending is flushed
+	require.NoError(t, a.AddSpending(ctx, []string{"k"}, &Spending{Amount: 10}))
+
+	//Hold the write of the flush, and the read of the key until the flush is done
+	writing, releaseWrite := make(chan struct{}), make(chan struct{})
+	reading, releaseRead := make(chan struct{}), make(chan struct{})
+	var writeOnce, readOnce sync.Once
+	store.write = func(key string) {
+		if key == "k" {
+			writeOnce.Do(func() {
+				close(writing)
+				<-releaseWrite
+			})
+		}
+	}
+	store.read = func(key string) {
+		if key == "k" {
+			readOnce.Do(func() {
+				close(reading)
+				<-releaseRead
+			})
+		}
+	}
+
+	flushed := make(chan error)
+	go func() { flushed <- a.Flush(ctx) }()
+	<-writing
+	loaded := make(chan error)
+	go func() {
+		_, err := a.GetSpending(ctx, "k")
+		loaded <- err
+	}()
+	//The read must not miss the spending the flush is writing
+	select {
+	case <-reading:
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(releaseWrite)
+	require.NoError(t, <-flushed)
+	close(releaseRead)
+	require.NoError(t, <-loaded)
+
+	assert.Equal(t, int64(10), store.amount("k"))
+	sp, err := a.GetSpending(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), int64(sp.Amount))
+}
+
+func TestAggregator_PrincipalSpending(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	a := newTestAggregator(t, store)
+
+	//Pending principals are reported apart from the spending before and after the flush
+	require.NoError(t, a.AddSpending(ctx, []string{"k"}, &Spending{Amount: 10, Principals: map[string]Usage{"api_key:app": {Amount: 10, Requests: 1}}}))
+	for _, flush := range []bool{false, true} {
+		if flush {
+			require.NoError(t, a.Flush(ctx))
+		}
+		sp, err := a.GetSpending(ctx, "k")
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), int64(sp.Amount))
+		assert.Empty(t, sp.Principals)
+		principals, err := a.GetPrincipalSpending(ctx, "k")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]Usage{"api_key:app": {Amount: 10, Requests: 1}}, principals)
+	}
+	assert.Empty(t, store.spending["k"].Principals)
+}
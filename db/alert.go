@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const collectionAlerts = "alerts"
+
+// MarkAlert records that the alert for the threshold of the spending key fired.
+// It returns false if it was already recorded, so every alert fires once across replicas
+func (s *Store) MarkAlert(ctx context.Context, key string, threshold int) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "MarkAlert", attribute.String("db.spending_key", key), attribute.Int("db.threshold_percent", threshold))
+	defer func() { endSpan(span, err) }()
+
+	doc := s.db.Collection(collectionAlerts).Doc(fmt.Sprintf("%s_%d", key, threshold))
+	_, err = doc.Create(ctx, map[string]any{"key": key, "threshold_percent": threshold, "time": time.Now()})
+	if status.Code(err) == codes.AlreadyExists {
+		s.logger.Debugw("alert already fired", "key", key, "threshold", threshold)
+		return false, nil
+	}
+	if err != nil {
+		s.logger.Errorw("failed to mark alert", "key", key, "threshold", threshold, "error", err)
+		return false, err
+	}
+	s.logger.Debugw("alert marked", "key", key, "threshold", threshold)
+	return true, nil
+}
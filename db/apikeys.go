@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/dafraer/sentence-gen-grpc-server/auth"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	collectionAPIKeys = "api_keys"
+	nameKey           = "name"
+	revokedKey        = "revoked"
+	revokedAtKey      = "revoked_at"
+)
+
+// GetKey gets the api key with the given hash from the firestore
+func (s *Store) GetKey(ctx context.Context, hash string) (_ *auth.APIKey, err error) {
+	ctx, span := startSpan(ctx, "GetKey")
+	defer func() { endSpan(span, err) }()
+
+	docSnap, err := s.db.Collection(collectionAPIKeys).Doc(hash).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, auth.ErrKeyNotFound
+		}
+		s.logger.Errorw("failed to fetch api key", "error", err)
+		return nil, err
+	}
+
+	var key auth.APIKey
+	if err := docSnap.DataTo(&key); err != nil {
+		s.logger.Errorw("failed to decode api key", "error", err)
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListKeys lists all the api keys stored in the firestore
+func (s *Store) ListKeys(ctx context.Context) (_ []*auth.APIKey, err error) {
+	ctx, span := startSpan(ctx, "ListKeys")
+	defer func() { endSpan(span, err) }()
+
+	iter := s.db.Collection(collectionAPIKeys).OrderBy(nameKey, firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	var keys []*auth.APIKey
+	for {
+		docSnap, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			s.logger.Errorw("failed to list api keys", "error", err)
+			return nil, err
+		}
+		var key auth.APIKey
+		if err := docSnap.DataTo(&key); err != nil {
+			s.logger.Errorw("failed to decode api key", "error", err)
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	return keys, nil
+}
+
+// SaveKey stores a new api key in the firestore. Key names must be unique
+func (s *Store) SaveKey(ctx context.Context, key *auth.APIKey) (err error) {
+	ctx, span := startSpan(ctx, "SaveKey")
+	defer func() { endSpan(span, err) }()
+
+	if key == nil {
+		s.logger.Errorw("failed to save api key: nil key", "error", errors.New("key cannot be nil"))
+		return errors.New("key cannot be nil")
+	}
+
+	err = s.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		//Check that the name is not taken
+		docs, err := tx.Documents(s.db.Collection(collectionAPIKeys).Where(nameKey, "==", key.Name).Limit(1)).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(docs) > 0 {
+			return auth.ErrKeyExists
+		}
+		return tx.Create(s.db.Collection(collectionAPIKeys).Doc(key.Hash), key)
+	})
+	if err != nil {
+		if errors.Is(err, auth.ErrKeyExists) || status.Code(err) == codes.AlreadyExists {
+			return auth.ErrKeyExists
+		}
+		s.logger.Errorw("failed to save api key", "error", err)
+		return err
+	}
+	s.logger.Debugw("api key saved", "name", key.Name)
+	return nil
+}
+
+// RevokeKey marks the api key with the given name as revoked
+func (s *Store) RevokeKey(ctx context.Context, name string) (err error) {
+	ctx, span := startSpan(ctx, "RevokeKey")
+	defer func() { endSpan(span, err) }()
+
+	docs, err := s.db.Collection(collectionAPIKeys).Where(nameKey, "==", name).Documents(ctx).GetAll()
+	if err != nil {
+		s.logger.Errorw("failed to find api key", "error", err)
+		return err
+	}
+	if len(docs) == 0 {
+		return auth.ErrKeyNotFound
+	}
+
+	for _, doc := range docs {
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{
+			{Path: revokedKey, Value: true},
+			{Path: revokedAtKey, Value: time.Now().UTC()},
+		}); err != nil {
+			s.logger.Errorw("failed to revoke api key", "error", err)
+			return err
+		}
+	}
+	s.logger.Debugw("api key revoked", "name", name)
+	return nil
+}
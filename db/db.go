@@ -2,42 +2,107 @@ package db
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"math/rand/v2"
+	"strconv"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
 	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 const (
-	collectionSpending    = "spending"
-	amountKey             = "amount_micro_usd"
-	chirp3HDCharsKey      = "chirp3hd_characters"
-	standardVoiceCharsKey = "standard_voice_characters"
-	geminiInputTokensKey  = "gemini_input_tokens"
-	geminiOutputTokensKey = "gemini_output_tokens"
+	collectionSpending      = "spending"
+	collectionShards        = "shards"
+	collectionPrincipals    = "principals"
+	amountKey               = "amount_micro_usd"
+	chirp3HDCharsKey        = "chirp3hd_characters"
+	standardVoiceCharsKey   = "standard_voice_characters"
+	geminiInputTokensKey    = "gemini_input_tokens"
+	geminiOutputTokensKey   = "gemini_output_tokens"
+	geminiCachedTokensKey   = "gemini_cached_tokens"
+	geminiToolUseTokensKey  = "gemini_tool_use_tokens"
+	geminiThinkingTokensKey = "gemini_thinking_tokens"
+	reservedKey             = "reserved_micro_usd"
+	requestsKey             = "requests"
+	charactersKey           = "characters"
+	operationsKey           = "operations"
+	modelsKey               = "models"
+	voicesKey               = "voices"
+	principalKey            = "principal"
+	dayLayout               = "2006-01-02"
 )
 
+var (
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// QuotaExceededError reports the spending key whose quota has no room left. It matches ErrQuotaExceeded
+type QuotaExceededError struct {
+	Key string
+}
+
 type Store struct {
 	db     *firestore.Client
 	logger *zap.SugaredLogger
+	shards int
 }
 
+// Spending is the spending stored under a key. The breakdowns by operation, gemini model and tts voice tier
+// are kept in the daily UTC docs only. The usage of every principal is kept in a doc of its own under the daily UTC doc,
+// so the spending docs don't grow with every new principal. Principals are read with GetPrincipalSpending
 type Spending struct {
 	Amount                  currency.MicroUSD `firestore:"amount_micro_usd"`
+	Requests                int64             `firestore:"requests"`
 	Chirp3HDCharacters      int64             `firestore:"chirp3hd_characters"`
 	StandardVoiceCharacters int64             `firestore:"standard_voice_characters"`
 	GeminiInputTokens       int64             `firestore:"gemini_input_tokens"`
 	GeminiOutputTokens      int64             `firestore:"gemini_output_tokens"`
+	GeminiCachedTokens      int64             `firestore:"gemini_cached_tokens"`
+	GeminiToolUseTokens     int64             `firestore:"gemini_tool_use_tokens"`
+	GeminiThinkingTokens    int64             `firestore:"gemini_thinking_tokens"`
+	Reserved                currency.MicroUSD `firestore:"reserved_micro_usd"`
+	Operations              map[string]Usage  `firestore:"operations,omitempty"`
+	Models                  map[string]Usage  `firestore:"models,omitempty"`
+	Voices                  map[string]Usage  `firestore:"voices,omitempty"`
+	//Principals were kept in the daily UTC docs before they got docs of their own and are still read from the old docs
+	Principals map[string]Usage `firestore:"principals,omitempty"`
+}
+
+// Usage is the part of the spending attributed to one operation, model, voice tier or principal
+type Usage struct {
+	Amount         currency.MicroUSD `firestore:"amount_micro_usd"`
+	Requests       int64             `firestore:"requests"`
+	InputTokens    int64             `firestore:"gemini_input_tokens"`
+	OutputTokens   int64             `firestore:"gemini_output_tokens"`
+	CachedTokens   int64             `firestore:"gemini_cached_tokens"`
+	ToolUseTokens  int64             `firestore:"gemini_tool_use_tokens"`
+	ThinkingTokens int64             `firestore:"gemini_thinking_tokens"`
+	Characters     int64             `firestore:"characters"`
+}
+
+// Limit caps the spending stored under the key. A zero quota records the spending without limiting it
+type Limit struct {
+	Key   string
+	Quota currency.MicroUSD
 }
 
-// New creates new firestore instance
-func New(ctx context.Context, logger *zap.SugaredLogger, projectID string) (*Store, error) {
-	logger.Infow("initializing firestore client", "project_id", projectID)
+// Reservation is an amount held against the quotas of the keys until the request that reserved it is settled
+type Reservation struct {
+	Keys   []string
+	Amount currency.MicroUSD
+}
+
+// New creates new firestore instance.
+// Spending increments are spread over the given number of shard docs per day, one or less writes to the day doc itself
+func New(ctx context.Context, logger *zap.SugaredLogger, projectID string, shards int) (*Store, error) {
+	logger.Infow("initializing firestore client", "project_id", projectID, "spending_shards", shards)
 	conf := &firebase.Config{ProjectID: projectID}
 	app, err := firebase.NewApp(ctx, conf)
 	if err != nil {
@@ -51,7 +116,7 @@ func New(ctx context.Context, logger *zap.SugaredLogger, projectID string) (*Sto
 		return nil, err
 	}
 	logger.Infow("firestore client initialized")
-	return &Store{db: client, logger: logger}, nil
+	return &Store{db: client, logger: logger, shards: shards}, nil
 }
 
 // Close closes connection to Firestore
@@ -67,60 +132,416 @@ func (s *Store) Close() error {
 
 // GetDailySpending get daily spending from the firestore
 func (s *Store) GetDailySpending(ctx context.Context) (*Spending, error) {
-	//Identify current day in UTC time zone
-	day := time.Now().In(time.UTC).Format("2006-01-02")
+	return s.GetSpending(ctx, today())
+}
 
-	s.logger.Debugw("fetching daily spending", "day", day)
+// GetSpending gets the spending stored under the key, summed over the spending doc and its shards
+func (s *Store) GetSpending(ctx context.Context, key string) (_ *Spending, err error) {
+	ctx, span := startSpan(ctx, "GetSpending", attribute.String("db.spending_key", key))
+	defer func() { endSpan(span, err) }()
 
-	//Get daily spending doc
-	docSnap, err := s.db.Collection(collectionSpending).Doc(day).Get(ctx)
-	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			s.logger.Debugw("daily spending not found, returning zero spending", "day", day)
-			return &Spending{}, nil
-		}
-		s.logger.Errorw("failed to fetch daily spending", "error", err)
+	s.logger.Debugw("fetching spending", "key", key)
+
+	//Keys written before sharding have everything in the spending doc
+	var sp Spending
+	docSnap, err := s.db.Collection(collectionSpending).Doc(key).Get(ctx)
+	if err := addSnapshot(&sp, docSnap, err); err != nil {
+		s.logger.Errorw("failed to fetch spending", "error", err)
 		return nil, err
 	}
 
-	//Parse daily spending doc
-	var sp Spending
-	if err := docSnap.DataTo(&sp); err != nil {
-		s.logger.Errorw("failed to decode daily spending", "error", err)
+	shardSnaps, err := s.shardsOf(key).Documents(ctx).GetAll()
+	if err != nil {
+		s.logger.Errorw("failed to fetch spending shards", "error", err)
 		return nil, err
 	}
-	s.logger.Debugw("fetched daily spending", "day", day, "amount", sp.Amount)
+	for _, snap := range shardSnaps {
+		if err := addSnapshot(&sp, snap, nil); err != nil {
+			s.logger.Errorw("failed to decode spending shard", "error", err)
+			return nil, err
+		}
+	}
+	s.logger.Debugw("fetched spending", "key", key, "amount", sp.Amount, "shards", len(shardSnaps))
 	return &sp, nil
 }
 
 // AddDailySpending increments all the fields in the daily spending doc
 func (s *Store) AddDailySpending(ctx context.Context, params *Spending) error {
+	return s.AddSpending(ctx, []string{today()}, params)
+}
+
+// AddSpending increments all the fields in the spending docs of the keys
+func (s *Store) AddSpending(ctx context.Context, keys []string, params *Spending) (err error) {
+	ctx, span := startSpan(ctx, "AddSpending", attribute.StringSlice("db.spending_keys", keys))
+	defer func() { endSpan(span, err) }()
+
 	if params == nil {
-		s.logger.Errorw("failed to add daily spending: nil params", "error", errors.New("params cannot be nil"))
+		s.logger.Errorw("failed to add spending: nil params", "error", errors.New("params cannot be nil"))
 		return errors.New("params cannot be nil")
 	}
+	s.logger.Debugw("adding spending", "keys", keys, "amount", params.Amount, "chirp3hd_characters", params.Chirp3HDCharacters, "standard_characters", params.StandardVoiceCharacters, "gemini_input_tokens", params.GeminiInputTokens, "gemini_cached_tokens", params.GeminiCachedTokens, "gemini_tool_use_tokens", params.GeminiToolUseTokens, "gemini_output_tokens", params.GeminiOutputTokens, "gemini_thinking_tokens", params.GeminiThinkingTokens)
 
-	//Identify current day in UTC time zone
-	day := time.Now().In(time.UTC).Format("2006-01-02")
+	//Increment spending
+	if err := s.increment(ctx, keys, params, 0); err != nil {
+		s.logger.Errorw("failed to add spending", "error", err)
+		return err
+	}
+	s.logger.Debugw("spending added", "keys", keys)
 
-	//Select daily spending doc
-	doc := s.db.Collection(collectionSpending).Doc(day)
-	s.logger.Debugw("adding daily spending", "day", day, "amount", params.Amount, "chirp3hd_characters", params.Chirp3HDCharacters, "standard_characters", params.StandardVoiceCharacters, "gemini_input_tokens", params.GeminiInputTokens, "gemini_output_tokens", params.GeminiOutputTokens)
+	return nil
+}
+
+// ReserveSpending atomically holds amount against the quotas of all the limits.
+// It fails with a QuotaExceededError if the spent and already reserved amounts of any limit leave no room for it
+func (s *Store) ReserveSpending(ctx context.Context, amount currency.MicroUSD, limits []Limit) (_ *Reservation, err error) {
+	ctx, span := startSpan(ctx, "ReserveSpending", attribute.Int64("db.amount_micro_usd", int64(amount)))
+	defer func() { endSpan(span, err) }()
+
+	keys := make([]string, len(limits))
+	for i, l := range limits {
+		keys[i] = l.Key
+	}
+	s.logger.Debugw("reserving spending", "keys", keys, "amount", amount)
 
-	//Increment daily spending
-	_, err := doc.Set(ctx, map[string]interface{}{
-		amountKey:             firestore.Increment(int64(params.Amount)),
-		chirp3HDCharsKey:      firestore.Increment(params.Chirp3HDCharacters),
-		standardVoiceCharsKey: firestore.Increment(params.StandardVoiceCharacters),
-		geminiInputTokensKey:  firestore.Increment(params.GeminiInputTokens),
-		geminiOutputTokensKey: firestore.Increment(params.GeminiOutputTokens),
-	}, firestore.MergeAll)
+	err = s.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		//The whole key has to be read to check the quota, so reservations still serialize per key
+		spent := make([]Spending, len(limits))
+		for i, l := range limits {
+			if l.Quota <= 0 {
+				continue
+			}
+			docSnap, err := tx.Get(s.db.Collection(collectionSpending).Doc(l.Key))
+			if err := addSnapshot(&spent[i], docSnap, err); err != nil {
+				return err
+			}
+			shardSnaps, err := tx.Documents(s.shardsOf(l.Key)).GetAll()
+			if err != nil {
+				return err
+			}
+			for _, snap := range shardSnaps {
+				if err := addSnapshot(&spent[i], snap, nil); err != nil {
+					return err
+				}
+			}
+		}
 
+		for i, l := range limits {
+			if l.Quota > 0 && spent[i].Amount+spent[i].Reserved+amount > l.Quota {
+				return &QuotaExceededError{Key: l.Key}
+			}
+		}
+		for _, l := range limits {
+			if err := tx.Set(s.spendingDoc(l.Key), map[string]interface{}{
+				reservedKey: firestore.Increment(int64(amount)),
+			}, firestore.MergeAll); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrQuotaExceeded) {
+		s.logger.Infow("spending reservation rejected", "amount", amount, "error", err)
+		return nil, err
+	}
 	if err != nil {
-		s.logger.Errorw("failed to add daily spending", "error", err)
+		s.logger.Errorw("failed to reserve spending", "error", err)
+		return nil, err
+	}
+	s.logger.Debugw("spending reserved", "keys", keys, "amount", amount)
+	return &Reservation{Keys: keys, Amount: amount}, nil
+}
+
+// SettleSpending releases the reservation and adds the actual spending in a single write.
+// The spending is recorded under the keys of the reservation
+func (s *Store) SettleSpending(ctx context.Context, reservation *Reservation, params *Spending) (err error) {
+	ctx, span := startSpan(ctx, "SettleSpending")
+	defer func() { endSpan(span, err) }()
+
+	if reservation == nil || params == nil {
+		s.logger.Errorw("failed to settle spending: nil params", "error", errors.New("params cannot be nil"))
+		return errors.New("params cannot be nil")
+	}
+	s.logger.Debugw("settling spending", "keys", reservation.Keys, "reserved", reservation.Amount, "amount", params.Amount)
+
+	if err := s.increment(ctx, reservation.Keys, params, reservation.Amount); err != nil {
+		s.logger.Errorw("failed to settle spending", "error", err)
 		return err
 	}
-	s.logger.Debugw("daily spending added", "day", day)
+	s.logger.Debugw("spending settled", "keys", reservation.Keys)
+	return nil
+}
+
+// increment adds the spending to the docs of all the keys and the docs of its principals at once and releases the reserved amount
+func (s *Store) increment(ctx context.Context, keys []string, params *Spending, release currency.MicroUSD) error {
+	type write struct {
+		doc    *firestore.DocumentRef
+		fields map[string]interface{}
+	}
+	var writes []write
+	for _, key := range keys {
+		fields := increments(params, isDayKey(key))
+		if release != 0 {
+			fields[reservedKey] = firestore.Increment(-int64(release))
+		}
+		writes = append(writes, write{doc: s.spendingDoc(key), fields: fields})
+		if !isDayKey(key) {
+			continue
+		}
+		for principal, u := range params.Principals {
+			fields := usageFields(u)
+			fields[principalKey] = principal
+			writes = append(writes, write{doc: s.principalDoc(key, principal), fields: fields})
+		}
+	}
+
+	if len(writes) == 1 {
+		_, err := writes[0].doc.Set(ctx, writes[0].fields, firestore.MergeAll)
+		return err
+	}
+	return s.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		for _, w := range writes {
+			if err := tx.Set(w.doc, w.fields, firestore.MergeAll); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetPrincipalSpending returns the usage of every principal stored under the daily UTC key
+func (s *Store) GetPrincipalSpending(ctx context.Context, key string) (_ map[string]Usage, err error) {
+	ctx, span := startSpan(ctx, "GetPrincipalSpending", attribute.String("db.spending_key", key))
+	defer func() { endSpan(span, err) }()
+
+	snaps, err := s.db.Collection(collectionSpending).Doc(key).Collection(collectionPrincipals).Documents(ctx).GetAll()
+	if err != nil {
+		s.logger.Errorw("failed to fetch principal spending", "key", key, "error", err)
+		return nil, err
+	}
+	usages := make(map[string]Usage, len(snaps))
+	for _, snap := range snaps {
+		var u Usage
+		if err := snap.DataTo(&u); err != nil {
+			s.logger.Errorw("failed to decode principal spending", "key", key, "error", err)
+			return nil, err
+		}
+		principal, err := snap.DataAt(principalKey)
+		if err != nil {
+			s.logger.Errorw("failed to decode principal spending", "key", key, "error", err)
+			return nil, err
+		}
+		name, _ := principal.(string)
+		usages = addUsages(usages, map[string]Usage{name: u})
+	}
+	s.logger.Debugw("fetched principal spending", "key", key, "principals", len(usages))
+	return usages, nil
+}
+
+// Add adds the other spending to s
+func (s *Spending) Add(other *Spending) {
+	s.Amount += other.Amount
+	s.Chirp3HDCharacters += other.Chirp3HDCharacters
+	s.StandardVoiceCharacters += other.StandardVoiceCharacters
+	s.GeminiInputTokens += other.GeminiInputTokens
+	s.GeminiOutputTokens += other.GeminiOutputTokens
+	s.GeminiCachedTokens += other.GeminiCachedTokens
+	s.GeminiToolUseTokens += other.GeminiToolUseTokens
+	s.GeminiThinkingTokens += other.GeminiThinkingTokens
+	s.Reserved += other.Reserved
+	s.Requests += other.Requests
+	s.Operations = addUsages(s.Operations, other.Operations)
+	s.Models = addUsages(s.Models, other.Models)
+	s.Voices = addUsages(s.Voices, other.Voices)
+	s.Principals = addUsages(s.Principals, other.Principals)
+}
+
+// Sub subtracts the other spending from s
+func (s *Spending) Sub(other *Spending) {
+	s.Amount -= other.Amount
+	s.Chirp3HDCharacters -= other.Chirp3HDCharacters
+	s.StandardVoiceCharacters -= other.StandardVoiceCharacters
+	s.GeminiInputTokens -= other.GeminiInputTokens
+	s.GeminiOutputTokens -= other.GeminiOutputTokens
+	s.GeminiCachedTokens -= other.GeminiCachedTokens
+	s.GeminiToolUseTokens -= other.GeminiToolUseTokens
+	s.GeminiThinkingTokens -= other.GeminiThinkingTokens
+	s.Reserved -= other.Reserved
+	s.Requests -= other.Requests
+	subUsages(s.Operations, other.Operations)
+	subUsages(s.Models, other.Models)
+	subUsages(s.Voices, other.Voices)
+	subUsages(s.Principals, other.Principals)
+}
+
+// Clone returns a copy of the spending that doesn't share the breakdowns
+func (s *Spending) Clone() Spending {
+	cp := *s
+	cp.Operations = addUsages(nil, s.Operations)
+	cp.Models = addUsages(nil, s.Models)
+	cp.Voices = addUsages(nil, s.Voices)
+	cp.Principals = addUsages(nil, s.Principals)
+	return cp
+}
+
+// IsZero reports whether the spending is empty
+func (s *Spending) IsZero() bool {
+	return s.Amount == 0 && s.Requests == 0 && s.Reserved == 0 &&
+		s.Chirp3HDCharacters == 0 && s.StandardVoiceCharacters == 0 &&
+		s.GeminiInputTokens == 0 && s.GeminiOutputTokens == 0 && s.GeminiCachedTokens == 0 && s.GeminiToolUseTokens == 0 && s.GeminiThinkingTokens == 0 &&
+		len(s.Operations) == 0 && len(s.Models) == 0 && len(s.Voices) == 0 && len(s.Principals) == 0
+}
+
+// addUsages adds the usages in other to dst, allocating dst if needed
+func addUsages(dst, other map[string]Usage) map[string]Usage {
+	if len(other) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]Usage, len(other))
+	}
+	for name, u := range other {
+		cur := dst[name]
+		cur.Amount += u.Amount
+		cur.Requests += u.Requests
+		cur.InputTokens += u.InputTokens
+		cur.OutputTokens += u.OutputTokens
+		cur.CachedTokens += u.CachedTokens
+		cur.ToolUseTokens += u.ToolUseTokens
+		cur.ThinkingTokens += u.ThinkingTokens
+		cur.Characters += u.Characters
+		dst[name] = cur
+	}
+	return dst
+}
+
+// subUsages subtracts the usages in other from dst and drops the ones that become empty
+func subUsages(dst, other map[string]Usage) {
+	for name, u := range other {
+		cur := dst[name]
+		cur.Amount -= u.Amount
+		cur.Requests -= u.Requests
+		cur.InputTokens -= u.InputTokens
+		cur.OutputTokens -= u.OutputTokens
+		cur.CachedTokens -= u.CachedTokens
+		cur.ToolUseTokens -= u.ToolUseTokens
+		cur.ThinkingTokens -= u.ThinkingTokens
+		cur.Characters -= u.Characters
+		if cur == (Usage{}) {
+			delete(dst, name)
+		} else {
+			dst[name] = cur
+		}
+	}
+}
+
+func (e *QuotaExceededError) Error() string {
+	return "quota exceeded: " + e.Key
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// spendingDoc picks the doc that spending increments of the key go to: a random shard, or the spending doc when sharding is off
+func (s *Store) spendingDoc(key string) *firestore.DocumentRef {
+	if s.shards <= 1 {
+		return s.db.Collection(collectionSpending).Doc(key)
+	}
+	return s.shardsOf(key).Doc(strconv.Itoa(rand.IntN(s.shards)))
+}
+
+// principalDoc returns the doc of the usage of the principal under the daily UTC key
+func (s *Store) principalDoc(key, principal string) *firestore.DocumentRef {
+	//Doc ids can't contain slashes, the principal is encoded in the id and stored in the doc
+	return s.db.Collection(collectionSpending).Doc(key).Collection(collectionPrincipals).Doc(base64.RawURLEncoding.EncodeToString([]byte(principal)))
+}
+
+// shardsOf returns the shard collection of the key
+func (s *Store) shardsOf(key string) *firestore.CollectionRef {
+	return s.db.Collection(collectionSpending).Doc(key).Collection(collectionShards)
+}
 
+// addSnapshot decodes the spending doc snapshot and adds it to sp. A missing doc adds nothing
+func addSnapshot(sp *Spending, snap *firestore.DocumentSnapshot, err error) error {
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var doc Spending
+	if err := snap.DataTo(&doc); err != nil {
+		return err
+	}
+	sp.Add(&doc)
 	return nil
 }
+
+// today identifies current day in UTC time zone, the key of the daily UTC budget window
+func today() string {
+	return DayKey(time.Now())
+}
+
+// DayKey returns the key of the daily UTC spending doc of the day t falls into
+func DayKey(t time.Time) string {
+	return t.In(time.UTC).Format(dayLayout)
+}
+
+// isDayKey reports whether the key is the key of a daily UTC spending doc
+func isDayKey(key string) bool {
+	_, err := time.Parse(dayLayout, key)
+	return err == nil
+}
+
+// increments returns the field increments that add the spending to a spending doc, with or without the breakdowns.
+// Principals are left out, they are added to docs of their own
+func increments(params *Spending, breakdowns bool) map[string]interface{} {
+	fields := map[string]interface{}{
+		amountKey:               firestore.Increment(int64(params.Amount)),
+		chirp3HDCharsKey:        firestore.Increment(params.Chirp3HDCharacters),
+		standardVoiceCharsKey:   firestore.Increment(params.StandardVoiceCharacters),
+		geminiInputTokensKey:    firestore.Increment(params.GeminiInputTokens),
+		geminiOutputTokensKey:   firestore.Increment(params.GeminiOutputTokens),
+		geminiCachedTokensKey:   firestore.Increment(params.GeminiCachedTokens),
+		geminiToolUseTokensKey:  firestore.Increment(params.GeminiToolUseTokens),
+		geminiThinkingTokensKey: firestore.Increment(params.GeminiThinkingTokens),
+		requestsKey:             firestore.Increment(params.Requests),
+	}
+	if !breakdowns {
+		return fields
+	}
+	//An empty map would replace the stored breakdown, so only non-empty ones are merged
+	for key, usages := range map[string]map[string]Usage{
+		operationsKey: params.Operations,
+		modelsKey:     params.Models,
+		voicesKey:     params.Voices,
+	} {
+		if len(usages) > 0 {
+			fields[key] = usageIncrements(usages)
+		}
+	}
+	return fields
+}
+
+// usageIncrements returns the nested field increments that add the usages to a breakdown
+func usageIncrements(usages map[string]Usage) map[string]interface{} {
+	fields := make(map[string]interface{}, len(usages))
+	for name, u := range usages {
+		fields[name] = usageFields(u)
+	}
+	return fields
+}
+
+// usageFields returns the field increments that add the usage
+func usageFields(u Usage) map[string]interface{} {
+	return map[string]interface{}{
+		amountKey:               firestore.Increment(int64(u.Amount)),
+		requestsKey:             firestore.Increment(u.Requests),
+		geminiInputTokensKey:    firestore.Increment(u.InputTokens),
+		geminiOutputTokensKey:   firestore.Increment(u.OutputTokens),
+		geminiCachedTokensKey:   firestore.Increment(u.CachedTokens),
+		geminiToolUseTokensKey:  firestore.Increment(u.ToolUseTokens),
+		geminiThinkingTokensKey: firestore.Increment(u.ThinkingTokens),
+		charactersKey:           firestore.Increment(u.Characters),
+	}
+}
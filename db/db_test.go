@@ -2,37 +2,36 @@ package db
 
 import (
 	"context"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
-func initDB() (*Store, error) {
-	logger, err := zap.NewDevelopment()
-	if err != nil {
-		return nil, err
+// initDB connects to the firestore emulator, the test is skipped if FIRESTORE_EMULATOR_HOST isn't set
+func initDB(t *testing.T) *Store {
+	t.Helper()
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
 	}
-	sugar := logger.Sugar()
-	store, err := New(context.Background(), sugar, "enhanced-rarity-437111-d9")
-	if err != nil {
-		return nil, err
-	}
-	return store, nil
+	store, err := New(context.Background(), zap.NewNop().Sugar(), "sentence-gen-test", 1)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	return store
 }
 
 func TestStore_GetDailySpending(t *testing.T) {
-	s, err := initDB()
-	assert.NoError(t, err)
+	s := initDB(t)
 	res, err := s.GetDailySpending(context.Background())
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
-	assert.NoError(t, s.Close())
 }
 
 func TestStore_AddDailySpending(t *testing.T) {
-	s, err := initDB()
-	assert.NoError(t, err)
+	s := initDB(t)
 	assert.NoError(t, s.AddDailySpending(context.Background(), &Spending{
 		Amount:                  10,
 		Chirp3HDCharacters:      10,
@@ -40,5 +39,39 @@ func TestStore_AddDailySpending(t *testing.T) {
 		GeminiInputTokens:       10,
 		GeminiOutputTokens:      10,
 	}))
-	assert.NoError(t, s.Close())
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	s := initDB(t)
+	a, err := NewAggregator(context.Background(), s, s.logger, time.Hour)
+	assert.NoError(t, err)
+
+	before, err := a.GetDailySpending(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, a.AddDailySpending(context.Background(), &Spending{Amount: 10, GeminiInputTokens: 10}))
+
+	//The increment is visible locally before it is flushed
+	local, err := a.GetDailySpending(context.Background())
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, local.Amount, before.Amount+10)
+
+	assert.NoError(t, a.Close())
+	stored, err := s.GetDailySpending(context.Background())
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, stored.Amount, before.Amount+10)
+}
+
+func TestStore_ShardedSpending(t *testing.T) {
+	s := initDB(t)
+	before, err := s.GetDailySpending(context.Background())
+	assert.NoError(t, err)
+
+	//Sharded increments are summed with the day doc
+	s.shards = 4
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, s.AddDailySpending(context.Background(), &Spending{Amount: 1}))
+	}
+	after, err := s.GetDailySpending(context.Background())
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, after.Amount, before.Amount+8)
 }
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const collectionLedger = "ledger"
+
+// LedgerEntry records the usage and cost of a single request.
+// Entries are deleted by a firestore ttl policy on expire_at once the retention period is over
+type LedgerEntry struct {
+	//ID is assigned on the first write, so retried writes don't duplicate the entry
+	ID             string            `firestore:"-"`
+	Time           time.Time         `firestore:"time"`
+	Operation      string            `firestore:"operation"`
+	Principal      string            `firestore:"principal"`
+	Word           string            `firestore:"word"`
+	FromLanguage   string            `firestore:"from_language"`
+	ToLanguage     string            `firestore:"to_language"`
+	Model          string            `firestore:"model"`
+	Voice          string            `firestore:"voice"`
+	InputTokens    int64             `firestore:"gemini_input_tokens"`
+	OutputTokens   int64             `firestore:"gemini_output_tokens"`
+	CachedTokens   int64             `firestore:"gemini_cached_tokens"`
+	ToolUseTokens  int64             `firestore:"gemini_tool_use_tokens"`
+	ThinkingTokens int64             `firestore:"gemini_thinking_tokens"`
+	Characters     int64             `firestore:"characters"`
+	Amount         currency.MicroUSD `firestore:"amount_micro_usd"`
+	CacheHit       bool              `firestore:"cache_hit"`
+	Outcome        string            `firestore:"outcome"`
+	ExpireAt       time.Time         `firestore:"expire_at"`
+}
+
+// AddLedgerEntry records the request in the ledger
+func (s *Store) AddLedgerEntry(ctx context.Context, entry *LedgerEntry) (err error) {
+	ctx, span := startSpan(ctx, "AddLedgerEntry")
+	defer func() { endSpan(span, err) }()
+
+	if entry == nil {
+		s.logger.Errorw("failed to add ledger entry: nil entry", "error", errors.New("entry cannot be nil"))
+		return errors.New("entry cannot be nil")
+	}
+	if _, err := s.ledgerDoc(entry).Create(ctx, entry); err != nil && status.Code(err) != codes.AlreadyExists {
+		s.logger.Errorw("failed to add ledger entry", "error", err)
+		return err
+	}
+	s.logger.Debugw("ledger entry added", "operation", entry.Operation, "principal", entry.Principal, "amount", entry.Amount)
+	return nil
+}
+
+// addLedgerEntries records the requests in the ledger in bulk. It returns the entries that failed to be written
+func (s *Store) addLedgerEntries(ctx context.Context, entries []*LedgerEntry) (_ []*LedgerEntry, err error) {
+	ctx, span := startSpan(ctx, "AddLedgerEntries", attribute.Int("db.entries", len(entries)))
+	defer func() { endSpan(span, err) }()
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	bw := s.db.BulkWriter(ctx)
+	type ledgerJob struct {
+		job   *firestore.BulkWriterJob
+		entry *LedgerEntry
+	}
+	jobs := make([]ledgerJob, 0, len(entries))
+	var failed []*LedgerEntry
+	var errs []error
+	for _, entry := range entries {
+		job, err := bw.Create(s.ledgerDoc(entry), entry)
+		if err != nil {
+			failed = append(failed, entry)
+			errs = append(errs, err)
+			continue
+		}
+		jobs = append(jobs, ledgerJob{job: job, entry: entry})
+	}
+	bw.End()
+
+	for _, j := range jobs {
+		if _, err := j.job.Results(); err != nil && status.Code(err) != codes.AlreadyExists {
+			failed = append(failed, j.entry)
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		s.logger.Errorw("failed to add ledger entries", "failed", len(failed), "error", err)
+		return failed, err
+	}
+	s.logger.Debugw("ledger entries added", "entries", len(entries))
+	return nil, nil
+}
+
+// ledgerDoc returns the doc of the entry, assigning the entry an id if it has none
+func (s *Store) ledgerDoc(entry *LedgerEntry) *firestore.DocumentRef {
+	if entry.ID == "" {
+		entry.ID = s.db.Collection(collectionLedger).NewDoc().ID
+	}
+	return s.db.Collection(collectionLedger).Doc(entry.ID)
+}
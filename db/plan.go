@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"google.golang.org/api/iterator"
+)
+
+const collectionPlanAssignments = "plan_assignments"
+
+type planAssignment struct {
+	Principal string    `firestore:"principal"`
+	Plan      string    `firestore:"plan"`
+	UpdatedAt time.Time `firestore:"updated_at"`
+}
+
+// GetPlanAssignments returns the plans principals were assigned to at runtime, keyed by principal
+func (s *Store) GetPlanAssignments(ctx context.Context) (_ map[string]string, err error) {
+	ctx, span := startSpan(ctx, "GetPlanAssignments")
+	defer func() { endSpan(span, err) }()
+
+	assigned := make(map[string]string)
+	iter := s.db.Collection(collectionPlanAssignments).Documents(ctx)
+	defer iter.Stop()
+	for {
+		docSnap, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			s.logger.Errorw("failed to list plan assignments", "error", err)
+			return nil, err
+		}
+		var a planAssignment
+		if err := docSnap.DataTo(&a); err != nil {
+			s.logger.Errorw("failed to decode plan assignment", "error", err)
+			return nil, err
+		}
+		assigned[a.Principal] = a.Plan
+	}
+	s.logger.Debugw("plan assignments listed", "assignments", len(assigned))
+	return assigned, nil
+}
+
+// SetPlanAssignment assigns the principal to the plan
+func (s *Store) SetPlanAssignment(ctx context.Context, principal, plan string) (err error) {
+	ctx, span := startSpan(ctx, "SetPlanAssignment")
+	defer func() { endSpan(span, err) }()
+
+	//Doc ids can't contain slashes, the principal itself is kept in the doc
+	id := strings.ReplaceAll(principal, "/", "_")
+	_, err = s.db.Collection(collectionPlanAssignments).Doc(id).Set(ctx, planAssignment{Principal: principal, Plan: plan, UpdatedAt: time.Now()})
+	if err != nil {
+		s.logger.Errorw("failed to set plan assignment", "principal", principal, "plan", plan, "error", err)
+		return err
+	}
+	s.logger.Debugw("plan assignment set", "principal", principal, "plan", plan)
+	return nil
+}
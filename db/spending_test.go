@@ -0,0 +1,33 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpending_AddSub(t *testing.T) {
+	batch := Spending{
+		Amount:     30,
+		Requests:   1,
+		Operations: map[string]Usage{"translate": {Amount: 30, Requests: 1}},
+		Principals: map[string]Usage{"api_key:app": {Amount: 30, Requests: 1}},
+	}
+
+	var pending Spending
+	pending.Add(&batch)
+	pending.Add(&Spending{Amount: 10, Requests: 1, Operations: map[string]Usage{"sentence": {Amount: 10, Requests: 1}}})
+	assert.Equal(t, Usage{Amount: 30, Requests: 1}, pending.Operations["translate"])
+	assert.Len(t, pending.Operations, 2)
+
+	//Clones don't share the breakdowns
+	cp := pending.Clone()
+	cp.Sub(&batch)
+	assert.Len(t, cp.Operations, 1)
+	assert.Len(t, cp.Principals, 0)
+	assert.Len(t, pending.Operations, 2)
+
+	cp.Sub(&Spending{Amount: 10, Requests: 1, Operations: map[string]Usage{"sentence": {Amount: 10, Requests: 1}}})
+	assert.True(t, cp.IsZero())
+	assert.False(t, pending.IsZero())
+}
@@ -0,0 +1,26 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dafraer/sentence-gen-grpc-server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("db")
+
+// startSpan starts the span of a store operation
+func startSpan(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "firestore."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span of a store operation. A rejected reservation is recorded, but isn't a store failure
+func endSpan(span trace.Span, err error) {
+	if errors.Is(err, ErrQuotaExceeded) {
+		span.SetAttributes(attribute.Bool("db.quota_exceeded", true))
+		err = nil
+	}
+	tracing.End(span, err)
+}
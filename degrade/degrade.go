@@ -0,0 +1,89 @@
+package degrade
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Policy degrades requests once the fullest budget window is at least AbovePercent full.
+// TTSVoice switches the audio to another voice tier, DropAudio skips the audio, GeminiModel switches to a cheaper model
+// and CacheOnly serves only results that are already cached
+type Policy struct {
+	AbovePercent int    `json:"above_percent"`
+	TTSVoice     string `json:"tts_voice"`
+	DropAudio    bool   `json:"drop_audio"`
+	GeminiModel  string `json:"gemini_model"`
+	CacheOnly    bool   `json:"cache_only"`
+}
+
+// Decision is the combination of all the policies in effect at Percent
+type Decision struct {
+	Percent     int
+	TTSVoice    string
+	DropAudio   bool
+	GeminiModel string
+	CacheOnly   bool
+}
+
+// LoadPolicies reads the degradation policies from a json file
+func LoadPolicies(path string) ([]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policies []Policy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, err
+	}
+	if err := Validate(policies); err != nil {
+		return nil, err
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].AbovePercent < policies[j].AbovePercent })
+	return policies, nil
+}
+
+// Validate checks that every policy has a threshold and degrades something
+func Validate(policies []Policy) error {
+	for _, p := range policies {
+		if p.AbovePercent <= 0 {
+			return fmt.Errorf("invalid degradation threshold %d: must be a positive percent", p.AbovePercent)
+		}
+		if p.TTSVoice == "" && !p.DropAudio && p.GeminiModel == "" && !p.CacheOnly {
+			return errors.New("degradation policy must degrade something")
+		}
+	}
+	return nil
+}
+
+// Decide combines the policies in effect at the given fill percent of the budget.
+// Policies are applied in ascending order of their thresholds, so the later ones override the voice tier and model of the earlier ones
+func Decide(policies []Policy, percent int) Decision {
+	d := Decision{Percent: percent}
+	for _, p := range policies {
+		if percent < p.AbovePercent {
+			continue
+		}
+		if p.TTSVoice != "" {
+			d.TTSVoice = p.TTSVoice
+		}
+		if p.GeminiModel != "" {
+			d.GeminiModel = p.GeminiModel
+		}
+		d.DropAudio = d.DropAudio || p.DropAudio
+		d.CacheOnly = d.CacheOnly || p.CacheOnly
+	}
+	return d
+}
+
+// Degraded reports whether the decision degrades anything
+func (d Decision) Degraded() bool {
+	return d.TTSVoice != "" || d.DropAudio || d.GeminiModel != "" || d.CacheOnly
+}
+
+// CacheOnlyAt reports whether the policies serve only cached results at the given fill percent
+func CacheOnlyAt(policies []Policy, percent int) bool {
+	return Decide(policies, percent).CacheOnly
+}
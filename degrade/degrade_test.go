@@ -0,0 +1,29 @@
+package degrade
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecide(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "degradation.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[
+		{"above_percent": 100, "cache_only": true},
+		{"above_percent": 70, "tts_voice": "Standard"},
+		{"above_percent": 85, "drop_audio": true, "gemini_model": "gemini-2.0-flash-lite"}
+	]`), 0o600))
+	policies, err := LoadPolicies(path)
+	assert.NoError(t, err)
+
+	assert.False(t, Decide(policies, 69).Degraded())
+	assert.Equal(t, Decision{Percent: 70, TTSVoice: "Standard"}, Decide(policies, 70))
+	assert.Equal(t, Decision{Percent: 90, TTSVoice: "Standard", DropAudio: true, GeminiModel: "gemini-2.0-flash-lite"}, Decide(policies, 90))
+	assert.True(t, Decide(policies, 120).CacheOnly)
+	assert.False(t, CacheOnlyAt(policies, 99))
+
+	assert.Error(t, Validate([]Policy{{AbovePercent: 50}}))
+	assert.Error(t, Validate([]Policy{{AbovePercent: 0, DropAudio: true}}))
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// audioStore keeps generated audio in memory for a short time, so it can be downloaded separately from the json response.
+// The oldest audio is dropped once the total size exceeds the limit
+type audioStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	maxBytes int
+	size     int
+	order    *list.List
+	items    map[string]*list.Element
+	now      func() time.Time
+}
+
+type storedAudio struct {
+	id        string
+	data      []byte
+	expiresAt time.Time
+}
+
+func newAudioStore(ttl time.Duration, maxBytes int) *audioStore {
+	return &audioStore{
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// add stores the audio under the id
+func (s *audioStore) add(id string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[id] = s.order.PushBack(&storedAudio{id: id, data: data, expiresAt: s.now().Add(s.ttl)})
+	s.size += len(data)
+	for s.size > s.maxBytes && s.order.Len() > 0 {
+		s.remove(s.order.Front())
+	}
+}
+
+// get returns the audio stored under the id if it hasn't expired
+func (s *audioStore) get(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	//Audio is added in expiry order, so expired audio is at the front
+	for e := s.order.Front(); e != nil && !s.now().Before(e.Value.(*storedAudio).expiresAt); e = s.order.Front() {
+		s.remove(e)
+	}
+	e, ok := s.items[id]
+	if !ok {
+		return nil, false
+	}
+	return e.Value.(*storedAudio).data, true
+}
+
+func (s *audioStore) remove(e *list.Element) {
+	a := s.order.Remove(e).(*storedAudio)
+	delete(s.items, a.id)
+	s.size -= len(a.data)
+}
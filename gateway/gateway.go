@@ -0,0 +1,289 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/certs"
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"go.uber.org/zap"
+	//Registers the error details, so they are rendered in the json errors
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	//ClientIPHeader carries the ip of the http client to the grpc server, which trusts it only from the gateway
+	ClientIPHeader = "x-forwarded-for"
+	//ClientCertHeader carries the subject name of the verified client certificate of the http client to the grpc server,
+	//which trusts it only from the gateway
+	ClientCertHeader = "x-client-cert-subject"
+
+	//AudioBase64 returns the audio inline in the json response, AudioDownload returns a url to download it from
+	AudioBase64   = "base64"
+	AudioDownload = "download"
+
+	audioTTL      = 10 * time.Minute
+	maxAudioBytes = 64 << 20
+	maxBodyBytes  = 64 << 10
+	audioPath     = "/v1/audio/"
+)
+
+var (
+	//forwardedHeaders are passed to the grpc server as metadata
+	forwardedHeaders = []string{"x-api-key", "authorization", "x-request-id", "traceparent", "tracestate"}
+
+	marshaler   = protojson.MarshalOptions{UseProtoNames: true}
+	unmarshaler = protojson.UnmarshalOptions{}
+)
+
+// Gateway serves the SentenceGen rpcs as http routes taking and returning json.
+// Calls go through the grpc server, so they are authenticated, limited and logged like any other rpc
+type Gateway struct {
+	client pb.SentenceGenClient
+	audio  *audioStore
+	logger *zap.SugaredLogger
+}
+
+// New creates new gateway calling the rpcs with the client
+func New(client pb.SentenceGenClient, logger *zap.SugaredLogger) *Gateway {
+	return &Gateway{client: client, audio: newAudioStore(audioTTL, maxAudioBytes), logger: logger}
+}
+
+// Handler returns the http handler of the routes
+func (g *Gateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/sentences", func(w http.ResponseWriter, r *http.Request) {
+		req := &pb.GenerateSentenceRequest{}
+		g.serve(w, r, req, func(ctx context.Context, opts ...grpc.CallOption) (audioResponse, error) {
+			return g.client.GenerateSentence(ctx, req, opts...)
+		})
+	})
+	mux.HandleFunc("POST /v1/translations", func(w http.ResponseWriter, r *http.Request) {
+		req := &pb.TranslateRequest{}
+		g.serve(w, r, req, func(ctx context.Context, opts ...grpc.CallOption) (audioResponse, error) {
+			return g.client.Translate(ctx, req, opts...)
+		})
+	})
+	mux.HandleFunc("POST /v1/definitions", func(w http.ResponseWriter, r *http.Request) {
+		req := &pb.GenerateDefinitionRequest{}
+		g.serve(w, r, req, func(ctx context.Context, opts ...grpc.CallOption) (audioResponse, error) {
+			return g.client.GenerateDefinition(ctx, req, opts...)
+		})
+	})
+	mux.HandleFunc("GET "+audioPath+"{id}", g.downloadAudio)
+	return mux
+}
+
+// audioResponse is a response of a SentenceGen rpc
+type audioResponse interface {
+	proto.Message
+	GetAudio() *pb.Audio
+}
+
+// serve decodes the json body into req, calls the rpc and writes the response or the error
+func (g *Gateway) serve(w http.ResponseWriter, r *http.Request, req proto.Message, call func(context.Context, ...grpc.CallOption) (audioResponse, error)) {
+	audioMode := r.URL.Query().Get("audio")
+	if audioMode == "" {
+		audioMode = AudioBase64
+	}
+	if audioMode != AudioBase64 && audioMode != AudioDownload {
+		writeError(w, status.New(codes.InvalidArgument, "audio must be base64 or download"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		writeError(w, status.New(codes.InvalidArgument, "request body too large"))
+		return
+	}
+	if err := unmarshaler.Unmarshal(body, req); err != nil {
+		writeError(w, status.New(codes.InvalidArgument, "invalid json request: "+err.Error()))
+		return
+	}
+
+	var header, trailer metadata.MD
+	resp, err := call(outgoingContext(r), grpc.Header(&header), grpc.Trailer(&trailer))
+	if v := header.Get("x-request-id"); len(v) > 0 {
+		w.Header().Set("X-Request-Id", v[0])
+	}
+	if err != nil {
+		if v := trailer.Get("retry-after"); len(v) > 0 {
+			w.Header().Set("Retry-After", v[0])
+		}
+		writeError(w, status.Convert(err))
+		return
+	}
+
+	//Download mode moves the audio out of the json response
+	var audioURL string
+	if audio := resp.GetAudio(); audioMode == AudioDownload && len(audio.GetData()) > 0 {
+		id := logging.NewRequestID()
+		g.audio.add(id, audio.Data)
+		m := resp.ProtoReflect()
+		m.Clear(m.Descriptor().Fields().ByName("audio"))
+		audioURL = audioPath + id
+	}
+
+	data, err := marshaler.Marshal(resp)
+	if err != nil {
+		g.logger.Errorw("failed to marshal gateway response", "path", r.URL.Path, "error", err)
+		writeError(w, status.New(codes.Internal, "failed to marshal response"))
+		return
+	}
+	if audioURL != "" {
+		data, err = withField(data, "audio_url", audioURL)
+		if err != nil {
+			g.logger.Errorw("failed to add audio url to gateway response", "error", err)
+			writeError(w, status.New(codes.Internal, "failed to marshal response"))
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// downloadAudio writes the audio stored by a call in download mode. The random id is the only credential, so it expires quickly
+func (g *Gateway) downloadAudio(w http.ResponseWriter, r *http.Request) {
+	data, ok := g.audio.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, status.New(codes.NotFound, "audio not found or expired"))
+		return
+	}
+	w.Header().Set("Content-Type", "audio/wav")
+	w.Header().Set("Cache-Control", "private, max-age=600")
+	_, _ = w.Write(data)
+}
+
+// outgoingContext returns the request context with the forwarded headers, the client ip and the subject of the verified
+// client certificate as grpc metadata. The in-process connection to the grpc server is plaintext, so the gateway passes on
+// the certificate it verified
+func outgoingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for _, h := range forwardedHeaders {
+		if v := r.Header.Get(h); v != "" {
+			md.Set(h, v)
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		md.Set(ClientIPHeader, host)
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		md.Set(ClientCertHeader, certs.SubjectName(r.TLS.VerifiedChains[0][0]))
+	}
+	return metadata.NewOutgoingContext(r.Context(), md)
+}
+
+// withField adds a string field to the json object
+func withField(data []byte, key, value string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	fields[key] = v
+	return json.Marshal(fields)
+}
+
+// errorBody is the json error in the style of the google apis
+type errorBody struct {
+	Error struct {
+		Code    int               `json:"code"`
+		Status  string            `json:"status"`
+		Message string            `json:"message"`
+		Details []json.RawMessage `json:"details,omitempty"`
+	} `json:"error"`
+}
+
+// writeError writes the grpc status as a json error with the matching http status
+func writeError(w http.ResponseWriter, st *status.Status) {
+	var body errorBody
+	body.Error.Code = HTTPStatus(st.Code())
+	body.Error.Status = codeName(st.Code())
+	body.Error.Message = st.Message()
+	for _, d := range st.Proto().GetDetails() {
+		if data, err := marshaler.Marshal(d); err == nil {
+			body.Error.Details = append(body.Error.Details, data)
+		}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, st.Message(), body.Error.Code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(body.Error.Code)
+	_, _ = w.Write(data)
+}
+
+// HTTPStatus returns the http status matching the grpc code
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// codeName returns the canonical name of the code, e.g. RESOURCE_EXHAUSTED
+func codeName(code codes.Code) string {
+	name, ok := codeNames[code]
+	if !ok {
+		return "UNKNOWN"
+	}
+	return name
+}
+
+var codeNames = map[codes.Code]string{
+	codes.OK:                 "OK",
+	codes.Canceled:           "CANCELLED",
+	codes.Unknown:            "UNKNOWN",
+	codes.InvalidArgument:    "INVALID_ARGUMENT",
+	codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.PermissionDenied:   "PERMISSION_DENIED",
+	codes.ResourceExhausted:  "RESOURCE_EXHAUSTED",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "ABORTED",
+	codes.OutOfRange:         "OUT_OF_RANGE",
+	codes.Unimplemented:      "UNIMPLEMENTED",
+	codes.Internal:           "INTERNAL",
+	codes.Unavailable:        "UNAVAILABLE",
+	codes.DataLoss:           "DATA_LOSS",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+}
@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type fakeClient struct {
+	pb.SentenceGenClient
+	md  metadata.MD
+	req *pb.GenerateSentenceRequest
+	err error
+}
+
+func (c *fakeClient) GenerateSentence(ctx context.Context, req *pb.GenerateSentenceRequest, opts ...grpc.CallOption) (*pb.GenerateSentenceResponse, error) {
+	c.md, _ = metadata.FromOutgoingContext(ctx)
+	c.req = req
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case grpc.HeaderCallOption:
+			*o.HeaderAddr = metadata.Pairs("x-request-id", "req-1")
+		case grpc.TrailerCallOption:
+			*o.TrailerAddr = metadata.Pairs("retry-after", "3")
+		}
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &pb.GenerateSentenceResponse{
+		OriginalSentence:   "Der Apfel ist rot.",
+		TranslatedSentence: "The apple is red.",
+		Audio:              &pb.Audio{Data: []byte("RIFF")},
+	}, nil
+}
+
+func post(t *testing.T, h http.Handler, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("X-Api-Key", "secret")
+	r.RemoteAddr = "203.0.113.7:51234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestGateway_Base64Audio(t *testing.T) {
+	client := &fakeClient{}
+	h := New(client, zap.NewNop().Sugar()).Handler()
+
+	w := post(t, h, "/v1/sentences", `{"word": "Apfel", "word_language": "de", "translation_language": "en", "include_audio": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "req-1", w.Header().Get("X-Request-Id"))
+	assert.Equal(t, "Apfel", client.req.Word)
+	assert.True(t, client.req.IncludeAudio)
+	assert.Equal(t, []string{"secret"}, client.md.Get("x-api-key"))
+	assert.Equal(t, []string{"203.0.113.7"}, client.md.Get(ClientIPHeader))
+
+	var resp struct {
+		OriginalSentence string `json:"original_sentence"`
+		Audio            struct {
+			Data string `json:"data"`
+		} `json:"audio"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Der Apfel ist rot.", resp.OriginalSentence)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("RIFF")), resp.Audio.Data)
+}
+
+func TestGateway_ClientCert(t *testing.T) {
+	client := &fakeClient{}
+	h := New(client, zap.NewNop().Sugar()).Handler()
+	body := `{"word": "Apfel", "word_language": "de", "translation_language": "en"}`
+
+	//The subject of the verified certificate is passed on, a header sent by the client is not
+	r := httptest.NewRequest(http.MethodPost, "/v1/sentences", strings.NewReader(body))
+	r.Header.Set(ClientCertHeader, "spoofed")
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "mobile-app"}}}}}
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, []string{"mobile-app"}, client.md.Get(ClientCertHeader))
+
+	//Unverified certificates aren't passed on
+	r = httptest.NewRequest(http.MethodPost, "/v1/sentences", strings.NewReader(body))
+	r.Header.Set(ClientCertHeader, "spoofed")
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "mobile-app"}}}}
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Empty(t, client.md.Get(ClientCertHeader))
+}
+
+func TestGateway_DownloadAudio(t *testing.T) {
+	h := New(&fakeClient{}, zap.NewNop().Sugar()).Handler()
+
+	w := post(t, h, "/v1/sentences?audio=download", `{"word": "Apfel", "include_audio": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotContains(t, resp, "audio")
+	url, _ := resp["audio_url"].(string)
+	assert.True(t, strings.HasPrefix(url, audioPath))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "audio/wav", w.Header().Get("Content-Type"))
+	body, _ := io.ReadAll(w.Body)
+	assert.Equal(t, "RIFF", string(body))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, audioPath+"unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGateway_Errors(t *testing.T) {
+	st, err := status.New(codes.ResourceExhausted, "rate limit exceeded").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(3 * time.Second)})
+	assert.NoError(t, err)
+	h := New(&fakeClient{err: st.Err()}, zap.NewNop().Sugar()).Handler()
+
+	w := post(t, h, "/v1/sentences", `{"word": "Apfel"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+	var body errorBody
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "RESOURCE_EXHAUSTED", body.Error.Status)
+	assert.Equal(t, "rate limit exceeded", body.Error.Message)
+	assert.Len(t, body.Error.Details, 1)
+	assert.Contains(t, string(body.Error.Details[0]), "RetryInfo")
+
+	//Bad json and unknown fields are rejected before the rpc
+	assert.Equal(t, http.StatusBadRequest, post(t, h, "/v1/sentences", `{"word": `).Code)
+	assert.Equal(t, http.StatusBadRequest, post(t, h, "/v1/sentences", `{"wort": "Apfel"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(t, h, "/v1/sentences?audio=mp3", `{}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, httpGet(h, "/v1/sentences").Code)
+}
+
+func httpGet(h http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestAudioStore(t *testing.T) {
+	now := time.Now()
+	s := newAudioStore(time.Minute, 10)
+	s.now = func() time.Time { return now }
+
+	s.add("a", []byte("12345"))
+	s.add("b", []byte("12345"))
+	_, ok := s.get("a")
+	assert.True(t, ok)
+
+	//Over the size limit the oldest audio is dropped
+	s.add("c", []byte("1"))
+	_, ok = s.get("a")
+	assert.False(t, ok)
+	_, ok = s.get("b")
+	assert.True(t, ok)
+
+	now = now.Add(time.Minute)
+	_, ok = s.get("c")
+	assert.False(t, ok)
+	assert.Equal(t, 0, s.size)
+}
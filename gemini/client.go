@@ -3,8 +3,15 @@ package gemini
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	"github.com/dafraer/sentence-gen-grpc-server/tracing"
+	"github.com/dafraer/sentence-gen-grpc-server/upstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/genai"
 )
@@ -26,170 +33,295 @@ Translate word/phrase %s from language %s to %s.
 -Translation hint:%s`
 )
 
+// Caps of the answer tokens of every operation, on top of the thinking budget. Answers cut off by the cap fail to parse
+// and are rejected. The sentence cap leaves room for two long sentences
+const (
+	sentenceAnswerTokens    = 2560
+	translationAnswerTokens = 512
+	definitionAnswerTokens  = 1024
+)
+
+var tracer = tracing.Tracer("gemini")
+
 type Client struct {
-	client      *genai.Client
-	logger      *zap.SugaredLogger
-	geminiModel string
+	client          *genai.Client
+	upstream        *upstream.Caller
+	logger          *zap.SugaredLogger
+	geminiModel     string
+	maxOutputTokens int32
+	thinking        int32
 }
 
-// New creates new gemini client
-func New(ctx context.Context, logger *zap.SugaredLogger, geminiModel string) (*Client, error) {
-	logger.Infow("initializing gemini client", "model", geminiModel)
+// New creates new gemini client. maxOutputTokens caps the output (including thinking) tokens of every call,
+// thinkingBudget caps the thinking tokens of the models that think, policy sets the timeout, the retries and the circuit breaker of the calls
+func New(ctx context.Context, logger *zap.SugaredLogger, geminiModel string, maxOutputTokens, thinkingBudget int32, policy upstream.Config) (*Client, error) {
+	logger.Infow("initializing gemini client", "model", geminiModel, "max_output_tokens", maxOutputTokens, "thinking_budget", thinkingBudget)
 	client, err := genai.NewClient(ctx, nil)
 	if err != nil {
 		logger.Errorw("failed to initialize gemini client", "error", err)
 		return nil, err
 	}
 	logger.Infow("gemini client initialized", "model", geminiModel)
-	return &Client{client: client, logger: logger, geminiModel: geminiModel}, nil
+	return &Client{
+		client:          client,
+		upstream:        upstream.New("gemini", policy, classify, logger),
+		logger:          logger,
+		geminiModel:     geminiModel,
+		maxOutputTokens: maxOutputTokens,
+		thinking:        thinkingBudget,
+	}, nil
 }
 
-// GenerateSentence generates sentences using Gemini
-func (c *Client) GenerateSentence(ctx context.Context, req *SentenceGenerationRequest) (*SentenceGenerationResponse, *Tokens, error) {
-	c.logger.Debugw("gemini generate sentence request started", "word", req.Word, "word_language", req.WordLanguage, "translation_language", req.TranslationLanguage)
-
-	//Create a config for structured output
-	config := &genai.GenerateContentConfig{
-		ResponseMIMEType: "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
-				"original_sentence": {
-					Type:        genai.TypeString,
-					Description: "Sentence in the language of the provided word.",
-				},
-				"translated_sentence": {
-					Type:        genai.TypeString,
-					Description: "Translated sentence.",
-				},
-			},
-			Required:         []string{"original_sentence", "translated_sentence"},
-			PropertyOrdering: []string{"original_sentence", "translated_sentence"},
-		},
+// classify returns the kind of the errors gemini returns without generating and billing anything, so the call can be retried
+func classify(err error) error {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+	switch apiErr.Code {
+	case http.StatusTooManyRequests:
+		return upstream.ErrThrottled
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return upstream.ErrUnavailable
+	default:
+		return nil
 	}
+}
+
+// log returns the logger with the request id of ctx
+func (c *Client) log(ctx context.Context) *zap.SugaredLogger {
+	return logging.FromContext(ctx, c.logger)
+}
+
+// GenerateSentence generates sentences using Gemini. If the response can't be parsed the error is returned together with the tokens spent
+func (c *Client) GenerateSentence(ctx context.Context, req *SentenceGenerationRequest) (*SentenceGenerationResponse, *Tokens, error) {
+	c.log(ctx).Debugw("gemini generate sentence request started", "word", req.Word, "word_language", req.WordLanguage, "translation_language", req.TranslationLanguage)
 
 	//Generate response
-	result, err := c.client.Models.GenerateContent(
-		ctx,
-		c.geminiModel,
-		genai.Text(formatSentenceGenPrompt(req.WordLanguage, req.TranslationLanguage, req.Word, req.TranslationHint)),
-		config,
-	)
+	prompt, config := c.sentenceRequest(req)
+	model := c.model(req.Model)
+	result, tokens, err := c.generate(ctx, "GenerateSentence", model, prompt, config)
 	if err != nil {
-		c.logger.Errorw("gemini generate sentence request failed", "error", err)
+		c.log(ctx).Errorw("gemini generate sentence request failed", "error", err)
 		return nil, nil, err
 	}
 
 	//Unmarshal response
 	resp := &SentenceGenerationResponse{}
 	if err := json.Unmarshal([]byte(result.Text()), resp); err != nil {
-		c.logger.Errorw("failed to unmarshal gemini sentence response", "error", err)
-		return nil, nil, err
-	}
-
-	//Calculate tokens spent
-	tokens := &Tokens{
-		OutputTokens: int64(result.UsageMetadata.CandidatesTokenCount),
-		InputTokens:  int64(result.UsageMetadata.PromptTokenCount),
+		c.log(ctx).Errorw("failed to unmarshal gemini sentence response", "error", err)
+		return nil, tokens, err
 	}
-	c.logger.Debugw("gemini generate sentence request completed", "input_tokens", tokens.InputTokens, "output_tokens", tokens.OutputTokens)
+	c.log(ctx).Debugw("gemini generate sentence request completed", "input_tokens", tokens.InputTokens, "cached_tokens", tokens.CachedTokens, "tool_use_tokens", tokens.ToolUseTokens, "output_tokens", tokens.OutputTokens, "thinking_tokens", tokens.ThinkingTokens)
 	return resp, tokens, nil
 }
 
-// Translate translates word/phrase using gemini
+// Translate translates word/phrase using gemini. If the response can't be parsed the error is returned together with the tokens spent
 func (c *Client) Translate(ctx context.Context, req *TranslationRequest) (*TranslationResponse, *Tokens, error) {
-	c.logger.Debugw("gemini translate request started", "word", req.Word, "from_language", req.FromLanguage, "to_language", req.ToLanguage)
-
-	//Create a config for structured output
-	config := &genai.GenerateContentConfig{
-		ResponseMIMEType: "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
-				"translation": {
-					Type:        genai.TypeString,
-					Description: "Translated word/phrase",
-				},
-			},
-			Required:         []string{"translation"},
-			PropertyOrdering: []string{"translation"},
-		},
-	}
+	c.log(ctx).Debugw("gemini translate request started", "word", req.Word, "from_language", req.FromLanguage, "to_language", req.ToLanguage)
 
 	//Generate response
-	result, err := c.client.Models.GenerateContent(
-		ctx,
-		c.geminiModel,
-		genai.Text(formatTranslationPrompt(req.Word, req.FromLanguage, req.ToLanguage, req.TranslationHint)),
-		config,
-	)
+	prompt, config := c.translationRequest(req)
+	model := c.model(req.Model)
+	result, tokens, err := c.generate(ctx, "Translate", model, prompt, config)
 	if err != nil {
-		c.logger.Errorw("gemini translate request failed", "error", err)
+		c.log(ctx).Errorw("gemini translate request failed", "error", err)
 		return nil, nil, err
 	}
 
 	//Unmarshal response
 	resp := &TranslationResponse{}
 	if err := json.Unmarshal([]byte(result.Text()), resp); err != nil {
-		c.logger.Errorw("failed to unmarshal gemini translation response", "error", err)
-		return nil, nil, err
-	}
-
-	//Calculate tokens spent
-	tokens := &Tokens{
-		OutputTokens: int64(result.UsageMetadata.CandidatesTokenCount),
-		InputTokens:  int64(result.UsageMetadata.PromptTokenCount),
+		c.log(ctx).Errorw("failed to unmarshal gemini translation response", "error", err)
+		return nil, tokens, err
 	}
-	c.logger.Debugw("gemini translate request completed", "input_tokens", tokens.InputTokens, "output_tokens", tokens.OutputTokens)
+	c.log(ctx).Debugw("gemini translate request completed", "input_tokens", tokens.InputTokens, "cached_tokens", tokens.CachedTokens, "tool_use_tokens", tokens.ToolUseTokens, "output_tokens", tokens.OutputTokens, "thinking_tokens", tokens.ThinkingTokens)
 
 	return resp, tokens, nil
 }
 
-// GenerateDefinition generates definition using Gemini
+// GenerateDefinition generates definition using Gemini. If the response can't be parsed the error is returned together with the tokens spent
 func (c *Client) GenerateDefinition(ctx context.Context, req *DefinitionRequest) (*DefinitionResponse, *Tokens, error) {
-	c.logger.Debugw("gemini generate definition request started", "word", req.Word, "language", req.Language)
-
-	//Create a config for structured output
-	config := &genai.GenerateContentConfig{
-		ResponseMIMEType: "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
-				"definition": {
-					Type:        genai.TypeString,
-					Description: "Definition of the word/phrase without the word/phrase itself",
-				},
-			},
-			Required:         []string{"definition"},
-			PropertyOrdering: []string{"definition"},
-		},
-	}
+	c.log(ctx).Debugw("gemini generate definition request started", "word", req.Word, "language", req.Language)
 
 	//Generate response
-	result, err := c.client.Models.GenerateContent(
-		ctx,
-		c.geminiModel,
-		genai.Text(formatDefinitionPrompt(req.Language, req.Word, req.DefinitionHint)),
-		config,
-	)
+	prompt, config := c.definitionRequest(req)
+	model := c.model(req.Model)
+	result, tokens, err := c.generate(ctx, "GenerateDefinition", model, prompt, config)
 	if err != nil {
-		c.logger.Errorw("gemini generate definition request failed", "error", err)
+		c.log(ctx).Errorw("gemini generate definition request failed", "error", err)
 		return nil, nil, err
 	}
 
 	//Unmarshal response
 	resp := &DefinitionResponse{}
 	if err := json.Unmarshal([]byte(result.Text()), resp); err != nil {
-		c.logger.Errorw("failed to unmarshal gemini definition response", "error", err)
+		c.log(ctx).Errorw("failed to unmarshal gemini definition response", "error", err)
+		return nil, tokens, err
+	}
+	c.log(ctx).Debugw("gemini generate definition request completed", "input_tokens", tokens.InputTokens, "cached_tokens", tokens.CachedTokens, "tool_use_tokens", tokens.ToolUseTokens, "output_tokens", tokens.OutputTokens, "thinking_tokens", tokens.ThinkingTokens)
+	return resp, tokens, nil
+}
+
+// generate calls the model in a span recording the tokens spent, retrying the calls gemini rejected.
+// The call is billed even if the response turns out to be unusable, so the tokens are returned with the result
+func (c *Client) generate(ctx context.Context, operation, model, prompt string, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, *Tokens, error) {
+	ctx, span := tracer.Start(ctx, "gemini."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("gemini.model", model)))
+	var result *genai.GenerateContentResponse
+	err := c.upstream.Call(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = c.client.Models.GenerateContent(ctx, model, genai.Text(prompt), config)
+		return err
+	})
+	if err != nil {
+		tracing.End(span, err)
 		return nil, nil, err
 	}
-	//Calculate tokens spent
-	tokens := &Tokens{
-		OutputTokens: int64(result.UsageMetadata.CandidatesTokenCount),
-		InputTokens:  int64(result.UsageMetadata.PromptTokenCount),
+	tokens := c.usageTokens(model, result)
+	span.SetAttributes(
+		attribute.Int64("gemini.input_tokens", tokens.InputTokens),
+		attribute.Int64("gemini.cached_tokens", tokens.CachedTokens),
+		attribute.Int64("gemini.tool_use_tokens", tokens.ToolUseTokens),
+		attribute.Int64("gemini.output_tokens", tokens.OutputTokens),
+		attribute.Int64("gemini.thinking_tokens", tokens.ThinkingTokens),
+	)
+	span.End()
+	return result, tokens, nil
+}
+
+// EstimateSentence returns the worst case token usage of the sentence generation request
+func (c *Client) EstimateSentence(req *SentenceGenerationRequest) *Tokens {
+	prompt, config := c.sentenceRequest(req)
+	return c.estimate(c.model(req.Model), prompt, config)
+}
+
+// EstimateTranslation returns the worst case token usage of the translation request
+func (c *Client) EstimateTranslation(req *TranslationRequest) *Tokens {
+	prompt, config := c.translationRequest(req)
+	return c.estimate(c.model(req.Model), prompt, config)
+}
+
+// EstimateDefinition returns the worst case token usage of the definition request
+func (c *Client) EstimateDefinition(req *DefinitionRequest) *Tokens {
+	prompt, config := c.definitionRequest(req)
+	return c.estimate(c.model(req.Model), prompt, config)
+}
+
+// estimate returns an upper bound of the tokens the request can be billed for.
+// A token is never shorter than a byte, so the size of the prompt and the response schema bounds the input tokens.
+// The output cap of the call covers the thinking too, so the thinking budget is reserved as thinking tokens and the rest
+// of the cap as output tokens, each priced by its own price. Nothing is cached and no tools are used
+func (c *Client) estimate(model, prompt string, config *genai.GenerateContentConfig) *Tokens {
+	inputTokens := int64(len(prompt))
+	if schema, err := json.Marshal(config.ResponseSchema); err == nil {
+		inputTokens += int64(len(schema))
 	}
-	c.logger.Debugw("gemini generate definition request completed", "input_tokens", tokens.InputTokens, "output_tokens", tokens.OutputTokens)
-	return resp, tokens, nil
+	var thinkingTokens int64
+	if config.ThinkingConfig != nil && config.ThinkingConfig.ThinkingBudget != nil {
+		thinkingTokens = int64(min(*config.ThinkingConfig.ThinkingBudget, config.MaxOutputTokens))
+	}
+	return &Tokens{
+		Model:          model,
+		InputTokens:    inputTokens,
+		OutputTokens:   int64(config.MaxOutputTokens) - thinkingTokens,
+		ThinkingTokens: thinkingTokens,
+	}
+}
+
+// outputConfig returns the config of a call to the model whose answer takes at most the given tokens.
+// The output is capped at the thinking budget plus the answer, so the reserved cost stays close to the actual one.
+// Only the models that think get a thinking config, the others reject it
+func (c *Client) outputConfig(model string, answerTokens int32) *genai.GenerateContentConfig {
+	config := &genai.GenerateContentConfig{
+		MaxOutputTokens:  min(c.maxOutputTokens, answerTokens),
+		ResponseMIMEType: "application/json",
+	}
+	if _, ok := thinkingOf(model); ok {
+		budget := c.thinking
+		config.MaxOutputTokens = min(c.maxOutputTokens, budget+answerTokens)
+		config.ThinkingConfig = &genai.ThinkingConfig{ThinkingBudget: &budget}
+	}
+	return config
+}
+
+// model returns the model of the call, the override if not empty
+func (c *Client) model(override string) string {
+	if override != "" {
+		return override
+	}
+	return c.geminiModel
+}
+
+// usageTokens returns the tokens the call to the model was billed for
+func (c *Client) usageTokens(model string, result *genai.GenerateContentResponse) *Tokens {
+	if result.UsageMetadata == nil {
+		return &Tokens{Model: model}
+	}
+	usage := result.UsageMetadata
+	return &Tokens{
+		Model: model,
+		//The prompt token count includes the cached tokens
+		InputTokens:    int64(usage.PromptTokenCount - usage.CachedContentTokenCount),
+		CachedTokens:   int64(usage.CachedContentTokenCount),
+		ToolUseTokens:  int64(usage.ToolUsePromptTokenCount),
+		OutputTokens:   int64(usage.CandidatesTokenCount),
+		ThinkingTokens: int64(usage.ThoughtsTokenCount),
+	}
+}
+
+func (c *Client) sentenceRequest(req *SentenceGenerationRequest) (string, *genai.GenerateContentConfig) {
+	//Create a config for structured output
+	config := c.outputConfig(c.model(req.Model), sentenceAnswerTokens)
+	config.ResponseSchema = &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"original_sentence": {
+				Type:        genai.TypeString,
+				Description: "Sentence in the language of the provided word.",
+			},
+			"translated_sentence": {
+				Type:        genai.TypeString,
+				Description: "Translated sentence.",
+			},
+		},
+		Required:         []string{"original_sentence", "translated_sentence"},
+		PropertyOrdering: []string{"original_sentence", "translated_sentence"},
+	}
+	return formatSentenceGenPrompt(req.WordLanguage, req.TranslationLanguage, req.Word, req.TranslationHint), config
+}
+
+func (c *Client) translationRequest(req *TranslationRequest) (string, *genai.GenerateContentConfig) {
+	//Create a config for structured output
+	config := c.outputConfig(c.model(req.Model), translationAnswerTokens)
+	config.ResponseSchema = &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"translation": {
+				Type:        genai.TypeString,
+				Description: "Translated word/phrase",
+			},
+		},
+		Required:         []string{"translation"},
+		PropertyOrdering: []string{"translation"},
+	}
+	return formatTranslationPrompt(req.Word, req.FromLanguage, req.ToLanguage, req.TranslationHint), config
+}
+
+func (c *Client) definitionRequest(req *DefinitionRequest) (string, *genai.GenerateContentConfig) {
+	//Create a config for structured output
+	config := c.outputConfig(c.model(req.Model), definitionAnswerTokens)
+	config.ResponseSchema = &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"definition": {
+				Type:        genai.TypeString,
+				Description: "Definition of the word/phrase without the word/phrase itself",
+			},
+		},
+		Required:         []string{"definition"},
+		PropertyOrdering: []string{"definition"},
+	}
+	return formatDefinitionPrompt(req.Language, req.Word, req.DefinitionHint), config
 }
 
 func formatSentenceGenPrompt(wordLanguage, translationLanguage, word, translationHint string) string {
@@ -0,0 +1,109 @@
+package gemini
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genai"
+)
+
+func TestClient_usageTokens(t *testing.T) {
+	c := &Client{}
+	tests := []struct {
+		name   string
+		usage  *genai.GenerateContentResponseUsageMetadata
+		tokens Tokens
+	}{
+		{
+			name:   "no usage",
+			tokens: Tokens{Model: "model"},
+		},
+		{
+			name:   "plain call",
+			usage:  &genai.GenerateContentResponseUsageMetadata{PromptTokenCount: 120, CandidatesTokenCount: 30, TotalTokenCount: 150},
+			tokens: Tokens{Model: "model", InputTokens: 120, OutputTokens: 30},
+		},
+		{
+			//The prompt count includes the cached tokens, the candidates count doesn't include the thoughts
+			name: "cached prompt, tool use and thinking",
+			usage: &genai.GenerateContentResponseUsageMetadata{
+				PromptTokenCount:        120,
+				CachedContentTokenCount: 100,
+				ToolUsePromptTokenCount: 15,
+				CandidatesTokenCount:    30,
+				ThoughtsTokenCount:      400,
+				TotalTokenCount:         565,
+			},
+			tokens: Tokens{Model: "model", InputTokens: 20, CachedTokens: 100, ToolUseTokens: 15, OutputTokens: 30, ThinkingTokens: 400},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := c.usageTokens("model", &genai.GenerateContentResponse{UsageMetadata: tt.usage})
+			assert.Equal(t, tt.tokens, *tokens)
+			if tt.usage != nil {
+				//Every billed token is counted exactly once
+				assert.Equal(t, int64(tt.usage.TotalTokenCount), tokens.InputTokens+tokens.CachedTokens+tokens.ToolUseTokens+tokens.OutputTokens+tokens.ThinkingTokens)
+			}
+		})
+	}
+}
+
+func TestClient_outputConfig(t *testing.T) {
+	c := &Client{maxOutputTokens: 8192, thinking: 1024}
+	tests := []struct {
+		name     string
+		model    string
+		output   int32
+		thinking *int32
+	}{
+		{name: "thinking model", model: "gemini-2.5-pro", output: 1024 + translationAnswerTokens, thinking: &c.thinking},
+		{name: "thinking model with prefix", model: "models/gemini-3-pro-preview", output: 1024 + translationAnswerTokens, thinking: &c.thinking},
+		{name: "model without thinking", model: "gemini-2.0-flash", output: translationAnswerTokens},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := c.outputConfig(tt.model, translationAnswerTokens)
+			assert.Equal(t, tt.output, config.MaxOutputTokens)
+			if tt.thinking == nil {
+				assert.Nil(t, config.ThinkingConfig)
+				return
+			}
+			assert.Equal(t, *tt.thinking, *config.ThinkingConfig.ThinkingBudget)
+		})
+	}
+
+	//The output cap covers the thinking
+	c.maxOutputTokens = 1200
+	config := c.outputConfig("gemini-2.5-flash", translationAnswerTokens)
+	assert.Equal(t, int32(1200), config.MaxOutputTokens)
+}
+
+func TestClient_estimate(t *testing.T) {
+	c := &Client{maxOutputTokens: 8192, thinking: 1024, geminiModel: "gemini-2.5-pro"}
+	tokens := c.EstimateTranslation(&TranslationRequest{Word: "word"})
+	assert.Equal(t, int64(translationAnswerTokens), tokens.OutputTokens)
+	assert.Equal(t, int64(1024), tokens.ThinkingTokens)
+	assert.Positive(t, tokens.InputTokens)
+
+	//A cap below the thinking budget leaves nothing for the answer
+	c.maxOutputTokens = 512
+	tokens = c.EstimateTranslation(&TranslationRequest{Word: "word"})
+	assert.Equal(t, Tokens{Model: "gemini-2.5-pro", InputTokens: tokens.InputTokens, ThinkingTokens: 512}, *tokens)
+
+	tokens = c.EstimateTranslation(&TranslationRequest{Word: "word", Model: "gemini-2.0-flash"})
+	assert.Equal(t, int64(0), tokens.ThinkingTokens)
+	assert.Equal(t, int64(translationAnswerTokens), tokens.OutputTokens)
+}
+
+func TestValidateThinking(t *testing.T) {
+	assert.NoError(t, ValidateThinking("gemini-2.5-pro", 1024))
+	assert.Error(t, ValidateThinking("gemini-2.5-pro", 0))
+	assert.Error(t, ValidateThinking("gemini-3-pro-preview", 64))
+	assert.NoError(t, ValidateThinking("gemini-2.5-flash", 0))
+	assert.Error(t, ValidateThinking("gemini-2.5-flash", 30000))
+	assert.NoError(t, ValidateThinking("gemini-2.5-flash-lite", 0))
+	assert.Error(t, ValidateThinking("gemini-2.5-flash-lite", 256))
+	assert.NoError(t, ValidateThinking("gemini-2.0-flash", 0))
+	assert.NoError(t, ValidateThinking("gemini-2.0-flash", 1024))
+}
@@ -5,6 +5,8 @@ type SentenceGenerationRequest struct {
 	WordLanguage        string
 	TranslationLanguage string
 	TranslationHint     string
+	//Model overrides the model of the client if not empty
+	Model string
 }
 
 type SentenceGenerationResponse struct {
@@ -17,6 +19,8 @@ type TranslationRequest struct {
 	FromLanguage    string
 	ToLanguage      string
 	TranslationHint string
+	//Model overrides the model of the client if not empty
+	Model string
 }
 
 type TranslationResponse struct {
@@ -27,13 +31,26 @@ type DefinitionRequest struct {
 	Word           string
 	Language       string
 	DefinitionHint string
+	//Model overrides the model of the client if not empty
+	Model string
 }
 
 type DefinitionResponse struct {
 	Definition string `json:"definition"`
 }
 
+// Tokens is the billed usage of a call. Every token is counted in exactly one of the counts
 type Tokens struct {
-	InputTokens  int64
+	//Model is the model the tokens are billed by
+	Model string
+	//InputTokens are the prompt tokens that weren't served from the context cache
+	InputTokens int64
+	//CachedTokens are the prompt tokens served from the context cache
+	CachedTokens int64
+	//ToolUseTokens are the prompt tokens of tool call results, billed as input
+	ToolUseTokens int64
+	//OutputTokens are the response tokens without the thinking
 	OutputTokens int64
+	//ThinkingTokens are the thought tokens of thinking models, billed as output
+	ThinkingTokens int64
 }
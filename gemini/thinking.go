@@ -0,0 +1,47 @@
+package gemini
+
+import (
+	"fmt"
+	"strings"
+)
+
+// thinkingRange is the thinking budget a family of models accepts. Budget 0 turns thinking off where the model allows it
+type thinkingRange struct {
+	prefix     string
+	min, max   int32
+	canDisable bool
+}
+
+// thinkingRanges are the model families that think, more specific prefixes first. Other models don't take a thinking config
+var thinkingRanges = []thinkingRange{
+	{prefix: "gemini-3", min: 128, max: 32768},
+	{prefix: "gemini-2.5-pro", min: 128, max: 32768},
+	{prefix: "gemini-2.5-flash-lite", min: 512, max: 24576, canDisable: true},
+	{prefix: "gemini-2.5-flash", min: 1, max: 24576, canDisable: true},
+}
+
+// thinkingOf returns the thinking budget range of the model, false if the model doesn't think
+func thinkingOf(model string) (thinkingRange, bool) {
+	model = strings.TrimPrefix(model, "models/")
+	for _, r := range thinkingRanges {
+		if strings.HasPrefix(model, r.prefix) {
+			return r, true
+		}
+	}
+	return thinkingRange{}, false
+}
+
+// ValidateThinking returns an error if the model rejects the thinking budget. Models that don't think ignore it
+func ValidateThinking(model string, budget int32) error {
+	r, ok := thinkingOf(model)
+	if !ok || budget == 0 && r.canDisable {
+		return nil
+	}
+	if budget == 0 {
+		return fmt.Errorf("model %s can't turn thinking off, the thinking budget must be between %d and %d", model, r.min, r.max)
+	}
+	if budget < r.min || budget > r.max {
+		return fmt.Errorf("thinking budget %d of model %s must be between %d and %d", budget, model, r.min, r.max)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package logging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+
+	RedactNone = "none"
+	//RedactRemove replaces user supplied text with a placeholder
+	RedactRemove = "redact"
+	//RedactHash replaces user supplied text with its keyed hash, so requests for the same word can still be correlated
+	RedactHash = "hash"
+
+	redacted = "[redacted]"
+)
+
+var (
+	//SensitiveKeys are the log fields holding user supplied text
+	SensitiveKeys = []string{"word", "translation_hint", "definition_hint"}
+
+	ErrInvalidConfig = errors.New("invalid logging config")
+)
+
+// Config configures the logger
+type Config struct {
+	//Format is console or json
+	Format string
+	Level  zapcore.Level
+	//Sampling logs the first 100 entries with the same message and level every second and every 100th after that
+	Sampling bool
+	//Redaction is none, redact or hash
+	Redaction string
+	//HashKey keys the hashes of the redacted fields. It is required for the hash redaction, plain hashes of words are easy to reverse
+	HashKey string
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	switch c.Format {
+	case FormatConsole, FormatJSON:
+	default:
+		return errors.Join(ErrInvalidConfig, errors.New("format must be console or json"))
+	}
+	switch c.Redaction {
+	case RedactNone, RedactRemove:
+	case RedactHash:
+		if c.HashKey == "" {
+			return errors.Join(ErrInvalidConfig, errors.New("hash redaction requires a hash key"))
+		}
+	default:
+		return errors.Join(ErrInvalidConfig, errors.New("redaction must be none, redact or hash"))
+	}
+	return nil
+}
+
+// New creates new logger writing to stderr
+func New(cfg Config) (*zap.Logger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var encoder zapcore.Encoder
+	if cfg.Format == FormatJSON {
+		encoder = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	} else {
+		encoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	}
+	core := zapcore.NewCore(encoder, zapcore.Lock(os.Stderr), cfg.Level)
+
+	//Redaction wraps the output so sampled out entries aren't redacted needlessly
+	if cfg.Redaction == RedactRemove || cfg.Redaction == RedactHash {
+		core = newRedactCore(core, cfg.Redact)
+	}
+	if cfg.Sampling {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, 100, 100)
+	}
+	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)), nil
+}
+
+// Redact returns user supplied text the way the configured redaction writes it, so it can be kept out of other records too
+func (c Config) Redact(s string) string {
+	switch c.Redaction {
+	case RedactRemove:
+		return redacted
+	case RedactHash:
+		return hasher(c.HashKey)(s)
+	default:
+		return s
+	}
+}
+
+// hasher returns the function replacing text with the first 16 hex digits of its hmac
+func hasher(key string) func(string) string {
+	return func(s string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(s))
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+}
+
+// redactCore replaces the values of the sensitive fields before they are written
+type redactCore struct {
+	zapcore.Core
+	redact func(string) string
+}
+
+func newRedactCore(core zapcore.Core, redact func(string) string) zapcore.Core {
+	return &redactCore{Core: core, redact: redact}
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(c.fields(fields)), redact: c.redact}
+}
+
+func (c *redactCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, c.fields(fields))
+}
+
+func (c *redactCore) fields(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, f := range fields {
+		if !isSensitive(f.Key) {
+			continue
+		}
+		//Copy on the first sensitive field, the caller owns the slice
+		if out == nil {
+			out = append([]zapcore.Field(nil), fields...)
+		}
+		if f.Type == zapcore.StringType {
+			out[i] = zap.String(f.Key, c.redact(f.String))
+		} else {
+			out[i] = zap.String(f.Key, redacted)
+		}
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+func isSensitive(key string) bool {
+	for _, k := range SensitiveKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+type requestKey struct{}
+
+// request is the request id carried by a context, with the logger derived for it once per request
+type request struct {
+	id     string
+	base   *zap.SugaredLogger
+	logger *zap.SugaredLogger
+}
+
+// NewRequestID returns a random request id
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewContext returns a copy of ctx carrying the request id and the logger with the request id, so the fields
+// aren't added again on every log call
+func NewContext(ctx context.Context, requestID string, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, requestKey{}, &request{id: requestID, base: logger, logger: logger.With("request_id", requestID)})
+}
+
+// RequestID returns the request id carried by ctx
+func RequestID(ctx context.Context) (string, bool) {
+	req, ok := ctx.Value(requestKey{}).(*request)
+	if !ok {
+		return "", false
+	}
+	return req.id, true
+}
+
+// FromContext returns the logger with the request id of ctx, or the logger itself if ctx carries none.
+// The logger cached by NewContext is returned for the logger it was derived from, others get the id added
+func FromContext(ctx context.Context, logger *zap.SugaredLogger) *zap.SugaredLogger {
+	req, ok := ctx.Value(requestKey{}).(*request)
+	switch {
+	case !ok:
+		return logger
+	case req.base == logger:
+		return req.logger
+	default:
+		return logger.With("request_id", req.id)
+	}
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRedactCore(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(newRedactCore(core, hasher("secret"))).Sugar()
+
+	logger.Infow("translate request received", "word", "apple", "to_language", "de")
+	logger.With("translation_hint", "fruit").Debugw("gemini request started", "word", 42)
+	logger.Infow("generate sentence request received", "word", "apple")
+
+	entries := logs.All()
+	assert.Len(t, entries, 3)
+	first := entries[0].ContextMap()
+	assert.NotEqual(t, "apple", first["word"])
+	assert.Regexp(t, `^hmac:[0-9a-f]{16}$`, first["word"])
+	assert.Equal(t, "de", first["to_language"])
+
+	second := entries[1].ContextMap()
+	assert.Equal(t, hasher("secret")("fruit"), second["translation_hint"])
+	assert.Equal(t, redacted, second["word"])
+
+	//The same word hashes the same, so requests can be correlated
+	assert.Equal(t, first["word"], entries[2].ContextMap()["word"])
+	assert.NotEqual(t, hasher("other")("apple"), first["word"])
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, Config{Format: FormatJSON, Redaction: RedactNone}.Validate())
+	assert.NoError(t, Config{Format: FormatConsole, Redaction: RedactRemove}.Validate())
+	assert.ErrorIs(t, Config{Format: FormatJSON, Redaction: RedactHash}.Validate(), ErrInvalidConfig)
+	assert.NoError(t, Config{Format: FormatJSON, Redaction: RedactHash, HashKey: "secret"}.Validate())
+	assert.ErrorIs(t, Config{Format: "text", Redaction: RedactNone}.Validate(), ErrInvalidConfig)
+	assert.ErrorIs(t, Config{Format: FormatJSON, Redaction: "mask"}.Validate(), ErrInvalidConfig)
+}
+
+func TestFromContext(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core).Sugar()
+
+	FromContext(context.Background(), logger).Infow("no id")
+	id := NewRequestID()
+	assert.Len(t, id, 32)
+	ctx := NewContext(context.Background(), id, logger)
+	FromContext(ctx, logger).Infow("with id")
+	other := zap.New(core).Sugar().Named("other")
+	FromContext(ctx, other).Infow("other logger")
+
+	//The logger with the id is derived once per request
+	assert.Same(t, FromContext(ctx, logger), FromContext(ctx, logger))
+
+	entries := logs.All()
+	assert.NotContains(t, entries[0].ContextMap(), "request_id")
+	assert.Equal(t, id, entries[1].ContextMap()["request_id"])
+	assert.Equal(t, id, entries[2].ContextMap()["request_id"])
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const namespace = "sengen"
+
+// Metrics collects the prometheus metrics of the server. A nil Metrics collects nothing
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	latency         *prometheus.HistogramVec
+	upstreamLatency *prometheus.HistogramVec
+	upstreamErrors  *prometheus.CounterVec
+	tokens          *prometheus.CounterVec
+	characters      *prometheus.CounterVec
+	cost            *prometheus.CounterVec
+	budgetSpent     *prometheus.GaugeVec
+	budgetRemaining *prometheus.GaugeVec
+	cacheLookups    *prometheus.CounterVec
+	storeLatency    *prometheus.HistogramVec
+	storeErrors     *prometheus.CounterVec
+}
+
+// New creates new metrics registered together with the go runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "grpc_requests_total", Help: "Handled rpcs by method and status code.",
+		}, []string{"method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "grpc_request_duration_seconds", Help: "Latency of the handled rpcs.",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32},
+		}, []string{"method"}),
+		upstreamLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "upstream_request_duration_seconds", Help: "Latency of the gemini and tts calls.",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32},
+		}, []string{"upstream", "operation"}),
+		upstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "upstream_errors_total", Help: "Failed gemini and tts calls.",
+		}, []string{"upstream", "operation"}),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "gemini_tokens_total", Help: "Billed gemini tokens by model and kind.",
+		}, []string{"model", "kind"}),
+		characters: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "tts_characters_total", Help: "Billed tts characters by voice tier.",
+		}, []string{"voice"}),
+		cost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "cost_micro_usd_total", Help: "Cost of the requests by operation.",
+		}, []string{"operation"}),
+		budgetSpent: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "budget_spent_micro_usd", Help: "Spending of the current period of every budget window.",
+		}, []string{"period", "time_zone"}),
+		budgetRemaining: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "budget_remaining_micro_usd", Help: "Quota left in the current period of every budget window.",
+		}, []string{"period", "time_zone"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "result_cache_lookups_total", Help: "Lookups of the results cache by result (hit or miss).",
+		}, []string{"result"}),
+		storeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "store_operation_duration_seconds", Help: "Latency of the spending store operations.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+		storeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "store_errors_total", Help: "Failed spending store operations.",
+		}, []string{"operation"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.latency, m.upstreamLatency, m.upstreamErrors, m.tokens, m.characters, m.cost,
+		m.budgetSpent, m.budgetRemaining, m.cacheLookups, m.storeLatency, m.storeErrors,
+	)
+	return m
+}
+
+// Handler returns the http handler serving the metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Serve serves the metrics on /metrics at addr until ctx is done
+func (m *Metrics) Serve(ctx context.Context, addr string, logger *zap.SugaredLogger) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Errorw("failed to shut down metrics server", "error", err)
+		}
+	}()
+
+	logger.Infow("serving metrics", "address", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ObserveRPC records a handled rpc
+func (m *Metrics) ObserveRPC(method, code string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(method, code).Inc()
+	m.latency.WithLabelValues(method).Observe(d.Seconds())
+}
+
+// ObserveUpstream records a gemini or tts call
+func (m *Metrics) ObserveUpstream(upstream, operation string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.upstreamLatency.WithLabelValues(upstream, operation).Observe(d.Seconds())
+	if err != nil {
+		m.upstreamErrors.WithLabelValues(upstream, operation).Inc()
+	}
+}
+
+// AddTokens counts billed gemini tokens of a kind (input, cached, tool_use, output or thinking)
+func (m *Metrics) AddTokens(model, kind string, n int64) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.tokens.WithLabelValues(model, kind).Add(float64(n))
+}
+
+// AddCharacters counts billed tts characters
+func (m *Metrics) AddCharacters(voice string, n int64) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.characters.WithLabelValues(voice).Add(float64(n))
+}
+
+// AddCost counts the cost of a request
+func (m *Metrics) AddCost(operation string, microUSD int64) {
+	if m == nil || microUSD <= 0 {
+		return
+	}
+	m.cost.WithLabelValues(operation).Add(float64(microUSD))
+}
+
+// SetBudget records the spending and the quota left in the current period of a budget window
+func (m *Metrics) SetBudget(period, timeZone string, spent, remaining int64) {
+	if m == nil {
+		return
+	}
+	m.budgetSpent.WithLabelValues(period, timeZone).Set(float64(spent))
+	m.budgetRemaining.WithLabelValues(period, timeZone).Set(float64(remaining))
+}
+
+// ObserveCache records a lookup of the results cache
+func (m *Metrics) ObserveCache(hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(result).Inc()
+}
+
+// ObserveStore records a spending store operation
+func (m *Metrics) ObserveStore(operation string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.storeLatency.WithLabelValues(operation).Observe(d.Seconds())
+	if err != nil {
+		m.storeErrors.WithLabelValues(operation).Inc()
+	}
+}
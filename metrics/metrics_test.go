@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	m.ObserveRPC("/sentence_gen.SentenceGen/GenerateSentence", "OK", time.Second)
+	m.ObserveUpstream("gemini", "sentence", time.Second, errors.New("unavailable"))
+	m.AddTokens("gemini-2.5-flash", "output", 120)
+	m.AddCost("sentence", 1500)
+	m.SetBudget("daily", "UTC", 4000000, 1000000)
+	m.ObserveCache(true)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	assert.NoError(t, err)
+
+	for _, line := range []string{
+		`sengen_grpc_requests_total{code="OK",method="/sentence_gen.SentenceGen/GenerateSentence"} 1`,
+		`sengen_upstream_errors_total{operation="sentence",upstream="gemini"} 1`,
+		`sengen_gemini_tokens_total{kind="output",model="gemini-2.5-flash"} 120`,
+		`sengen_cost_micro_usd_total{operation="sentence"} 1500`,
+		`sengen_budget_remaining_micro_usd{period="daily",time_zone="UTC"} 1e+06`,
+		`sengen_result_cache_lookups_total{result="hit"} 1`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, string(body), line)
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	//A nil Metrics is how metrics are switched off, none of the calls may panic
+	var m *Metrics
+	m.ObserveRPC("method", "OK", time.Second)
+	m.ObserveUpstream("tts", "sentence", time.Second, nil)
+	m.AddTokens("model", "input", 1)
+	m.AddCharacters("Standard", 1)
+	m.AddCost("sentence", 1)
+	m.SetBudget("daily", "UTC", 1, 1)
+	m.ObserveCache(false)
+	m.ObserveStore("get_spending", time.Second, nil)
+}
@@ -0,0 +1,240 @@
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/budget"
+	"github.com/dafraer/sentence-gen-grpc-server/ratelimit"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownPlan = errors.New("unknown plan")
+)
+
+// Plan defines what the principals on it may use.
+// Methods lists the allowed rpcs by name ("Translate") or full method name, empty allows all of them.
+// AudioTiers lists the allowed tts voice tiers, empty means no audio.
+// Budgets are spending windows of every principal on the plan, on top of the global budget windows.
+// RateLimit is a token bucket per principal and rpc, nil means no limit
+type Plan struct {
+	Methods    []string         `json:"methods"`
+	AudioTiers []string         `json:"audio_tiers"`
+	Budgets    []budget.Window  `json:"budgets"`
+	RateLimit  *ratelimit.Limit `json:"rate_limit"`
+}
+
+// Config lists the plans and the principals assigned to them. Principals that aren't assigned are on the default plan
+type Config struct {
+	Default    string            `json:"default"`
+	Plans      map[string]Plan   `json:"plans"`
+	Principals map[string]string `json:"principals"`
+}
+
+// AssignmentStore persists the plans principals were assigned to at runtime. They take precedence over the config
+type AssignmentStore interface {
+	GetPlanAssignments(ctx context.Context) (map[string]string, error)
+	SetPlanAssignment(ctx context.Context, principal, plan string) error
+}
+
+type Registry struct {
+	config   Config
+	store    AssignmentStore
+	logger   *zap.SugaredLogger
+	limiters map[string]*ratelimit.Limiter
+
+	mu       sync.RWMutex
+	assigned map[string]string
+}
+
+// LoadConfig reads the plans from a json file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	if _, ok := c.Plans[c.Default]; !ok {
+		return fmt.Errorf("%w: default plan %q", ErrUnknownPlan, c.Default)
+	}
+	for name, p := range c.Plans {
+		if p.RateLimit != nil && (p.RateLimit.Rate < 0 || p.RateLimit.Burst < 0 || (p.RateLimit.Rate > 0 && p.RateLimit.Burst == 0)) {
+			return fmt.Errorf("plan %s: rate and burst must be positive", name)
+		}
+		if err := budget.Validate(p.Budgets); err != nil {
+			return fmt.Errorf("plan %s: %w", name, err)
+		}
+	}
+	for principal, name := range c.Principals {
+		if _, ok := c.Plans[name]; !ok {
+			return fmt.Errorf("%w %q for principal %s", ErrUnknownPlan, name, principal)
+		}
+	}
+	return nil
+}
+
+// New creates new plan registry. If store is not nil the assignments made at runtime are loaded from it and refreshed every interval,
+// so they reach every replica, until ctx is done
+func New(ctx context.Context, cfg Config, store AssignmentStore, refresh time.Duration, logger *zap.SugaredLogger) (*Registry, error) {
+	r := &Registry{
+		config:   cfg,
+		store:    store,
+		logger:   logger,
+		limiters: make(map[string]*ratelimit.Limiter),
+		assigned: make(map[string]string),
+	}
+	for name, p := range cfg.Plans {
+		if p.RateLimit != nil {
+			r.limiters[name] = ratelimit.New(ratelimit.Config{Default: p.RateLimit})
+		}
+	}
+	if store == nil {
+		return r, nil
+	}
+	if err := r.refresh(ctx); err != nil {
+		logger.Errorw("failed to load plan assignments", "error", err)
+		return nil, err
+	}
+	if refresh > 0 {
+		go r.run(ctx, refresh)
+	}
+	return r, nil
+}
+
+// Lookup returns the plan of the principal. An empty principal is anonymous and on the default plan
+func (r *Registry) Lookup(principal string) (string, *Plan) {
+	name := r.config.Default
+	if n, ok := r.config.Principals[principal]; ok && principal != "" {
+		name = n
+	}
+	r.mu.RLock()
+	if n, ok := r.assigned[principal]; ok && principal != "" {
+		name = n
+	}
+	r.mu.RUnlock()
+	p := r.config.Plans[name]
+	return name, &p
+}
+
+// Assign moves the principal to the plan
+func (r *Registry) Assign(ctx context.Context, principal, name string) error {
+	if _, ok := r.config.Plans[name]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownPlan, name)
+	}
+	if principal == "" {
+		return errors.New("principal cannot be empty")
+	}
+	if r.store != nil {
+		if err := r.store.SetPlanAssignment(ctx, principal, name); err != nil {
+			r.logger.Errorw("failed to save plan assignment", "principal", principal, "plan", name, "error", err)
+			return err
+		}
+	}
+	r.mu.Lock()
+	r.assigned[principal] = name
+	r.mu.Unlock()
+	r.logger.Infow("principal assigned to plan", "principal", principal, "plan", name)
+	return nil
+}
+
+// Allow takes a token from the bucket of the principal for the method if the plan has a rate limit.
+// If the call is not allowed it returns how long to wait before retrying
+func (r *Registry) Allow(name, fullMethod, principal, ip string) (bool, time.Duration) {
+	l, ok := r.limiters[name]
+	if !ok {
+		return true, 0
+	}
+	return l.Allow(fullMethod, principal, ip)
+}
+
+// AllowsMethod reports whether the plan includes the rpc
+func (p *Plan) AllowsMethod(fullMethod string) bool {
+	if len(p.Methods) == 0 {
+		return true
+	}
+	rpc := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	return slices.Contains(p.Methods, fullMethod) || slices.Contains(p.Methods, rpc)
+}
+
+// Voice returns the voice tier to generate audio with: the requested tier if the plan includes it, otherwise the first tier of the plan.
+// It returns false if the plan includes no audio
+func (p *Plan) Voice(requested string) (string, bool) {
+	if len(p.AudioTiers) == 0 {
+		return "", false
+	}
+	if slices.Contains(p.AudioTiers, requested) {
+		return requested, true
+	}
+	return p.AudioTiers[0], true
+}
+
+func (r *Registry) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.refresh(ctx); err != nil {
+				r.logger.Errorw("failed to refresh plan assignments", "error", err)
+			}
+		}
+	}
+}
+
+// refresh reloads the assignments from the store. Assignments to plans that no longer exist are ignored
+func (r *Registry) refresh(ctx context.Context) error {
+	assigned, err := r.store.GetPlanAssignments(ctx)
+	if err != nil {
+		return err
+	}
+	for principal, name := range assigned {
+		if _, ok := r.config.Plans[name]; !ok {
+			r.logger.Errorw("principal assigned to unknown plan", "principal", principal, "plan", name)
+			delete(assigned, principal)
+		}
+	}
+	r.mu.Lock()
+	r.assigned = assigned
+	r.mu.Unlock()
+	r.logger.Debugw("plan assignments refreshed", "assignments", len(assigned))
+	return nil
+}
+
+type contextKey struct{}
+
+// Subscription is the plan of the caller of a request
+type Subscription struct {
+	Name string
+	Plan *Plan
+}
+
+// NewContext returns a copy of ctx carrying the subscription
+func NewContext(ctx context.Context, s *Subscription) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the subscription of the caller if plans are enabled
+func FromContext(ctx context.Context) (*Subscription, bool) {
+	s, ok := ctx.Value(contextKey{}).(*Subscription)
+	return s, ok
+}
@@ -0,0 +1,84 @@
+package plan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type memoryStore map[string]string
+
+func (m memoryStore) GetPlanAssignments(_ context.Context) (map[string]string, error) {
+	assigned := make(map[string]string, len(m))
+	for principal, name := range m {
+		assigned[principal] = name
+	}
+	return assigned, nil
+}
+
+func (m memoryStore) SetPlanAssignment(_ context.Context, principal, name string) error {
+	m[principal] = name
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plans.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"default": "free",
+		"plans": {
+			"free": {"methods": ["Translate"], "rate_limit": {"rate": 1, "burst": 1},
+				"budgets": [{"period": "daily", "limit_micro_usd": 10000}]},
+			"pro": {"audio_tiers": ["Chirp3-HD", "Standard"]},
+			"classroom": {"audio_tiers": ["Standard"]}
+		},
+		"principals": {"api_key:school": "classroom"}
+	}`), 0o600))
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, time.UTC, cfg.Plans["free"].Budgets[0].Location)
+
+	store := memoryStore{"user:paid": "pro", "user:gone": "enterprise"}
+	r, err := New(context.Background(), *cfg, store, 0, zap.NewNop().Sugar())
+	assert.NoError(t, err)
+
+	name, free := r.Lookup("")
+	assert.Equal(t, "free", name)
+	assert.True(t, free.AllowsMethod("/sentencegen.SentenceGen/Translate"))
+	assert.False(t, free.AllowsMethod("/sentencegen.SentenceGen/GenerateSentence"))
+	_, ok := free.Voice("Chirp3-HD")
+	assert.False(t, ok)
+
+	name, _ = r.Lookup("api_key:school")
+	assert.Equal(t, "classroom", name)
+	name, pro := r.Lookup("user:paid")
+	assert.Equal(t, "pro", name)
+	assert.True(t, pro.AllowsMethod("/sentencegen.SentenceGen/GenerateSentence"))
+	//Assignments to plans that were removed fall back to the default
+	name, _ = r.Lookup("user:gone")
+	assert.Equal(t, "free", name)
+
+	_, classroom := r.Lookup("api_key:school")
+	voice, ok := classroom.Voice("Chirp3-HD")
+	assert.True(t, ok)
+	assert.Equal(t, "Standard", voice)
+
+	assert.NoError(t, r.Assign(context.Background(), "api_key:school", "pro"))
+	name, _ = r.Lookup("api_key:school")
+	assert.Equal(t, "pro", name)
+	assert.Equal(t, "pro", store["api_key:school"])
+	assert.ErrorIs(t, r.Assign(context.Background(), "user:a", "enterprise"), ErrUnknownPlan)
+
+	allowed, _ := r.Allow("free", "/sentencegen.SentenceGen/Translate", "user:a", "")
+	assert.True(t, allowed)
+	allowed, _ = r.Allow("free", "/sentencegen.SentenceGen/Translate", "user:a", "")
+	assert.False(t, allowed)
+	allowed, _ = r.Allow("pro", "/sentencegen.SentenceGen/Translate", "user:a", "")
+	assert.True(t, allowed)
+
+	assert.Error(t, (&Config{Default: "missing"}).validate())
+}
@@ -0,0 +1,122 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/tts"
+)
+
+const (
+	chirp3HDVoicePerCharacterPrice = currency.MicroUSD(30)
+	standardVoicePerCharacterPrice = currency.MicroUSD(4)
+)
+
+var (
+	ErrNoPrice = errors.New("no price")
+)
+
+// ModelPrice holds the per token prices of a gemini model from EffectiveFrom on
+type ModelPrice struct {
+	EffectiveFrom time.Time         `json:"effective_from"`
+	Input         currency.MicroUSD `json:"input_micro_usd"`
+	Output        currency.MicroUSD `json:"output_micro_usd"`
+	Cached        currency.MicroUSD `json:"cached_micro_usd"`
+	Thinking      currency.MicroUSD `json:"thinking_micro_usd"`
+}
+
+// VoicePrice holds the per character price of a tts voice tier from EffectiveFrom on
+type VoicePrice struct {
+	EffectiveFrom time.Time         `json:"effective_from"`
+	Character     currency.MicroUSD `json:"character_micro_usd"`
+}
+
+// Table lists the prices of every model and voice tier. A price is valid from its effective date until the next one
+type Table struct {
+	Models map[string][]ModelPrice `json:"models"`
+	Voices map[string][]VoicePrice `json:"voices"`
+}
+
+// Load reads the pricing table from a json file
+func Load(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var t Table
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	t.sort()
+	return &t, nil
+}
+
+// Default returns the table with fixed prices for the gemini model and the list prices of the tts voices.
+// Cached tokens are priced as input and thinking tokens as output, so the cost is never under-counted
+func Default(model string, input, output currency.MicroUSD) *Table {
+	return &Table{
+		Models: map[string][]ModelPrice{
+			model: {{Input: input, Output: output, Cached: input, Thinking: output}},
+		},
+		Voices: map[string][]VoicePrice{
+			tts.Chirp3HD: {{Character: chirp3HDVoicePerCharacterPrice}},
+			tts.Standard: {{Character: standardVoicePerCharacterPrice}},
+		},
+	}
+}
+
+// Model returns the prices of the model valid at the given time
+func (t *Table) Model(model string, at time.Time) (ModelPrice, error) {
+	prices := t.Models[model]
+	//Prices are sorted by effective date, pick the last one already in effect
+	i := sort.Search(len(prices), func(i int) bool { return prices[i].EffectiveFrom.After(at) })
+	if i == 0 {
+		return ModelPrice{}, fmt.Errorf("%w for model %s at %s", ErrNoPrice, model, at.Format(time.RFC3339))
+	}
+	return prices[i-1], nil
+}
+
+// Voice returns the price of the voice tier valid at the given time
+func (t *Table) Voice(tier string, at time.Time) (VoicePrice, error) {
+	prices := t.Voices[tier]
+	i := sort.Search(len(prices), func(i int) bool { return prices[i].EffectiveFrom.After(at) })
+	if i == 0 {
+		return VoicePrice{}, fmt.Errorf("%w for voice %s at %s", ErrNoPrice, tier, at.Format(time.RFC3339))
+	}
+	return prices[i-1], nil
+}
+
+func (t *Table) validate() error {
+	for model, prices := range t.Models {
+		for _, p := range prices {
+			if p.Input < 0 || p.Output < 0 || p.Cached < 0 || p.Thinking < 0 {
+				return fmt.Errorf("negative price for model %s", model)
+			}
+		}
+	}
+	for tier, prices := range t.Voices {
+		for _, p := range prices {
+			if p.Character < 0 {
+				return fmt.Errorf("negative price for voice %s", tier)
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Table) sort() {
+	for _, prices := range t.Models {
+		sort.Slice(prices, func(i, j int) bool { return prices[i].EffectiveFrom.Before(prices[j].EffectiveFrom) })
+	}
+	for _, prices := range t.Voices {
+		sort.Slice(prices, func(i, j int) bool { return prices[i].EffectiveFrom.Before(prices[j].EffectiveFrom) })
+	}
+}
@@ -0,0 +1,49 @@
+package pricing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable_Model(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"models": {
+			"gemini-pro": [
+				{"effective_from": "2026-06-01T00:00:00Z", "input_micro_usd": 3, "output_micro_usd": 15},
+				{"effective_from": "2026-01-01T00:00:00Z", "input_micro_usd": 2, "output_micro_usd": 12}
+			]
+		},
+		"voices": {
+			"Chirp3-HD": [{"effective_from": "2026-01-01T00:00:00Z", "character_micro_usd": 30}]
+		}
+	}`), 0o600))
+
+	table, err := Load(path)
+	assert.NoError(t, err)
+
+	//Before the first price there is nothing to charge with
+	_, err = table.Model("gemini-pro", time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC))
+	assert.ErrorIs(t, err, ErrNoPrice)
+
+	price, err := table.Model("gemini-pro", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, currency.MicroUSD(2), price.Input)
+
+	//The new price applies from its effective date on
+	price, err = table.Model("gemini-pro", time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, currency.MicroUSD(15), price.Output)
+
+	_, err = table.Model("gemini-flash", time.Now())
+	assert.ErrorIs(t, err, ErrNoPrice)
+
+	voice, err := table.Voice("Chirp3-HD", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, currency.MicroUSD(30), voice.Character)
+}
@@ -0,0 +1,838 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v5.29.3
+// source: proto/admin.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SpendingReportRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StartDate     string                 `protobuf:"bytes,1,opt,name=start_date,json=startDate,proto3" json:"start_date,omitempty"` //first UTC day, YYYY-MM-DD
+	EndDate       string                 `protobuf:"bytes,2,opt,name=end_date,json=endDate,proto3" json:"end_date,omitempty"`       //last UTC day, YYYY-MM-DD, inclusive
+	Currency      string                 `protobuf:"bytes,3,opt,name=currency,proto3" json:"currency,omitempty"`                    //ISO 4217 code of the display amounts, USD if empty
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SpendingReportRequest) Reset() {
+	*x = SpendingReportRequest{}
+	mi := &file_proto_admin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SpendingReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SpendingReportRequest) ProtoMessage() {}
+
+func (x *SpendingReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SpendingReportRequest.ProtoReflect.Descriptor instead.
+func (*SpendingReportRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SpendingReportRequest) GetStartDate() string {
+	if x != nil {
+		return x.StartDate
+	}
+	return ""
+}
+
+func (x *SpendingReportRequest) GetEndDate() string {
+	if x != nil {
+		return x.EndDate
+	}
+	return ""
+}
+
+func (x *SpendingReportRequest) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+type Usage struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	AmountMicroUsd int64                  `protobuf:"varint,1,opt,name=amount_micro_usd,json=amountMicroUsd,proto3" json:"amount_micro_usd,omitempty"`
+	Requests       int64                  `protobuf:"varint,2,opt,name=requests,proto3" json:"requests,omitempty"`
+	InputTokens    int64                  `protobuf:"varint,3,opt,name=input_tokens,json=inputTokens,proto3" json:"input_tokens,omitempty"`
+	OutputTokens   int64                  `protobuf:"varint,4,opt,name=output_tokens,json=outputTokens,proto3" json:"output_tokens,omitempty"`
+	CachedTokens   int64                  `protobuf:"varint,5,opt,name=cached_tokens,json=cachedTokens,proto3" json:"cached_tokens,omitempty"`
+	ToolUseTokens  int64                  `protobuf:"varint,6,opt,name=tool_use_tokens,json=toolUseTokens,proto3" json:"tool_use_tokens,omitempty"`
+	ThinkingTokens int64                  `protobuf:"varint,7,opt,name=thinking_tokens,json=thinkingTokens,proto3" json:"thinking_tokens,omitempty"`
+	Characters     int64                  `protobuf:"varint,8,opt,name=characters,proto3" json:"characters,omitempty"`
+	DisplayAmount  string                 `protobuf:"bytes,9,opt,name=display_amount,json=displayAmount,proto3" json:"display_amount,omitempty"` //amount in the report currency, e.g. "$4.90"
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Usage) Reset() {
+	*x = Usage{}
+	mi := &file_proto_admin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Usage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Usage) ProtoMessage() {}
+
+func (x *Usage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Usage.ProtoReflect.Descriptor instead.
+func (*Usage) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Usage) GetAmountMicroUsd() int64 {
+	if x != nil {
+		return x.AmountMicroUsd
+	}
+	return 0
+}
+
+func (x *Usage) GetRequests() int64 {
+	if x != nil {
+		return x.Requests
+	}
+	return 0
+}
+
+func (x *Usage) GetInputTokens() int64 {
+	if x != nil {
+		return x.InputTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetOutputTokens() int64 {
+	if x != nil {
+		return x.OutputTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetCachedTokens() int64 {
+	if x != nil {
+		return x.CachedTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetToolUseTokens() int64 {
+	if x != nil {
+		return x.ToolUseTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetThinkingTokens() int64 {
+	if x != nil {
+		return x.ThinkingTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetCharacters() int64 {
+	if x != nil {
+		return x.Characters
+	}
+	return 0
+}
+
+func (x *Usage) GetDisplayAmount() string {
+	if x != nil {
+		return x.DisplayAmount
+	}
+	return ""
+}
+
+type Spending struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Total         *Usage                 `protobuf:"bytes,1,opt,name=total,proto3" json:"total,omitempty"`
+	Operations    map[string]*Usage      `protobuf:"bytes,2,rep,name=operations,proto3" json:"operations,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Models        map[string]*Usage      `protobuf:"bytes,3,rep,name=models,proto3" json:"models,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Voices        map[string]*Usage      `protobuf:"bytes,4,rep,name=voices,proto3" json:"voices,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` //by tts voice tier
+	Principals    map[string]*Usage      `protobuf:"bytes,5,rep,name=principals,proto3" json:"principals,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Spending) Reset() {
+	*x = Spending{}
+	mi := &file_proto_admin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Spending) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Spending) ProtoMessage() {}
+
+func (x *Spending) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Spending.ProtoReflect.Descriptor instead.
+func (*Spending) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Spending) GetTotal() *Usage {
+	if x != nil {
+		return x.Total
+	}
+	return nil
+}
+
+func (x *Spending) GetOperations() map[string]*Usage {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+func (x *Spending) GetModels() map[string]*Usage {
+	if x != nil {
+		return x.Models
+	}
+	return nil
+}
+
+func (x *Spending) GetVoices() map[string]*Usage {
+	if x != nil {
+		return x.Voices
+	}
+	return nil
+}
+
+func (x *Spending) GetPrincipals() map[string]*Usage {
+	if x != nil {
+		return x.Principals
+	}
+	return nil
+}
+
+type DaySpending struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Date          string                 `protobuf:"bytes,1,opt,name=date,proto3" json:"date,omitempty"`
+	Spending      *Spending              `protobuf:"bytes,2,opt,name=spending,proto3" json:"spending,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DaySpending) Reset() {
+	*x = DaySpending{}
+	mi := &file_proto_admin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DaySpending) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DaySpending) ProtoMessage() {}
+
+func (x *DaySpending) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DaySpending.ProtoReflect.Descriptor instead.
+func (*DaySpending) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DaySpending) GetDate() string {
+	if x != nil {
+		return x.Date
+	}
+	return ""
+}
+
+func (x *DaySpending) GetSpending() *Spending {
+	if x != nil {
+		return x.Spending
+	}
+	return nil
+}
+
+type BudgetStatus struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Period            string                 `protobuf:"bytes,1,opt,name=period,proto3" json:"period,omitempty"`
+	TimeZone          string                 `protobuf:"bytes,2,opt,name=time_zone,json=timeZone,proto3" json:"time_zone,omitempty"`
+	LimitMicroUsd     int64                  `protobuf:"varint,3,opt,name=limit_micro_usd,json=limitMicroUsd,proto3" json:"limit_micro_usd,omitempty"`
+	SpentMicroUsd     int64                  `protobuf:"varint,4,opt,name=spent_micro_usd,json=spentMicroUsd,proto3" json:"spent_micro_usd,omitempty"`
+	ReservedMicroUsd  int64                  `protobuf:"varint,5,opt,name=reserved_micro_usd,json=reservedMicroUsd,proto3" json:"reserved_micro_usd,omitempty"`
+	RemainingMicroUsd int64                  `protobuf:"varint,6,opt,name=remaining_micro_usd,json=remainingMicroUsd,proto3" json:"remaining_micro_usd,omitempty"`
+	ResetsAt          *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=resets_at,json=resetsAt,proto3" json:"resets_at,omitempty"`
+	DisplayLimit      string                 `protobuf:"bytes,8,opt,name=display_limit,json=displayLimit,proto3" json:"display_limit,omitempty"`
+	DisplaySpent      string                 `protobuf:"bytes,9,opt,name=display_spent,json=displaySpent,proto3" json:"display_spent,omitempty"`
+	DisplayRemaining  string                 `protobuf:"bytes,10,opt,name=display_remaining,json=displayRemaining,proto3" json:"display_remaining,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *BudgetStatus) Reset() {
+	*x = BudgetStatus{}
+	mi := &file_proto_admin_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BudgetStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BudgetStatus) ProtoMessage() {}
+
+func (x *BudgetStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BudgetStatus.ProtoReflect.Descriptor instead.
+func (*BudgetStatus) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BudgetStatus) GetPeriod() string {
+	if x != nil {
+		return x.Period
+	}
+	return ""
+}
+
+func (x *BudgetStatus) GetTimeZone() string {
+	if x != nil {
+		return x.TimeZone
+	}
+	return ""
+}
+
+func (x *BudgetStatus) GetLimitMicroUsd() int64 {
+	if x != nil {
+		return x.LimitMicroUsd
+	}
+	return 0
+}
+
+func (x *BudgetStatus) GetSpentMicroUsd() int64 {
+	if x != nil {
+		return x.SpentMicroUsd
+	}
+	return 0
+}
+
+func (x *BudgetStatus) GetReservedMicroUsd() int64 {
+	if x != nil {
+		return x.ReservedMicroUsd
+	}
+	return 0
+}
+
+func (x *BudgetStatus) GetRemainingMicroUsd() int64 {
+	if x != nil {
+		return x.RemainingMicroUsd
+	}
+	return 0
+}
+
+func (x *BudgetStatus) GetResetsAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ResetsAt
+	}
+	return nil
+}
+
+func (x *BudgetStatus) GetDisplayLimit() string {
+	if x != nil {
+		return x.DisplayLimit
+	}
+	return ""
+}
+
+func (x *BudgetStatus) GetDisplaySpent() string {
+	if x != nil {
+		return x.DisplaySpent
+	}
+	return ""
+}
+
+func (x *BudgetStatus) GetDisplayRemaining() string {
+	if x != nil {
+		return x.DisplayRemaining
+	}
+	return ""
+}
+
+type SpendingReportResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Days          []*DaySpending         `protobuf:"bytes,1,rep,name=days,proto3" json:"days,omitempty"`
+	Total         *Spending              `protobuf:"bytes,2,opt,name=total,proto3" json:"total,omitempty"`
+	Budgets       []*BudgetStatus        `protobuf:"bytes,3,rep,name=budgets,proto3" json:"budgets,omitempty"` //current period of every budget window
+	Currency      string                 `protobuf:"bytes,4,opt,name=currency,proto3" json:"currency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SpendingReportResponse) Reset() {
+	*x = SpendingReportResponse{}
+	mi := &file_proto_admin_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SpendingReportResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SpendingReportResponse) ProtoMessage() {}
+
+func (x *SpendingReportResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SpendingReportResponse.ProtoReflect.Descriptor instead.
+func (*SpendingReportResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SpendingReportResponse) GetDays() []*DaySpending {
+	if x != nil {
+		return x.Days
+	}
+	return nil
+}
+
+func (x *SpendingReportResponse) GetTotal() *Spending {
+	if x != nil {
+		return x.Total
+	}
+	return nil
+}
+
+func (x *SpendingReportResponse) GetBudgets() []*BudgetStatus {
+	if x != nil {
+		return x.Budgets
+	}
+	return nil
+}
+
+func (x *SpendingReportResponse) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+type SetPrincipalPlanRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Principal     string                 `protobuf:"bytes,1,opt,name=principal,proto3" json:"principal,omitempty"` //"kind:name", e.g. api_key:school or user:<subject>
+	Plan          string                 `protobuf:"bytes,2,opt,name=plan,proto3" json:"plan,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetPrincipalPlanRequest) Reset() {
+	*x = SetPrincipalPlanRequest{}
+	mi := &file_proto_admin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetPrincipalPlanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetPrincipalPlanRequest) ProtoMessage() {}
+
+func (x *SetPrincipalPlanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetPrincipalPlanRequest.ProtoReflect.Descriptor instead.
+func (*SetPrincipalPlanRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SetPrincipalPlanRequest) GetPrincipal() string {
+	if x != nil {
+		return x.Principal
+	}
+	return ""
+}
+
+func (x *SetPrincipalPlanRequest) GetPlan() string {
+	if x != nil {
+		return x.Plan
+	}
+	return ""
+}
+
+type SetPrincipalPlanResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetPrincipalPlanResponse) Reset() {
+	*x = SetPrincipalPlanResponse{}
+	mi := &file_proto_admin_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetPrincipalPlanResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetPrincipalPlanResponse) ProtoMessage() {}
+
+func (x *SetPrincipalPlanResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetPrincipalPlanResponse.ProtoReflect.Descriptor instead.
+func (*SetPrincipalPlanResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{7}
+}
+
+type GetPrincipalPlanRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Principal     string                 `protobuf:"bytes,1,opt,name=principal,proto3" json:"principal,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPrincipalPlanRequest) Reset() {
+	*x = GetPrincipalPlanRequest{}
+	mi := &file_proto_admin_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPrincipalPlanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPrincipalPlanRequest) ProtoMessage() {}
+
+func (x *GetPrincipalPlanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPrincipalPlanRequest.ProtoReflect.Descriptor instead.
+func (*GetPrincipalPlanRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetPrincipalPlanRequest) GetPrincipal() string {
+	if x != nil {
+		return x.Principal
+	}
+	return ""
+}
+
+type GetPrincipalPlanResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Plan          string                 `protobuf:"bytes,1,opt,name=plan,proto3" json:"plan,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPrincipalPlanResponse) Reset() {
+	*x = GetPrincipalPlanResponse{}
+	mi := &file_proto_admin_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPrincipalPlanResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPrincipalPlanResponse) ProtoMessage() {}
+
+func (x *GetPrincipalPlanResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPrincipalPlanResponse.ProtoReflect.Descriptor instead.
+func (*GetPrincipalPlanResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetPrincipalPlanResponse) GetPlan() string {
+	if x != nil {
+		return x.Plan
+	}
+	return ""
+}
+
+var File_proto_admin_proto protoreflect.FileDescriptor
+
+const file_proto_admin_proto_rawDesc = "" +
+	"\n" +
+	"\x11proto/admin.proto\x12\vsentencegen\x1a\x1fgoogle/protobuf/timestamp.proto\"m\n" +
+	"\x15SpendingReportRequest\x12\x1d\n" +
+	"\n" +
+	"start_date\x18\x01 \x01(\tR\tstartDate\x12\x19\n" +
+	"\bend_date\x18\x02 \x01(\tR\aendDate\x12\x1a\n" +
+	"\bcurrency\x18\x03 \x01(\tR\bcurrency\"\xd2\x02\n" +
+	"\x05Usage\x12(\n" +
+	"\x10amount_micro_usd\x18\x01 \x01(\x03R\x0eamountMicroUsd\x12\x1a\n" +
+	"\brequests\x18\x02 \x01(\x03R\brequests\x12!\n" +
+	"\finput_tokens\x18\x03 \x01(\x03R\vinputTokens\x12#\n" +
+	"\routput_tokens\x18\x04 \x01(\x03R\foutputTokens\x12#\n" +
+	"\rcached_tokens\x18\x05 \x01(\x03R\fcachedTokens\x12&\n" +
+	"\x0ftool_use_tokens\x18\x06 \x01(\x03R\rtoolUseTokens\x12'\n" +
+	"\x0fthinking_tokens\x18\a \x01(\x03R\x0ethinkingTokens\x12\x1e\n" +
+	"\n" +
+	"characters\x18\b \x01(\x03R\n" +
+	"characters\x12%\n" +
+	"\x0edisplay_amount\x18\t \x01(\tR\rdisplayAmount\"\xfc\x04\n" +
+	"\bSpending\x12(\n" +
+	"\x05total\x18\x01 \x01(\v2\x12.sentencegen.UsageR\x05total\x12E\n" +
+	"\n" +
+	"operations\x18\x02 \x03(\v2%.sentencegen.Spending.OperationsEntryR\n" +
+	"operations\x129\n" +
+	"\x06models\x18\x03 \x03(\v2!.sentencegen.Spending.ModelsEntryR\x06models\x129\n" +
+	"\x06voices\x18\x04 \x03(\v2!.sentencegen.Spending.VoicesEntryR\x06voices\x12E\n" +
+	"\n" +
+	"principals\x18\x05 \x03(\v2%.sentencegen.Spending.PrincipalsEntryR\n" +
+	"principals\x1aQ\n" +
+	"\x0fOperationsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12(\n" +
+	"\x05value\x18\x02 \x01(\v2\x12.sentencegen.UsageR\x05value:\x028\x01\x1aM\n" +
+	"\vModelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12(\n" +
+	"\x05value\x18\x02 \x01(\v2\x12.sentencegen.UsageR\x05value:\x028\x01\x1aM\n" +
+	"\vVoicesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12(\n" +
+	"\x05value\x18\x02 \x01(\v2\x12.sentencegen.UsageR\x05value:\x028\x01\x1aQ\n" +
+	"\x0fPrincipalsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12(\n" +
+	"\x05value\x18\x02 \x01(\v2\x12.sentencegen.UsageR\x05value:\x028\x01\"T\n" +
+	"\vDaySpending\x12\x12\n" +
+	"\x04date\x18\x01 \x01(\tR\x04date\x121\n" +
+	"\bspending\x18\x02 \x01(\v2\x15.sentencegen.SpendingR\bspending\"\xa1\x03\n" +
+	"\fBudgetStatus\x12\x16\n" +
+	"\x06period\x18\x01 \x01(\tR\x06period\x12\x1b\n" +
+	"\ttime_zone\x18\x02 \x01(\tR\btimeZone\x12&\n" +
+	"\x0flimit_micro_usd\x18\x03 \x01(\x03R\rlimitMicroUsd\x12&\n" +
+	"\x0fspent_micro_usd\x18\x04 \x01(\x03R\rspentMicroUsd\x12,\n" +
+	"\x12reserved_micro_usd\x18\x05 \x01(\x03R\x10reservedMicroUsd\x12.\n" +
+	"\x13remaining_micro_usd\x18\x06 \x01(\x03R\x11remainingMicroUsd\x127\n" +
+	"\tresets_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\bresetsAt\x12#\n" +
+	"\rdisplay_limit\x18\b \x01(\tR\fdisplayLimit\x12#\n" +
+	"\rdisplay_spent\x18\t \x01(\tR\fdisplaySpent\x12+\n" +
+	"\x11display_remaining\x18\n" +
+	" \x01(\tR\x10displayRemaining\"\xc4\x01\n" +
+	"\x16SpendingReportResponse\x12,\n" +
+	"\x04days\x18\x01 \x03(\v2\x18.sentencegen.DaySpendingR\x04days\x12+\n" +
+	"\x05total\x18\x02 \x01(\v2\x15.sentencegen.SpendingR\x05total\x123\n" +
+	"\abudgets\x18\x03 \x03(\v2\x19.sentencegen.BudgetStatusR\abudgets\x12\x1a\n" +
+	"\bcurrency\x18\x04 \x01(\tR\bcurrency\"K\n" +
+	"\x17SetPrincipalPlanRequest\x12\x1c\n" +
+	"\tprincipal\x18\x01 \x01(\tR\tprincipal\x12\x12\n" +
+	"\x04plan\x18\x02 \x01(\tR\x04plan\"\x1a\n" +
+	"\x18SetPrincipalPlanResponse\"7\n" +
+	"\x17GetPrincipalPlanRequest\x12\x1c\n" +
+	"\tprincipal\x18\x01 \x01(\tR\tprincipal\".\n" +
+	"\x18GetPrincipalPlanResponse\x12\x12\n" +
+	"\x04plan\x18\x01 \x01(\tR\x04plan2\xa7\x02\n" +
+	"\x05Admin\x12\\\n" +
+	"\x11GetSpendingReport\x12\".sentencegen.SpendingReportRequest\x1a#.sentencegen.SpendingReportResponse\x12_\n" +
+	"\x10SetPrincipalPlan\x12$.sentencegen.SetPrincipalPlanRequest\x1a%.sentencegen.SetPrincipalPlanResponse\x12_\n" +
+	"\x10GetPrincipalPlan\x12$.sentencegen.GetPrincipalPlanRequest\x1a%.sentencegen.GetPrincipalPlanResponseB\x0eZ\fclient/protob\x06proto3"
+
+var (
+	file_proto_admin_proto_rawDescOnce sync.Once
+	file_proto_admin_proto_rawDescData []byte
+)
+
+func file_proto_admin_proto_rawDescGZIP() []byte {
+	file_proto_admin_proto_rawDescOnce.Do(func() {
+		file_proto_admin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_admin_proto_rawDesc), len(file_proto_admin_proto_rawDesc)))
+	})
+	return file_proto_admin_proto_rawDescData
+}
+
+var file_proto_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_proto_admin_proto_goTypes = []any{
+	(*SpendingReportRequest)(nil),    // 0: sentencegen.SpendingReportRequest
+	(*Usage)(nil),                    // 1: sentencegen.Usage
+	(*Spending)(nil),                 // 2: sentencegen.Spending
+	(*DaySpending)(nil),              // 3: sentencegen.DaySpending
+	(*BudgetStatus)(nil),             // 4: sentencegen.BudgetStatus
+	(*SpendingReportResponse)(nil),   // 5: sentencegen.SpendingReportResponse
+	(*SetPrincipalPlanRequest)(nil),  // 6: sentencegen.SetPrincipalPlanRequest
+	(*SetPrincipalPlanResponse)(nil), // 7: sentencegen.SetPrincipalPlanResponse
+	(*GetPrincipalPlanRequest)(nil),  // 8: sentencegen.GetPrincipalPlanRequest
+	(*GetPrincipalPlanResponse)(nil), // 9: sentencegen.GetPrincipalPlanResponse
+	nil,                              // 10: sentencegen.Spending.OperationsEntry
+	nil,                              // 11: sentencegen.Spending.ModelsEntry
+	nil,                              // 12: sentencegen.Spending.VoicesEntry
+	nil,                              // 13: sentencegen.Spending.PrincipalsEntry
+	(*timestamppb.Timestamp)(nil),    // 14: google.protobuf.Timestamp
+}
+var file_proto_admin_proto_depIdxs = []int32{
+	1,  // 0: sentencegen.Spending.total:type_name -> sentencegen.Usage
+	10, // 1: sentencegen.Spending.operations:type_name -> sentencegen.Spending.OperationsEntry
+	11, // 2: sentencegen.Spending.models:type_name -> sentencegen.Spending.ModelsEntry
+	12, // 3: sentencegen.Spending.voices:type_name -> sentencegen.Spending.VoicesEntry
+	13, // 4: sentencegen.Spending.principals:type_name -> sentencegen.Spending.PrincipalsEntry
+	2,  // 5: sentencegen.DaySpending.spending:type_name -> sentencegen.Spending
+	14, // 6: sentencegen.BudgetStatus.resets_at:type_name -> google.protobuf.Timestamp
+	3,  // 7: sentencegen.SpendingReportResponse.days:type_name -> sentencegen.DaySpending
+	2,  // 8: sentencegen.SpendingReportResponse.total:type_name -> sentencegen.Spending
+	4,  // 9: sentencegen.SpendingReportResponse.budgets:type_name -> sentencegen.BudgetStatus
+	1,  // 10: sentencegen.Spending.OperationsEntry.value:type_name -> sentencegen.Usage
+	1,  // 11: sentencegen.Spending.ModelsEntry.value:type_name -> sentencegen.Usage
+	1,  // 12: sentencegen.Spending.VoicesEntry.value:type_name -> sentencegen.Usage
+	1,  // 13: sentencegen.Spending.PrincipalsEntry.value:type_name -> sentencegen.Usage
+	0,  // 14: sentencegen.Admin.GetSpendingReport:input_type -> sentencegen.SpendingReportRequest
+	6,  // 15: sentencegen.Admin.SetPrincipalPlan:input_type -> sentencegen.SetPrincipalPlanRequest
+	8,  // 16: sentencegen.Admin.GetPrincipalPlan:input_type -> sentencegen.GetPrincipalPlanRequest
+	5,  // 17: sentencegen.Admin.GetSpendingReport:output_type -> sentencegen.SpendingReportResponse
+	7,  // 18: sentencegen.Admin.SetPrincipalPlan:output_type -> sentencegen.SetPrincipalPlanResponse
+	9,  // 19: sentencegen.Admin.GetPrincipalPlan:output_type -> sentencegen.GetPrincipalPlanResponse
+	17, // [17:20] is the sub-list for method output_type
+	14, // [14:17] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
+}
+
+func init() { file_proto_admin_proto_init() }
+func file_proto_admin_proto_init() {
+	if File_proto_admin_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_admin_proto_rawDesc), len(file_proto_admin_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_admin_proto_goTypes,
+		DependencyIndexes: file_proto_admin_proto_depIdxs,
+		MessageInfos:      file_proto_admin_proto_msgTypes,
+	}.Build()
+	File_proto_admin_proto = out.File
+	file_proto_admin_proto_goTypes = nil
+	file_proto_admin_proto_depIdxs = nil
+}
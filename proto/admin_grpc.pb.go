@@ -0,0 +1,197 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: proto/admin.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Admin_GetSpendingReport_FullMethodName = "/sentencegen.Admin/GetSpendingReport"
+	Admin_SetPrincipalPlan_FullMethodName  = "/sentencegen.Admin/SetPrincipalPlan"
+	Admin_GetPrincipalPlan_FullMethodName  = "/sentencegen.Admin/GetPrincipalPlan"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	GetSpendingReport(ctx context.Context, in *SpendingReportRequest, opts ...grpc.CallOption) (*SpendingReportResponse, error)
+	SetPrincipalPlan(ctx context.Context, in *SetPrincipalPlanRequest, opts ...grpc.CallOption) (*SetPrincipalPlanResponse, error)
+	GetPrincipalPlan(ctx context.Context, in *GetPrincipalPlanRequest, opts ...grpc.CallOption) (*GetPrincipalPlanResponse, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) GetSpendingReport(ctx context.Context, in *SpendingReportRequest, opts ...grpc.CallOption) (*SpendingReportResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SpendingReportResponse)
+	err := c.cc.Invoke(ctx, Admin_GetSpendingReport_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetPrincipalPlan(ctx context.Context, in *SetPrincipalPlanRequest, opts ...grpc.CallOption) (*SetPrincipalPlanResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetPrincipalPlanResponse)
+	err := c.cc.Invoke(ctx, Admin_SetPrincipalPlan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetPrincipalPlan(ctx context.Context, in *GetPrincipalPlanRequest, opts ...grpc.CallOption) (*GetPrincipalPlanResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetPrincipalPlanResponse)
+	err := c.cc.Invoke(ctx, Admin_GetPrincipalPlan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility.
+type AdminServer interface {
+	GetSpendingReport(context.Context, *SpendingReportRequest) (*SpendingReportResponse, error)
+	SetPrincipalPlan(context.Context, *SetPrincipalPlanRequest) (*SetPrincipalPlanResponse, error)
+	GetPrincipalPlan(context.Context, *GetPrincipalPlanRequest) (*GetPrincipalPlanResponse, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAdminServer struct{}
+
+func (UnimplementedAdminServer) GetSpendingReport(context.Context, *SpendingReportRequest) (*SpendingReportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSpendingReport not implemented")
+}
+func (UnimplementedAdminServer) SetPrincipalPlan(context.Context, *SetPrincipalPlanRequest) (*SetPrincipalPlanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetPrincipalPlan not implemented")
+}
+func (UnimplementedAdminServer) GetPrincipalPlan(context.Context, *GetPrincipalPlanRequest) (*GetPrincipalPlanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPrincipalPlan not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+func (UnimplementedAdminServer) testEmbeddedByValue()               {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	// If the following call pancis, it indicates UnimplementedAdminServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_GetSpendingReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SpendingReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetSpendingReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetSpendingReport_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetSpendingReport(ctx, req.(*SpendingReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetPrincipalPlan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetPrincipalPlanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetPrincipalPlan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_SetPrincipalPlan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetPrincipalPlan(ctx, req.(*SetPrincipalPlanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetPrincipalPlan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPrincipalPlanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetPrincipalPlan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetPrincipalPlan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetPrincipalPlan(ctx, req.(*GetPrincipalPlanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sentencegen.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetSpendingReport",
+			Handler:    _Admin_GetSpendingReport_Handler,
+		},
+		{
+			MethodName: "SetPrincipalPlan",
+			Handler:    _Admin_SetPrincipalPlan_Handler,
+		},
+		{
+			MethodName: "GetPrincipalPlan",
+			Handler:    _Admin_GetPrincipalPlan_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/admin.proto",
+}
@@ -9,6 +9,7 @@ package proto
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -67,6 +68,83 @@ func (Gender) EnumDescriptor() ([]byte, []int) {
 	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{0}
 }
 
+// ErrorReason is the reason of the google.rpc.ErrorInfo detail of failed calls, the names are stable
+type ErrorReason int32
+
+const (
+	ErrorReason_ERROR_REASON_UNSPECIFIED ErrorReason = 0
+	ErrorReason_INVALID_REQUEST          ErrorReason = 1  //with a google.rpc.BadRequest detail of the invalid fields
+	ErrorReason_UNSUPPORTED_LANGUAGE     ErrorReason = 2  //a language code isn't a BCP 47 tag or doesn't name a language, with a google.rpc.BadRequest detail
+	ErrorReason_WORD_NOT_FOUND           ErrorReason = 3  //the word doesn't exist in the language
+	ErrorReason_NO_VOICE                 ErrorReason = 4  //no voice for the language, gender and voice tier
+	ErrorReason_NOT_IN_PLAN              ErrorReason = 5  //the rpc or the audio isn't included in the caller's plan
+	ErrorReason_BUDGET_EXHAUSTED         ErrorReason = 6  //with google.rpc.QuotaFailure and google.rpc.RetryInfo until the budget resets
+	ErrorReason_RATE_LIMITED             ErrorReason = 7  //with a google.rpc.RetryInfo detail
+	ErrorReason_UPSTREAM_THROTTLED       ErrorReason = 8  //gemini or tts throttled the call, with a google.rpc.RetryInfo detail
+	ErrorReason_UPSTREAM_UNAVAILABLE     ErrorReason = 9  //gemini or tts is down, with a google.rpc.RetryInfo detail
+	ErrorReason_DEADLINE_EXCEEDED        ErrorReason = 10 //gemini or tts didn't answer in time
+	ErrorReason_INTERNAL                 ErrorReason = 11
+)
+
+// Enum value maps for ErrorReason.
+var (
+	ErrorReason_name = map[int32]string{
+		0:  "ERROR_REASON_UNSPECIFIED",
+		1:  "INVALID_REQUEST",
+		2:  "UNSUPPORTED_LANGUAGE",
+		3:  "WORD_NOT_FOUND",
+		4:  "NO_VOICE",
+		5:  "NOT_IN_PLAN",
+		6:  "BUDGET_EXHAUSTED",
+		7:  "RATE_LIMITED",
+		8:  "UPSTREAM_THROTTLED",
+		9:  "UPSTREAM_UNAVAILABLE",
+		10: "DEADLINE_EXCEEDED",
+		11: "INTERNAL",
+	}
+	ErrorReason_value = map[string]int32{
+		"ERROR_REASON_UNSPECIFIED": 0,
+		"INVALID_REQUEST":          1,
+		"UNSUPPORTED_LANGUAGE":     2,
+		"WORD_NOT_FOUND":           3,
+		"NO_VOICE":                 4,
+		"NOT_IN_PLAN":              5,
+		"BUDGET_EXHAUSTED":         6,
+		"RATE_LIMITED":             7,
+		"UPSTREAM_THROTTLED":       8,
+		"UPSTREAM_UNAVAILABLE":     9,
+		"DEADLINE_EXCEEDED":        10,
+		"INTERNAL":                 11,
+	}
+)
+
+func (x ErrorReason) Enum() *ErrorReason {
+	p := new(ErrorReason)
+	*p = x
+	return p
+}
+
+func (x ErrorReason) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ErrorReason) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_sentence_gen_proto_enumTypes[1].Descriptor()
+}
+
+func (ErrorReason) Type() protoreflect.EnumType {
+	return &file_proto_sentence_gen_proto_enumTypes[1]
+}
+
+func (x ErrorReason) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ErrorReason.Descriptor instead.
+func (ErrorReason) EnumDescriptor() ([]byte, []int) {
+	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{1}
+}
+
 type Audio struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
@@ -111,6 +189,275 @@ func (x *Audio) GetData() []byte {
 	return nil
 }
 
+type RemainingBudget struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Period            string                 `protobuf:"bytes,1,opt,name=period,proto3" json:"period,omitempty"`
+	TimeZone          string                 `protobuf:"bytes,2,opt,name=time_zone,json=timeZone,proto3" json:"time_zone,omitempty"`
+	RemainingMicroUsd int64                  `protobuf:"varint,3,opt,name=remaining_micro_usd,json=remainingMicroUsd,proto3" json:"remaining_micro_usd,omitempty"` //after this call
+	ResetsAt          *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=resets_at,json=resetsAt,proto3" json:"resets_at,omitempty"`
+	Plan              string                 `protobuf:"bytes,5,opt,name=plan,proto3" json:"plan,omitempty"` //set for the budgets of the caller's plan
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *RemainingBudget) Reset() {
+	*x = RemainingBudget{}
+	mi := &file_proto_sentence_gen_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemainingBudget) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemainingBudget) ProtoMessage() {}
+
+func (x *RemainingBudget) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sentence_gen_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemainingBudget.ProtoReflect.Descriptor instead.
+func (*RemainingBudget) Descriptor() ([]byte, []int) {
+	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RemainingBudget) GetPeriod() string {
+	if x != nil {
+		return x.Period
+	}
+	return ""
+}
+
+func (x *RemainingBudget) GetTimeZone() string {
+	if x != nil {
+		return x.TimeZone
+	}
+	return ""
+}
+
+func (x *RemainingBudget) GetRemainingMicroUsd() int64 {
+	if x != nil {
+		return x.RemainingMicroUsd
+	}
+	return 0
+}
+
+func (x *RemainingBudget) GetResetsAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ResetsAt
+	}
+	return nil
+}
+
+func (x *RemainingBudget) GetPlan() string {
+	if x != nil {
+		return x.Plan
+	}
+	return ""
+}
+
+type CallUsage struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CostMicroUsd   int64                  `protobuf:"varint,1,opt,name=cost_micro_usd,json=costMicroUsd,proto3" json:"cost_micro_usd,omitempty"`
+	Model          string                 `protobuf:"bytes,2,opt,name=model,proto3" json:"model,omitempty"` //gemini model
+	InputTokens    int64                  `protobuf:"varint,3,opt,name=input_tokens,json=inputTokens,proto3" json:"input_tokens,omitempty"`
+	CachedTokens   int64                  `protobuf:"varint,4,opt,name=cached_tokens,json=cachedTokens,proto3" json:"cached_tokens,omitempty"`
+	ToolUseTokens  int64                  `protobuf:"varint,5,opt,name=tool_use_tokens,json=toolUseTokens,proto3" json:"tool_use_tokens,omitempty"`
+	OutputTokens   int64                  `protobuf:"varint,6,opt,name=output_tokens,json=outputTokens,proto3" json:"output_tokens,omitempty"`
+	ThinkingTokens int64                  `protobuf:"varint,7,opt,name=thinking_tokens,json=thinkingTokens,proto3" json:"thinking_tokens,omitempty"`
+	Voice          string                 `protobuf:"bytes,8,opt,name=voice,proto3" json:"voice,omitempty"` //tts voice tier, empty without audio
+	Characters     int64                  `protobuf:"varint,9,opt,name=characters,proto3" json:"characters,omitempty"`
+	Budgets        []*RemainingBudget     `protobuf:"bytes,10,rep,name=budgets,proto3" json:"budgets,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CallUsage) Reset() {
+	*x = CallUsage{}
+	mi := &file_proto_sentence_gen_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CallUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CallUsage) ProtoMessage() {}
+
+func (x *CallUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sentence_gen_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CallUsage.ProtoReflect.Descriptor instead.
+func (*CallUsage) Descriptor() ([]byte, []int) {
+	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CallUsage) GetCostMicroUsd() int64 {
+	if x != nil {
+		return x.CostMicroUsd
+	}
+	return 0
+}
+
+func (x *CallUsage) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *CallUsage) GetInputTokens() int64 {
+	if x != nil {
+		return x.InputTokens
+	}
+	return 0
+}
+
+func (x *CallUsage) GetCachedTokens() int64 {
+	if x != nil {
+		return x.CachedTokens
+	}
+	return 0
+}
+
+func (x *CallUsage) GetToolUseTokens() int64 {
+	if x != nil {
+		return x.ToolUseTokens
+	}
+	return 0
+}
+
+func (x *CallUsage) GetOutputTokens() int64 {
+	if x != nil {
+		return x.OutputTokens
+	}
+	return 0
+}
+
+func (x *CallUsage) GetThinkingTokens() int64 {
+	if x != nil {
+		return x.ThinkingTokens
+	}
+	return 0
+}
+
+func (x *CallUsage) GetVoice() string {
+	if x != nil {
+		return x.Voice
+	}
+	return ""
+}
+
+func (x *CallUsage) GetCharacters() int64 {
+	if x != nil {
+		return x.Characters
+	}
+	return 0
+}
+
+func (x *CallUsage) GetBudgets() []*RemainingBudget {
+	if x != nil {
+		return x.Budgets
+	}
+	return nil
+}
+
+// Degradation reports what was degraded in a call because the budget is filling up
+type Degradation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BudgetPercent int32                  `protobuf:"varint,1,opt,name=budget_percent,json=budgetPercent,proto3" json:"budget_percent,omitempty"` //fill level of the fullest budget window
+	TtsVoice      string                 `protobuf:"bytes,2,opt,name=tts_voice,json=ttsVoice,proto3" json:"tts_voice,omitempty"`                 //voice tier the audio was switched to
+	AudioDropped  bool                   `protobuf:"varint,3,opt,name=audio_dropped,json=audioDropped,proto3" json:"audio_dropped,omitempty"`
+	GeminiModel   string                 `protobuf:"bytes,4,opt,name=gemini_model,json=geminiModel,proto3" json:"gemini_model,omitempty"` //model the call was switched to
+	Cached        bool                   `protobuf:"varint,5,opt,name=cached,proto3" json:"cached,omitempty"`                             //served from the cache
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Degradation) Reset() {
+	*x = Degradation{}
+	mi := &file_proto_sentence_gen_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Degradation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Degradation) ProtoMessage() {}
+
+func (x *Degradation) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sentence_gen_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Degradation.ProtoReflect.Descriptor instead.
+func (*Degradation) Descriptor() ([]byte, []int) {
+	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Degradation) GetBudgetPercent() int32 {
+	if x != nil {
+		return x.BudgetPercent
+	}
+	return 0
+}
+
+func (x *Degradation) GetTtsVoice() string {
+	if x != nil {
+		return x.TtsVoice
+	}
+	return ""
+}
+
+func (x *Degradation) GetAudioDropped() bool {
+	if x != nil {
+		return x.AudioDropped
+	}
+	return false
+}
+
+func (x *Degradation) GetGeminiModel() string {
+	if x != nil {
+		return x.GeminiModel
+	}
+	return ""
+}
+
+func (x *Degradation) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
 type GenerateSentenceRequest struct {
 	state               protoimpl.MessageState `protogen:"open.v1"`
 	WordLanguage        string                 `protobuf:"bytes,1,opt,name=word_language,json=wordLanguage,proto3" json:"word_language,omitempty"`
@@ -125,7 +472,7 @@ type GenerateSentenceRequest struct {
 
 func (x *GenerateSentenceRequest) Reset() {
 	*x = GenerateSentenceRequest{}
-	mi := &file_proto_sentence_gen_proto_msgTypes[1]
+	mi := &file_proto_sentence_gen_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -137,7 +484,7 @@ func (x *GenerateSentenceRequest) String() string {
 func (*GenerateSentenceRequest) ProtoMessage() {}
 
 func (x *GenerateSentenceRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_sentence_gen_proto_msgTypes[1]
+	mi := &file_proto_sentence_gen_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -150,7 +497,7 @@ func (x *GenerateSentenceRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GenerateSentenceRequest.ProtoReflect.Descriptor instead.
 func (*GenerateSentenceRequest) Descriptor() ([]byte, []int) {
-	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{1}
+	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *GenerateSentenceRequest) GetWordLanguage() string {
@@ -200,13 +547,15 @@ type GenerateSentenceResponse struct {
 	OriginalSentence   string                 `protobuf:"bytes,1,opt,name=original_sentence,json=originalSentence,proto3" json:"original_sentence,omitempty"`
 	TranslatedSentence string                 `protobuf:"bytes,2,opt,name=translated_sentence,json=translatedSentence,proto3" json:"translated_sentence,omitempty"`
 	Audio              *Audio                 `protobuf:"bytes,3,opt,name=audio,proto3" json:"audio,omitempty"` //audio in a language of the word
+	Usage              *CallUsage             `protobuf:"bytes,4,opt,name=usage,proto3" json:"usage,omitempty"`
+	Degradation        *Degradation           `protobuf:"bytes,5,opt,name=degradation,proto3" json:"degradation,omitempty"` //unset if nothing was degraded
 	unknownFields      protoimpl.UnknownFields
 	sizeCache          protoimpl.SizeCache
 }
 
 func (x *GenerateSentenceResponse) Reset() {
 	*x = GenerateSentenceResponse{}
-	mi := &file_proto_sentence_gen_proto_msgTypes[2]
+	mi := &file_proto_sentence_gen_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -218,7 +567,7 @@ func (x *GenerateSentenceResponse) String() string {
 func (*GenerateSentenceResponse) ProtoMessage() {}
 
 func (x *GenerateSentenceResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_sentence_gen_proto_msgTypes[2]
+	mi := &file_proto_sentence_gen_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -231,7 +580,7 @@ func (x *GenerateSentenceResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GenerateSentenceResponse.ProtoReflect.Descriptor instead.
 func (*GenerateSentenceResponse) Descriptor() ([]byte, []int) {
-	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{2}
+	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *GenerateSentenceResponse) GetOriginalSentence() string {
@@ -255,6 +604,20 @@ func (x *GenerateSentenceResponse) GetAudio() *Audio {
 	return nil
 }
 
+func (x *GenerateSentenceResponse) GetUsage() *CallUsage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+func (x *GenerateSentenceResponse) GetDegradation() *Degradation {
+	if x != nil {
+		return x.Degradation
+	}
+	return nil
+}
+
 type GenerateDefinitionRequest struct {
 	state          protoimpl.MessageState `protogen:"open.v1"`
 	Language       string                 `protobuf:"bytes,1,opt,name=language,proto3" json:"language,omitempty"`
@@ -268,7 +631,7 @@ type GenerateDefinitionRequest struct {
 
 func (x *GenerateDefinitionRequest) Reset() {
 	*x = GenerateDefinitionRequest{}
-	mi := &file_proto_sentence_gen_proto_msgTypes[3]
+	mi := &file_proto_sentence_gen_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -280,7 +643,7 @@ func (x *GenerateDefinitionRequest) String() string {
 func (*GenerateDefinitionRequest) ProtoMessage() {}
 
 func (x *GenerateDefinitionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_sentence_gen_proto_msgTypes[3]
+	mi := &file_proto_sentence_gen_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -293,7 +656,7 @@ func (x *GenerateDefinitionRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GenerateDefinitionRequest.ProtoReflect.Descriptor instead.
 func (*GenerateDefinitionRequest) Descriptor() ([]byte, []int) {
-	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{3}
+	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *GenerateDefinitionRequest) GetLanguage() string {
@@ -335,13 +698,15 @@ type GenerateDefinitionResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Definition    string                 `protobuf:"bytes,1,opt,name=definition,proto3" json:"definition,omitempty"`
 	Audio         *Audio                 `protobuf:"bytes,2,opt,name=audio,proto3" json:"audio,omitempty"` //word audio
+	Usage         *CallUsage             `protobuf:"bytes,3,opt,name=usage,proto3" json:"usage,omitempty"`
+	Degradation   *Degradation           `protobuf:"bytes,4,opt,name=degradation,proto3" json:"degradation,omitempty"` //unset if nothing was degraded
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GenerateDefinitionResponse) Reset() {
 	*x = GenerateDefinitionResponse{}
-	mi := &file_proto_sentence_gen_proto_msgTypes[4]
+	mi := &file_proto_sentence_gen_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -353,7 +718,7 @@ func (x *GenerateDefinitionResponse) String() string {
 func (*GenerateDefinitionResponse) ProtoMessage() {}
 
 func (x *GenerateDefinitionResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_sentence_gen_proto_msgTypes[4]
+	mi := &file_proto_sentence_gen_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -366,7 +731,7 @@ func (x *GenerateDefinitionResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GenerateDefinitionResponse.ProtoReflect.Descriptor instead.
 func (*GenerateDefinitionResponse) Descriptor() ([]byte, []int) {
-	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{4}
+	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *GenerateDefinitionResponse) GetDefinition() string {
@@ -383,6 +748,20 @@ func (x *GenerateDefinitionResponse) GetAudio() *Audio {
 	return nil
 }
 
+func (x *GenerateDefinitionResponse) GetUsage() *CallUsage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+func (x *GenerateDefinitionResponse) GetDegradation() *Degradation {
+	if x != nil {
+		return x.Degradation
+	}
+	return nil
+}
+
 type TranslateRequest struct {
 	state           protoimpl.MessageState `protogen:"open.v1"`
 	FromLanguage    string                 `protobuf:"bytes,1,opt,name=from_language,json=fromLanguage,proto3" json:"from_language,omitempty"`
@@ -397,7 +776,7 @@ type TranslateRequest struct {
 
 func (x *TranslateRequest) Reset() {
 	*x = TranslateRequest{}
-	mi := &file_proto_sentence_gen_proto_msgTypes[5]
+	mi := &file_proto_sentence_gen_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -409,7 +788,7 @@ func (x *TranslateRequest) String() string {
 func (*TranslateRequest) ProtoMessage() {}
 
 func (x *TranslateRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_sentence_gen_proto_msgTypes[5]
+	mi := &file_proto_sentence_gen_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -422,7 +801,7 @@ func (x *TranslateRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TranslateRequest.ProtoReflect.Descriptor instead.
 func (*TranslateRequest) Descriptor() ([]byte, []int) {
-	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{5}
+	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *TranslateRequest) GetFromLanguage() string {
@@ -471,13 +850,15 @@ type TranslateResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Translation   string                 `protobuf:"bytes,1,opt,name=translation,proto3" json:"translation,omitempty"`
 	Audio         *Audio                 `protobuf:"bytes,2,opt,name=audio,proto3" json:"audio,omitempty"`
+	Usage         *CallUsage             `protobuf:"bytes,3,opt,name=usage,proto3" json:"usage,omitempty"`
+	Degradation   *Degradation           `protobuf:"bytes,4,opt,name=degradation,proto3" json:"degradation,omitempty"` //unset if nothing was degraded
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *TranslateResponse) Reset() {
 	*x = TranslateResponse{}
-	mi := &file_proto_sentence_gen_proto_msgTypes[6]
+	mi := &file_proto_sentence_gen_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -489,7 +870,7 @@ func (x *TranslateResponse) String() string {
 func (*TranslateResponse) ProtoMessage() {}
 
 func (x *TranslateResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_sentence_gen_proto_msgTypes[6]
+	mi := &file_proto_sentence_gen_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -502,7 +883,7 @@ func (x *TranslateResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TranslateResponse.ProtoReflect.Descriptor instead.
 func (*TranslateResponse) Descriptor() ([]byte, []int) {
-	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{6}
+	return file_proto_sentence_gen_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *TranslateResponse) GetTranslation() string {
@@ -519,35 +900,79 @@ func (x *TranslateResponse) GetAudio() *Audio {
 	return nil
 }
 
+func (x *TranslateResponse) GetUsage() *CallUsage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+func (x *TranslateResponse) GetDegradation() *Degradation {
+	if x != nil {
+		return x.Degradation
+	}
+	return nil
+}
+
 var File_proto_sentence_gen_proto protoreflect.FileDescriptor
 
 const file_proto_sentence_gen_proto_rawDesc = "" +
 	"\n" +
-	"\x18proto/sentence-gen.proto\x12\vsentencegen\"\x1b\n" +
+	"\x18proto/sentence-gen.proto\x12\vsentencegen\x1a\x1fgoogle/protobuf/timestamp.proto\"\x1b\n" +
 	"\x05Audio\x12\x12\n" +
-	"\x04data\x18\x01 \x01(\fR\x04data\"\x8d\x02\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"\xc3\x01\n" +
+	"\x0fRemainingBudget\x12\x16\n" +
+	"\x06period\x18\x01 \x01(\tR\x06period\x12\x1b\n" +
+	"\ttime_zone\x18\x02 \x01(\tR\btimeZone\x12.\n" +
+	"\x13remaining_micro_usd\x18\x03 \x01(\x03R\x11remainingMicroUsd\x127\n" +
+	"\tresets_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\bresetsAt\x12\x12\n" +
+	"\x04plan\x18\x05 \x01(\tR\x04plan\"\xf3\x02\n" +
+	"\tCallUsage\x12$\n" +
+	"\x0ecost_micro_usd\x18\x01 \x01(\x03R\fcostMicroUsd\x12\x14\n" +
+	"\x05model\x18\x02 \x01(\tR\x05model\x12!\n" +
+	"\finput_tokens\x18\x03 \x01(\x03R\vinputTokens\x12#\n" +
+	"\rcached_tokens\x18\x04 \x01(\x03R\fcachedTokens\x12&\n" +
+	"\x0ftool_use_tokens\x18\x05 \x01(\x03R\rtoolUseTokens\x12#\n" +
+	"\routput_tokens\x18\x06 \x01(\x03R\foutputTokens\x12'\n" +
+	"\x0fthinking_tokens\x18\a \x01(\x03R\x0ethinkingTokens\x12\x14\n" +
+	"\x05voice\x18\b \x01(\tR\x05voice\x12\x1e\n" +
+	"\n" +
+	"characters\x18\t \x01(\x03R\n" +
+	"characters\x126\n" +
+	"\abudgets\x18\n" +
+	" \x03(\v2\x1c.sentencegen.RemainingBudgetR\abudgets\"\xb1\x01\n" +
+	"\vDegradation\x12%\n" +
+	"\x0ebudget_percent\x18\x01 \x01(\x05R\rbudgetPercent\x12\x1b\n" +
+	"\ttts_voice\x18\x02 \x01(\tR\bttsVoice\x12#\n" +
+	"\raudio_dropped\x18\x03 \x01(\bR\faudioDropped\x12!\n" +
+	"\fgemini_model\x18\x04 \x01(\tR\vgeminiModel\x12\x16\n" +
+	"\x06cached\x18\x05 \x01(\bR\x06cached\"\x8d\x02\n" +
 	"\x17GenerateSentenceRequest\x12#\n" +
 	"\rword_language\x18\x01 \x01(\tR\fwordLanguage\x121\n" +
 	"\x14translation_language\x18\x02 \x01(\tR\x13translationLanguage\x12\x12\n" +
 	"\x04word\x18\x03 \x01(\tR\x04word\x12)\n" +
 	"\x10translation_hint\x18\x04 \x01(\tR\x0ftranslationHint\x12#\n" +
 	"\rinclude_audio\x18\x05 \x01(\bR\fincludeAudio\x126\n" +
-	"\fvoice_gender\x18\x06 \x01(\x0e2\x13.sentencegen.GenderR\vvoiceGender\"\xa2\x01\n" +
+	"\fvoice_gender\x18\x06 \x01(\x0e2\x13.sentencegen.GenderR\vvoiceGender\"\x8c\x02\n" +
 	"\x18GenerateSentenceResponse\x12+\n" +
 	"\x11original_sentence\x18\x01 \x01(\tR\x10originalSentence\x12/\n" +
 	"\x13translated_sentence\x18\x02 \x01(\tR\x12translatedSentence\x12(\n" +
-	"\x05audio\x18\x03 \x01(\v2\x12.sentencegen.AudioR\x05audio\"\xd1\x01\n" +
+	"\x05audio\x18\x03 \x01(\v2\x12.sentencegen.AudioR\x05audio\x12,\n" +
+	"\x05usage\x18\x04 \x01(\v2\x16.sentencegen.CallUsageR\x05usage\x12:\n" +
+	"\vdegradation\x18\x05 \x01(\v2\x18.sentencegen.DegradationR\vdegradation\"\xd1\x01\n" +
 	"\x19GenerateDefinitionRequest\x12\x1a\n" +
 	"\blanguage\x18\x01 \x01(\tR\blanguage\x12\x12\n" +
 	"\x04word\x18\x02 \x01(\tR\x04word\x12'\n" +
 	"\x0fdefinition_hint\x18\x03 \x01(\tR\x0edefinitionHint\x12#\n" +
 	"\rinclude_audio\x18\x04 \x01(\bR\fincludeAudio\x126\n" +
-	"\fvoice_gender\x18\x05 \x01(\x0e2\x13.sentencegen.GenderR\vvoiceGender\"f\n" +
+	"\fvoice_gender\x18\x05 \x01(\x0e2\x13.sentencegen.GenderR\vvoiceGender\"\xd0\x01\n" +
 	"\x1aGenerateDefinitionResponse\x12\x1e\n" +
 	"\n" +
 	"definition\x18\x01 \x01(\tR\n" +
 	"definition\x12(\n" +
-	"\x05audio\x18\x02 \x01(\v2\x12.sentencegen.AudioR\x05audio\"\xf4\x01\n" +
+	"\x05audio\x18\x02 \x01(\v2\x12.sentencegen.AudioR\x05audio\x12,\n" +
+	"\x05usage\x18\x03 \x01(\v2\x16.sentencegen.CallUsageR\x05usage\x12:\n" +
+	"\vdegradation\x18\x04 \x01(\v2\x18.sentencegen.DegradationR\vdegradation\"\xf4\x01\n" +
 	"\x10TranslateRequest\x12#\n" +
 	"\rfrom_language\x18\x01 \x01(\tR\ffromLanguage\x12\x1f\n" +
 	"\vto_language\x18\x02 \x01(\tR\n" +
@@ -555,13 +980,29 @@ const file_proto_sentence_gen_proto_rawDesc = "" +
 	"\x04word\x18\x03 \x01(\tR\x04word\x12)\n" +
 	"\x10translation_hint\x18\x04 \x01(\tR\x0ftranslationHint\x12#\n" +
 	"\rinclude_audio\x18\x05 \x01(\bR\fincludeAudio\x126\n" +
-	"\fvoice_gender\x18\x06 \x01(\x0e2\x13.sentencegen.GenderR\vvoiceGender\"_\n" +
+	"\fvoice_gender\x18\x06 \x01(\x0e2\x13.sentencegen.GenderR\vvoiceGender\"\xc9\x01\n" +
 	"\x11TranslateResponse\x12 \n" +
 	"\vtranslation\x18\x01 \x01(\tR\vtranslation\x12(\n" +
-	"\x05audio\x18\x02 \x01(\v2\x12.sentencegen.AudioR\x05audio*,\n" +
+	"\x05audio\x18\x02 \x01(\v2\x12.sentencegen.AudioR\x05audio\x12,\n" +
+	"\x05usage\x18\x03 \x01(\v2\x16.sentencegen.CallUsageR\x05usage\x12:\n" +
+	"\vdegradation\x18\x04 \x01(\v2\x18.sentencegen.DegradationR\vdegradation*,\n" +
 	"\x06Gender\x12\x11\n" +
 	"\rGENDER_FEMALE\x10\x00\x12\x0f\n" +
-	"\vGENDER_MALE\x10\x012\xa1\x02\n" +
+	"\vGENDER_MALE\x10\x01*\x8c\x02\n" +
+	"\vErrorReason\x12\x1c\n" +
+	"\x18ERROR_REASON_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fINVALID_REQUEST\x10\x01\x12\x18\n" +
+	"\x14UNSUPPORTED_LANGUAGE\x10\x02\x12\x12\n" +
+	"\x0eWORD_NOT_FOUND\x10\x03\x12\f\n" +
+	"\bNO_VOICE\x10\x04\x12\x0f\n" +
+	"\vNOT_IN_PLAN\x10\x05\x12\x14\n" +
+	"\x10BUDGET_EXHAUSTED\x10\x06\x12\x10\n" +
+	"\fRATE_LIMITED\x10\a\x12\x16\n" +
+	"\x12UPSTREAM_THROTTLED\x10\b\x12\x18\n" +
+	"\x14UPSTREAM_UNAVAILABLE\x10\t\x12\x15\n" +
+	"\x11DEADLINE_EXCEEDED\x10\n" +
+	"\x12\f\n" +
+	"\bINTERNAL\x10\v2\xa1\x02\n" +
 	"\vSentenceGen\x12_\n" +
 	"\x10GenerateSentence\x12$.sentencegen.GenerateSentenceRequest\x1a%.sentencegen.GenerateSentenceResponse\x12J\n" +
 	"\tTranslate\x12\x1d.sentencegen.TranslateRequest\x1a\x1e.sentencegen.TranslateResponse\x12e\n" +
@@ -579,36 +1020,49 @@ func file_proto_sentence_gen_proto_rawDescGZIP() []byte {
 	return file_proto_sentence_gen_proto_rawDescData
 }
 
-var file_proto_sentence_gen_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_proto_sentence_gen_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_proto_sentence_gen_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_proto_sentence_gen_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_proto_sentence_gen_proto_goTypes = []any{
 	(Gender)(0),                        // 0: sentencegen.Gender
-	(*Audio)(nil),                      // 1: sentencegen.Audio
-	(*GenerateSentenceRequest)(nil),    // 2: sentencegen.GenerateSentenceRequest
-	(*GenerateSentenceResponse)(nil),   // 3: sentencegen.GenerateSentenceResponse
-	(*GenerateDefinitionRequest)(nil),  // 4: sentencegen.GenerateDefinitionRequest
-	(*GenerateDefinitionResponse)(nil), // 5: sentencegen.GenerateDefinitionResponse
-	(*TranslateRequest)(nil),           // 6: sentencegen.TranslateRequest
-	(*TranslateResponse)(nil),          // 7: sentencegen.TranslateResponse
+	(ErrorReason)(0),                   // 1: sentencegen.ErrorReason
+	(*Audio)(nil),                      // 2: sentencegen.Audio
+	(*RemainingBudget)(nil),            // 3: sentencegen.RemainingBudget
+	(*CallUsage)(nil),                  // 4: sentencegen.CallUsage
+	(*Degradation)(nil),                // 5: sentencegen.Degradation
+	(*GenerateSentenceRequest)(nil),    // 6: sentencegen.GenerateSentenceRequest
+	(*GenerateSentenceResponse)(nil),   // 7: sentencegen.GenerateSentenceResponse
+	(*GenerateDefinitionRequest)(nil),  // 8: sentencegen.GenerateDefinitionRequest
+	(*GenerateDefinitionResponse)(nil), // 9: sentencegen.GenerateDefinitionResponse
+	(*TranslateRequest)(nil),           // 10: sentencegen.TranslateRequest
+	(*TranslateResponse)(nil),          // 11: sentencegen.TranslateResponse
+	(*timestamppb.Timestamp)(nil),      // 12: google.protobuf.Timestamp
 }
 var file_proto_sentence_gen_proto_depIdxs = []int32{
-	0, // 0: sentencegen.GenerateSentenceRequest.voice_gender:type_name -> sentencegen.Gender
-	1, // 1: sentencegen.GenerateSentenceResponse.audio:type_name -> sentencegen.Audio
-	0, // 2: sentencegen.GenerateDefinitionRequest.voice_gender:type_name -> sentencegen.Gender
-	1, // 3: sentencegen.GenerateDefinitionResponse.audio:type_name -> sentencegen.Audio
-	0, // 4: sentencegen.TranslateRequest.voice_gender:type_name -> sentencegen.Gender
-	1, // 5: sentencegen.TranslateResponse.audio:type_name -> sentencegen.Audio
-	2, // 6: sentencegen.SentenceGen.GenerateSentence:input_type -> sentencegen.GenerateSentenceRequest
-	6, // 7: sentencegen.SentenceGen.Translate:input_type -> sentencegen.TranslateRequest
-	4, // 8: sentencegen.SentenceGen.GenerateDefinition:input_type -> sentencegen.GenerateDefinitionRequest
-	3, // 9: sentencegen.SentenceGen.GenerateSentence:output_type -> sentencegen.GenerateSentenceResponse
-	7, // 10: sentencegen.SentenceGen.Translate:output_type -> sentencegen.TranslateResponse
-	5, // 11: sentencegen.SentenceGen.GenerateDefinition:output_type -> sentencegen.GenerateDefinitionResponse
-	9, // [9:12] is the sub-list for method output_type
-	6, // [6:9] is the sub-list for method input_type
-	6, // [6:6] is the sub-list for extension type_name
-	6, // [6:6] is the sub-list for extension extendee
-	0, // [0:6] is the sub-list for field type_name
+	12, // 0: sentencegen.RemainingBudget.resets_at:type_name -> google.protobuf.Timestamp
+	3,  // 1: sentencegen.CallUsage.budgets:type_name -> sentencegen.RemainingBudget
+	0,  // 2: sentencegen.GenerateSentenceRequest.voice_gender:type_name -> sentencegen.Gender
+	2,  // 3: sentencegen.GenerateSentenceResponse.audio:type_name -> sentencegen.Audio
+	4,  // 4: sentencegen.GenerateSentenceResponse.usage:type_name -> sentencegen.CallUsage
+	5,  // 5: sentencegen.GenerateSentenceResponse.degradation:type_name -> sentencegen.Degradation
+	0,  // 6: sentencegen.GenerateDefinitionRequest.voice_gender:type_name -> sentencegen.Gender
+	2,  // 7: sentencegen.GenerateDefinitionResponse.audio:type_name -> sentencegen.Audio
+	4,  // 8: sentencegen.GenerateDefinitionResponse.usage:type_name -> sentencegen.CallUsage
+	5,  // 9: sentencegen.GenerateDefinitionResponse.degradation:type_name -> sentencegen.Degradation
+	0,  // 10: sentencegen.TranslateRequest.voice_gender:type_name -> sentencegen.Gender
+	2,  // 11: sentencegen.TranslateResponse.audio:type_name -> sentencegen.Audio
+	4,  // 12: sentencegen.TranslateResponse.usage:type_name -> sentencegen.CallUsage
+	5,  // 13: sentencegen.TranslateResponse.degradation:type_name -> sentencegen.Degradation
+	6,  // 14: sentencegen.SentenceGen.GenerateSentence:input_type -> sentencegen.GenerateSentenceRequest
+	10, // 15: sentencegen.SentenceGen.Translate:input_type -> sentencegen.TranslateRequest
+	8,  // 16: sentencegen.SentenceGen.GenerateDefinition:input_type -> sentencegen.GenerateDefinitionRequest
+	7,  // 17: sentencegen.SentenceGen.GenerateSentence:output_type -> sentencegen.GenerateSentenceResponse
+	11, // 18: sentencegen.SentenceGen.Translate:output_type -> sentencegen.TranslateResponse
+	9,  // 19: sentencegen.SentenceGen.GenerateDefinition:output_type -> sentencegen.GenerateDefinitionResponse
+	17, // [17:20] is the sub-list for method output_type
+	14, // [14:17] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
 }
 
 func init() { file_proto_sentence_gen_proto_init() }
@@ -621,8 +1075,8 @@ func file_proto_sentence_gen_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_sentence_gen_proto_rawDesc), len(file_proto_sentence_gen_proto_rawDesc)),
-			NumEnums:      1,
-			NumMessages:   7,
+			NumEnums:      2,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
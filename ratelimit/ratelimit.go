@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	idleTTL       = 10 * time.Minute
+	sweepInterval = time.Minute
+)
+
+// Limit is a token bucket refilled with Rate tokens per second that holds up to Burst tokens
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Config describes the rate limits. Every caller gets its own bucket per method.
+// A limit for the caller (principal id or ip) takes precedence over the method limit, which takes precedence over the default.
+// Methods are keyed by rpc name ("Translate") or full method name ("/sentencegen.SentenceGen/Translate").
+// A zero rate disables limiting for the matching calls
+type Config struct {
+	Default    *Limit           `json:"default"`
+	Methods    map[string]Limit `json:"methods"`
+	Principals map[string]Limit `json:"principals"`
+	IPs        map[string]Limit `json:"ips"`
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type Limiter struct {
+	config    Config
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// LoadConfig reads the rate limit config from a json file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	limits := make([]Limit, 0, len(c.Methods)+len(c.Principals)+len(c.IPs)+1)
+	if c.Default != nil {
+		limits = append(limits, *c.Default)
+	}
+	for _, m := range []map[string]Limit{c.Methods, c.Principals, c.IPs} {
+		for _, l := range m {
+			limits = append(limits, l)
+		}
+	}
+	for _, l := range limits {
+		if l.Rate < 0 || l.Burst < 0 || (l.Rate > 0 && l.Burst == 0) {
+			return errors.New("invalid rate limit: rate and burst must be positive")
+		}
+	}
+	return nil
+}
+
+// New creates new rate limiter
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		config:  cfg,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the caller bucket for the method.
+// If the bucket is empty it returns false and how long the caller should wait before retrying
+func (l *Limiter) Allow(fullMethod, principal, ip string) (bool, time.Duration) {
+	limit, caller, ok := l.resolve(fullMethod, principal, ip)
+	if !ok {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	key := fullMethod + "|" + caller
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return false, 0
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		//Give the token back, the request is rejected instead of delayed
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// resolve picks the limit that applies to the call and the caller identity the bucket is keyed by
+func (l *Limiter) resolve(fullMethod, principal, ip string) (Limit, string, bool) {
+	caller := "ip:" + ip
+	if principal != "" {
+		caller = principal
+	}
+
+	if limit, ok := l.config.Principals[principal]; ok && principal != "" {
+		return limit, caller, limit.Rate > 0
+	}
+	if limit, ok := l.config.IPs[ip]; ok && ip != "" {
+		return limit, caller, limit.Rate > 0
+	}
+	if limit, ok := l.config.Methods[fullMethod]; ok {
+		return limit, caller, limit.Rate > 0
+	}
+	if limit, ok := l.config.Methods[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]; ok {
+		return limit, caller, limit.Rate > 0
+	}
+	if l.config.Default != nil {
+		return *l.config.Default, caller, l.config.Default.Rate > 0
+	}
+	return Limit{}, caller, false
+}
+
+// sweep drops buckets of callers that have been idle long enough for their bucket to be full again. Must be called with mu held
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		refill := time.Duration(float64(b.limiter.Burst()) / float64(b.limiter.Limit()) * float64(time.Second))
+		if now.Sub(b.lastSeen) > max(idleTTL, refill) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	translateMethod = "/sentencegen.SentenceGen/Translate"
+	sentenceMethod  = "/sentencegen.SentenceGen/GenerateSentence"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(Config{
+		Default:    &Limit{Rate: 1, Burst: 2},
+		Methods:    map[string]Limit{"GenerateSentence": {Rate: 0.5, Burst: 1}},
+		Principals: map[string]Limit{"api_key:bulk": {Rate: 100, Burst: 100}},
+		IPs:        map[string]Limit{"10.0.0.5": {Rate: 0}},
+	})
+	l.now = func() time.Time { return now }
+
+	//Default limit: burst of 2, then a one second wait
+	ok, _ := l.Allow(translateMethod, "user:a", "1.1.1.1")
+	assert.True(t, ok)
+	ok, _ = l.Allow(translateMethod, "user:a", "1.1.1.1")
+	assert.True(t, ok)
+	ok, retryAfter := l.Allow(translateMethod, "user:a", "1.1.1.1")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, retryAfter)
+
+	//Other callers and other methods have their own buckets
+	ok, _ = l.Allow(translateMethod, "user:b", "1.1.1.1")
+	assert.True(t, ok)
+	ok, _ = l.Allow(sentenceMethod, "user:a", "1.1.1.1")
+	assert.True(t, ok)
+
+	//Method limit
+	ok, retryAfter = l.Allow(sentenceMethod, "user:a", "1.1.1.1")
+	assert.False(t, ok)
+	assert.Equal(t, 2*time.Second, retryAfter)
+
+	//Tokens refill over time
+	now = now.Add(time.Second)
+	ok, _ = l.Allow(translateMethod, "user:a", "1.1.1.1")
+	assert.True(t, ok)
+
+	//Principal and ip overrides
+	for i := 0; i < 50; i++ {
+		ok, _ = l.Allow(sentenceMethod, "api_key:bulk", "1.1.1.1")
+		assert.True(t, ok)
+		ok, _ = l.Allow(sentenceMethod, "", "10.0.0.5")
+		assert.True(t, ok)
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(Config{Default: &Limit{Rate: 1, Burst: 1}})
+	l.now = func() time.Time { return now }
+
+	ok, _ := l.Allow(translateMethod, "", "1.1.1.1")
+	assert.True(t, ok)
+	assert.Len(t, l.buckets, 1)
+
+	now = now.Add(idleTTL + sweepInterval + time.Second)
+	ok, _ = l.Allow(translateMethod, "", "2.2.2.2")
+	assert.True(t, ok)
+	assert.Len(t, l.buckets, 1)
+}
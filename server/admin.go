@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/auth"
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	"github.com/dafraer/sentence-gen-grpc-server/plan"
+	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"github.com/dafraer/sentence-gen-grpc-server/service"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// adminServer serves the admin rpcs. They are only available to principals with the admin scope
+type adminServer struct {
+	pb.UnimplementedAdminServer
+	srvc   *service.Service
+	plans  *plan.Registry
+	logger *zap.SugaredLogger
+}
+
+func (s *adminServer) GetSpendingReport(ctx context.Context, request *pb.SpendingReportRequest) (*pb.SpendingReportResponse, error) {
+	if err := requireAdmin(ctx); err != nil {
+		s.log(ctx).Infow("spending report rpc denied", "error", err)
+		return nil, err
+	}
+	if request == nil {
+		s.log(ctx).Errorw("spending report rpc failed: nil request", "error", errors.New("nil request"))
+		return nil, status.Error(codes.InvalidArgument, "nil request")
+	}
+	s.log(ctx).Infow("spending report rpc request received", "start_date", request.StartDate, "end_date", request.EndDate, "currency", request.Currency)
+
+	start, err := time.Parse(time.DateOnly, request.StartDate)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "start_date must be YYYY-MM-DD")
+	}
+	end, err := time.Parse(time.DateOnly, request.EndDate)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "end_date must be YYYY-MM-DD")
+	}
+
+	code := strings.ToUpper(request.Currency)
+	if code == "" {
+		code = "USD"
+	}
+	if _, err := s.srvc.FormatAmount(0, code); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	display := func(amount currency.MicroUSD) string {
+		//The currency was checked above, so formatting can't fail
+		v, _ := s.srvc.FormatAmount(amount, code)
+		return v
+	}
+
+	report, err := s.srvc.SpendingReport(ctx, start, end)
+	if err != nil {
+		s.log(ctx).Errorw("spending report rpc failed", "error", err)
+		return nil, formatError(ctx, err)
+	}
+
+	resp := &pb.SpendingReportResponse{
+		Days:     make([]*pb.DaySpending, 0, len(report.Days)),
+		Total:    spendingToPB(&report.Total, display),
+		Currency: code,
+	}
+	for _, day := range report.Days {
+		resp.Days = append(resp.Days, &pb.DaySpending{Date: day.Date, Spending: spendingToPB(&day.Spending, display)})
+	}
+	for _, b := range report.Budgets {
+		resp.Budgets = append(resp.Budgets, &pb.BudgetStatus{
+			Period:            string(b.Window.Period),
+			TimeZone:          b.Window.Location.String(),
+			LimitMicroUsd:     int64(b.Window.Limit),
+			SpentMicroUsd:     int64(b.Spent),
+			ReservedMicroUsd:  int64(b.Reserved),
+			RemainingMicroUsd: int64(b.Remaining),
+			ResetsAt:          timestamppb.New(b.ResetsAt),
+			DisplayLimit:      display(b.Window.Limit),
+			DisplaySpent:      display(b.Spent),
+			DisplayRemaining:  display(b.Remaining),
+		})
+	}
+	s.log(ctx).Infow("spending report rpc completed", "days", len(resp.Days))
+	return resp, nil
+}
+
+func (s *adminServer) SetPrincipalPlan(ctx context.Context, request *pb.SetPrincipalPlanRequest) (*pb.SetPrincipalPlanResponse, error) {
+	if err := requireAdmin(ctx); err != nil {
+		s.log(ctx).Infow("set principal plan rpc denied", "error", err)
+		return nil, err
+	}
+	if request == nil {
+		s.log(ctx).Errorw("set principal plan rpc failed: nil request", "error", errors.New("nil request"))
+		return nil, status.Error(codes.InvalidArgument, "nil request")
+	}
+	if s.plans == nil {
+		return nil, status.Error(codes.FailedPrecondition, "plans are not configured")
+	}
+	s.log(ctx).Infow("set principal plan rpc request received", "principal", request.Principal, "plan", request.Plan)
+
+	if err := s.plans.Assign(ctx, request.Principal, request.Plan); err != nil {
+		s.log(ctx).Errorw("set principal plan rpc failed", "error", err)
+		if errors.Is(err, plan.ErrUnknownPlan) || request.Principal == "" {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to assign plan")
+	}
+	s.log(ctx).Infow("set principal plan rpc completed", "principal", request.Principal, "plan", request.Plan)
+	return &pb.SetPrincipalPlanResponse{}, nil
+}
+
+func (s *adminServer) GetPrincipalPlan(ctx context.Context, request *pb.GetPrincipalPlanRequest) (*pb.GetPrincipalPlanResponse, error) {
+	if err := requireAdmin(ctx); err != nil {
+		s.log(ctx).Infow("get principal plan rpc denied", "error", err)
+		return nil, err
+	}
+	if request == nil {
+		s.log(ctx).Errorw("get principal plan rpc failed: nil request", "error", errors.New("nil request"))
+		return nil, status.Error(codes.InvalidArgument, "nil request")
+	}
+	if s.plans == nil {
+		return nil, status.Error(codes.FailedPrecondition, "plans are not configured")
+	}
+	name, _ := s.plans.Lookup(request.Principal)
+	s.log(ctx).Infow("get principal plan rpc completed", "principal", request.Principal, "plan", name)
+	return &pb.GetPrincipalPlanResponse{Plan: name}, nil
+}
+
+// log returns the logger with the request id of ctx
+func (s *adminServer) log(ctx context.Context) *zap.SugaredLogger {
+	return logging.FromContext(ctx, s.logger)
+}
+
+// requireAdmin checks that the caller is authenticated with the admin scope
+func requireAdmin(ctx context.Context) error {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "admin credentials required")
+	}
+	if !p.HasScope(auth.ScopeAdmin) {
+		return status.Error(codes.PermissionDenied, "admin scope required")
+	}
+	return nil
+}
+
+func spendingToPB(sp *db.Spending, display func(currency.MicroUSD) string) *pb.Spending {
+	return &pb.Spending{
+		Total: usageToPB(db.Usage{
+			Amount:         sp.Amount,
+			Requests:       sp.Requests,
+			InputTokens:    sp.GeminiInputTokens,
+			OutputTokens:   sp.GeminiOutputTokens,
+			CachedTokens:   sp.GeminiCachedTokens,
+			ToolUseTokens:  sp.GeminiToolUseTokens,
+			ThinkingTokens: sp.GeminiThinkingTokens,
+			Characters:     sp.Chirp3HDCharacters + sp.StandardVoiceCharacters,
+		}, display),
+		Operations: usagesToPB(sp.Operations, display),
+		Models:     usagesToPB(sp.Models, display),
+		Voices:     usagesToPB(sp.Voices, display),
+		Principals: usagesToPB(sp.Principals, display),
+	}
+}
+
+func usagesToPB(usages map[string]db.Usage, display func(currency.MicroUSD) string) map[string]*pb.Usage {
+	out := make(map[string]*pb.Usage, len(usages))
+	for name, u := range usages {
+		out[name] = usageToPB(u, display)
+	}
+	return out
+}
+
+func usageToPB(u db.Usage, display func(currency.MicroUSD) string) *pb.Usage {
+	return &pb.Usage{
+		AmountMicroUsd: int64(u.Amount),
+		Requests:       u.Requests,
+		InputTokens:    u.InputTokens,
+		OutputTokens:   u.OutputTokens,
+		CachedTokens:   u.CachedTokens,
+		ToolUseTokens:  u.ToolUseTokens,
+		ThinkingTokens: u.ThinkingTokens,
+		Characters:     u.Characters,
+		DisplayAmount:  display(u.Amount),
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"github.com/dafraer/sentence-gen-grpc-server/service"
+	"github.com/dafraer/sentence-gen-grpc-server/tts"
+	"github.com/dafraer/sentence-gen-grpc-server/upstream"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	//errorDomain is the domain of the google.rpc.ErrorInfo details
+	errorDomain = "sentencegen"
+	//upstreamRetryDelay is how long callers are told to wait while gemini or tts throttle or are down
+	upstreamRetryDelay = 5 * time.Second
+)
+
+// formatError maps the error of the service to a status with a stable reason and the details the caller needs to react.
+// Unexpected errors are logged by the handlers, the caller only gets a generic message without the upstream's error
+func formatError(ctx context.Context, err error) error {
+	var quotaErr *service.QuotaExceededError
+	var upstreamErr *upstream.Error
+	switch {
+	case errors.As(err, &quotaErr):
+		subject := "global"
+		if quotaErr.Plan != "" {
+			subject = "plan:" + quotaErr.Plan
+		}
+		st := statusWithReason(codes.ResourceExhausted, quotaErr.Error(), pb.ErrorReason_BUDGET_EXHAUSTED,
+			map[string]string{"period": string(quotaErr.Period), "plan": quotaErr.Plan},
+			&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{Subject: subject, Description: quotaErr.Error()}}},
+		)
+		if quotaErr.ResetsAt.IsZero() {
+			return st.Err()
+		}
+		return retryLater(ctx, st, time.Until(quotaErr.ResetsAt))
+	case errors.Is(err, service.ErrQuotaExceeded):
+		return statusWithReason(codes.ResourceExhausted, "quota limit exceeded", pb.ErrorReason_BUDGET_EXHAUSTED, nil).Err()
+	case errors.Is(err, service.ErrNotInPlan):
+		return statusWithReason(codes.PermissionDenied, err.Error(), pb.ErrorReason_NOT_IN_PLAN, nil).Err()
+	case errors.Is(err, service.ErrInvalidRequest):
+		reason := pb.ErrorReason_INVALID_REQUEST
+		if errors.Is(err, service.ErrUnsupportedLanguage) {
+			reason = pb.ErrorReason_UNSUPPORTED_LANGUAGE
+		}
+		var details []protoadapt.MessageV1
+		if violations := fieldViolations(err); len(violations) > 0 {
+			details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+		}
+		return statusWithReason(codes.InvalidArgument, strings.ReplaceAll(err.Error(), "\n", "; "), reason, nil, details...).Err()
+	case errors.Is(err, service.ErrWordNotFound):
+		return statusWithReason(codes.NotFound, "word not found in the language", pb.ErrorReason_WORD_NOT_FOUND, nil).Err()
+	case errors.Is(err, tts.ErrNoSuchVoice):
+		return statusWithReason(codes.FailedPrecondition, "no voice for the language, gender and voice tier", pb.ErrorReason_NO_VOICE, nil).Err()
+	case errors.As(err, &upstreamErr) && errors.Is(err, upstream.ErrThrottled):
+		st := statusWithReason(codes.Unavailable, upstreamErr.Upstream+" is throttling requests, retry later", pb.ErrorReason_UPSTREAM_THROTTLED,
+			map[string]string{"upstream": upstreamErr.Upstream})
+		return retryLater(ctx, st, upstreamRetryDelay)
+	case errors.As(err, &upstreamErr) && (errors.Is(err, upstream.ErrUnavailable) || errors.Is(err, upstream.ErrCircuitOpen)):
+		st := statusWithReason(codes.Unavailable, upstreamErr.Upstream+" is unavailable, retry later", pb.ErrorReason_UPSTREAM_UNAVAILABLE,
+			map[string]string{"upstream": upstreamErr.Upstream})
+		return retryLater(ctx, st, upstreamRetryDelay)
+	case errors.As(err, &upstreamErr) && errors.Is(err, context.DeadlineExceeded):
+		return statusWithReason(codes.DeadlineExceeded, upstreamErr.Upstream+" didn't answer in time", pb.ErrorReason_DEADLINE_EXCEEDED,
+			map[string]string{"upstream": upstreamErr.Upstream}).Err()
+	case errors.Is(err, context.DeadlineExceeded):
+		return statusWithReason(codes.DeadlineExceeded, "deadline exceeded", pb.ErrorReason_DEADLINE_EXCEEDED, nil).Err()
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request canceled")
+	default:
+		return statusWithReason(codes.Internal, "internal error", pb.ErrorReason_INTERNAL, nil).Err()
+	}
+}
+
+// statusWithReason returns the status with an ErrorInfo detail of the reason followed by the other details.
+// Empty metadata values are left out of the detail, the caller's map isn't changed
+func statusWithReason(code codes.Code, msg string, reason pb.ErrorReason, meta map[string]string, details ...protoadapt.MessageV1) *status.Status {
+	var kept map[string]string
+	for k, v := range meta {
+		if v == "" {
+			continue
+		}
+		if kept == nil {
+			kept = make(map[string]string, len(meta))
+		}
+		kept[k] = v
+	}
+	details = append([]protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: reason.String(), Domain: errorDomain, Metadata: kept}}, details...)
+	st, err := status.New(code, msg).WithDetails(details...)
+	if err != nil {
+		return status.New(code, msg)
+	}
+	return st
+}
+
+// retryLater adds a RetryInfo detail with the delay to the status. The delay is also set as the retry-after trailer
+// for clients that don't decode status details
+func retryLater(ctx context.Context, st *status.Status, delay time.Duration) error {
+	delay = max(delay, 0)
+	//Outside of an rpc there is no trailer to set, the detail is enough
+	_ = grpc.SetTrailer(ctx, metadata.Pairs(retryAfterTrailer, strconv.Itoa(int(math.Ceil(delay.Seconds())))))
+	withRetry, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+	if err != nil {
+		return st.Err()
+	}
+	return withRetry.Err()
+}
+
+// fieldViolations returns the invalid fields of the joined validation errors
+func fieldViolations(err error) []*errdetails.BadRequest_FieldViolation {
+	var fieldErr *service.FieldError
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		var violations []*errdetails.BadRequest_FieldViolation
+		for _, err := range e.Unwrap() {
+			violations = append(violations, fieldViolations(err)...)
+		}
+		return violations
+	case nil:
+		return nil
+	default:
+		if errors.As(err, &fieldErr) {
+			return []*errdetails.BadRequest_FieldViolation{{Field: fieldErr.Field, Description: fieldErr.Err.Error()}}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/budget"
+	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"github.com/dafraer/sentence-gen-grpc-server/service"
+	"github.com/dafraer/sentence-gen-grpc-server/tts"
+	"github.com/dafraer/sentence-gen-grpc-server/upstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusDetails are the details of a status by type
+type statusDetails struct {
+	info       *errdetails.ErrorInfo
+	quota      *errdetails.QuotaFailure
+	badRequest *errdetails.BadRequest
+	retry      *errdetails.RetryInfo
+}
+
+func detailsOf(t *testing.T, st *status.Status) statusDetails {
+	t.Helper()
+	var d statusDetails
+	for _, detail := range st.Details() {
+		switch v := detail.(type) {
+		case *errdetails.ErrorInfo:
+			d.info = v
+		case *errdetails.QuotaFailure:
+			d.quota = v
+		case *errdetails.BadRequest:
+			d.badRequest = v
+		case *errdetails.RetryInfo:
+			d.retry = v
+		default:
+			t.Errorf("unexpected detail %T", detail)
+		}
+	}
+	return d
+}
+
+func TestFormatError(t *testing.T) {
+	//leak is what the upstreams and the store say about themselves, it must never reach the caller
+	const leak = "projects/sengen-prod/locations/us-central1 quota 429"
+	upstreamErr := func(kind error) error {
+		return fmt.Errorf("generate sentence: %w", &upstream.Error{Upstream: "gemini", Kind: kind, Err: errors.New(leak)})
+	}
+	resetsAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		reason  pb.ErrorReason
+		meta    map[string]string
+		message string
+		check   func(t *testing.T, d statusDetails)
+	}{
+		{
+			name:    "plan quota exceeded",
+			err:     &service.QuotaExceededError{Period: budget.Daily, Plan: "free", ResetsAt: resetsAt},
+			code:    codes.ResourceExhausted,
+			reason:  pb.ErrorReason_BUDGET_EXHAUSTED,
+			meta:    map[string]string{"period": "daily", "plan": "free"},
+			message: "daily quota limit of the free plan exceeded",
+			check: func(t *testing.T, d statusDetails) {
+				require.NotNil(t, d.quota)
+				assert.Equal(t, "plan:free", d.quota.Violations[0].Subject)
+				require.NotNil(t, d.retry)
+				assert.InDelta(t, time.Hour.Seconds(), d.retry.RetryDelay.AsDuration().Seconds(), 5)
+			},
+		},
+		{
+			name:    "global quota exceeded",
+			err:     &service.QuotaExceededError{Period: budget.Monthly},
+			code:    codes.ResourceExhausted,
+			reason:  pb.ErrorReason_BUDGET_EXHAUSTED,
+			meta:    map[string]string{"period": "monthly"},
+			message: "monthly quota limit exceeded",
+			check: func(t *testing.T, d statusDetails) {
+				require.NotNil(t, d.quota)
+				assert.Equal(t, "global", d.quota.Violations[0].Subject)
+				assert.Nil(t, d.retry)
+			},
+		},
+		{
+			name:    "not in plan",
+			err:     fmt.Errorf("audio is %w %s", service.ErrNotInPlan, "free"),
+			code:    codes.PermissionDenied,
+			reason:  pb.ErrorReason_NOT_IN_PLAN,
+			message: "audio is not included in plan free",
+		},
+		{
+			name:    "invalid fields",
+			err:     errors.Join(&service.FieldError{Field: "word", Err: service.ErrEmptyWord}, &service.FieldError{Field: "translation_hint", Err: service.ErrHintTooLong}),
+			code:    codes.InvalidArgument,
+			reason:  pb.ErrorReason_INVALID_REQUEST,
+			message: "word: empty word; translation_hint: hint too long",
+			check: func(t *testing.T, d statusDetails) {
+				require.NotNil(t, d.badRequest)
+				assert.Equal(t, []*errdetails.BadRequest_FieldViolation{
+					{Field: "word", Description: "empty word"},
+					{Field: "translation_hint", Description: "hint too long"},
+				}, d.badRequest.FieldViolations)
+			},
+		},
+		{
+			name:    "unsupported language",
+			err:     errors.Join(&service.FieldError{Field: "word_language", Err: fmt.Errorf("%w %q", service.ErrUnsupportedLanguage, "xx-!")}),
+			code:    codes.InvalidArgument,
+			reason:  pb.ErrorReason_UNSUPPORTED_LANGUAGE,
+			message: `word_language: unsupported language "xx-!"`,
+			check: func(t *testing.T, d statusDetails) {
+				require.NotNil(t, d.badRequest)
+				assert.Equal(t, "word_language", d.badRequest.FieldViolations[0].Field)
+			},
+		},
+		{
+			name:    "word not found",
+			err:     service.ErrWordNotFound,
+			code:    codes.NotFound,
+			reason:  pb.ErrorReason_WORD_NOT_FOUND,
+			message: "word not found in the language",
+		},
+		{
+			//A broken answer of gemini is our problem, not the caller's
+			name:    "invalid response",
+			err:     fmt.Errorf("%w: %s", service.ErrInvalidResponse, leak),
+			code:    codes.Internal,
+			reason:  pb.ErrorReason_INTERNAL,
+			message: "internal error",
+		},
+		{
+			name:    "no voice",
+			err:     fmt.Errorf("%w: %s", tts.ErrNoSuchVoice, leak),
+			code:    codes.FailedPrecondition,
+			reason:  pb.ErrorReason_NO_VOICE,
+			message: "no voice for the language, gender and voice tier",
+		},
+		{
+			name:    "upstream throttled",
+			err:     upstreamErr(upstream.ErrThrottled),
+			code:    codes.Unavailable,
+			reason:  pb.ErrorReason_UPSTREAM_THROTTLED,
+			meta:    map[string]string{"upstream": "gemini"},
+			message: "gemini is throttling requests, retry later",
+			check: func(t *testing.T, d statusDetails) {
+				require.NotNil(t, d.retry)
+				assert.Equal(t, upstreamRetryDelay, d.retry.RetryDelay.AsDuration())
+			},
+		},
+		{
+			name:    "upstream unavailable",
+			err:     upstreamErr(upstream.ErrUnavailable),
+			code:    codes.Unavailable,
+			reason:  pb.ErrorReason_UPSTREAM_UNAVAILABLE,
+			meta:    map[string]string{"upstream": "gemini"},
+			message: "gemini is unavailable, retry later",
+			check: func(t *testing.T, d statusDetails) {
+				require.NotNil(t, d.retry)
+				assert.Equal(t, upstreamRetryDelay, d.retry.RetryDelay.AsDuration())
+			},
+		},
+		{
+			name:    "circuit open",
+			err:     &upstream.Error{Upstream: "tts", Kind: upstream.ErrCircuitOpen},
+			code:    codes.Unavailable,
+			reason:  pb.ErrorReason_UPSTREAM_UNAVAILABLE,
+			meta:    map[string]string{"upstream": "tts"},
+			message: "tts is unavailable, retry later",
+			check: func(t *testing.T, d statusDetails) {
+				assert.NotNil(t, d.retry)
+			},
+		},
+		{
+			name:    "upstream deadline",
+			err:     upstreamErr(context.DeadlineExceeded),
+			code:    codes.DeadlineExceeded,
+			reason:  pb.ErrorReason_DEADLINE_EXCEEDED,
+			meta:    map[string]string{"upstream": "gemini"},
+			message: "gemini didn't answer in time",
+		},
+		{
+			name:    "deadline",
+			err:     fmt.Errorf("get spending: %w", context.DeadlineExceeded),
+			code:    codes.DeadlineExceeded,
+			reason:  pb.ErrorReason_DEADLINE_EXCEEDED,
+			message: "deadline exceeded",
+		},
+		{
+			//Canceled calls have nobody left to read the reason
+			name:    "canceled",
+			err:     fmt.Errorf("%s: %w", leak, context.Canceled),
+			code:    codes.Canceled,
+			message: "request canceled",
+		},
+		{
+			name:    "unknown",
+			err:     errors.New(leak),
+			code:    codes.Internal,
+			reason:  pb.ErrorReason_INTERNAL,
+			message: "internal error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, ok := status.FromError(formatError(context.Background(), tt.err))
+			require.True(t, ok)
+			assert.Equal(t, tt.code, st.Code())
+			assert.Equal(t, tt.message, st.Message())
+			assert.NotContains(t, fmt.Sprint(st.Proto()), leak)
+
+			d := detailsOf(t, st)
+			if tt.reason == pb.ErrorReason_ERROR_REASON_UNSPECIFIED {
+				assert.Nil(t, d.info)
+			} else {
+				require.NotNil(t, d.info)
+				assert.Equal(t, tt.reason.String(), d.info.Reason)
+				assert.Equal(t, errorDomain, d.info.Domain)
+				if tt.meta == nil {
+					assert.Empty(t, d.info.Metadata)
+				} else {
+					assert.Equal(t, tt.meta, d.info.Metadata)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, d)
+			} else {
+				assert.Nil(t, d.quota)
+				assert.Nil(t, d.badRequest)
+				assert.Nil(t, d.retry)
+			}
+		})
+	}
+}
+
+func TestStatusWithReason(t *testing.T) {
+	//Empty values are left out of the detail without changing the caller's map
+	meta := map[string]string{"period": "daily", "plan": ""}
+	st := statusWithReason(codes.ResourceExhausted, "quota limit exceeded", pb.ErrorReason_BUDGET_EXHAUSTED, meta)
+	d := detailsOf(t, st)
+	require.NotNil(t, d.info)
+	assert.Equal(t, map[string]string{"period": "daily"}, d.info.Metadata)
+	assert.Equal(t, map[string]string{"period": "daily", "plan": ""}, meta)
+}
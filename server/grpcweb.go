@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+)
+
+// grpcWebHandler serves the SentenceGen rpcs of the grpc server to browsers over grpc-web.
+// Requests go through the grpc server itself, so they pass the same interceptors and fail with the same codes
+func grpcWebHandler(srv *grpc.Server, allowedOrigins []string) http.Handler {
+	allowed := func(origin string) bool {
+		return slices.Contains(allowedOrigins, "*") || slices.Contains(allowedOrigins, origin)
+	}
+	wrapped := grpcweb.WrapServer(srv, grpcweb.WithOriginFunc(allowed))
+	prefix := "/" + pb.SentenceGen_ServiceDesc.ServiceName + "/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//Admin, health and reflection stay native grpc only
+		if !strings.HasPrefix(r.URL.Path, prefix) || !(wrapped.IsGrpcWebRequest(r) || wrapped.IsAcceptableGrpcCorsRequest(r)) {
+			http.NotFound(w, r)
+			return
+		}
+		//Calls from pages of other origins are refused before they reach the rpc, not only hidden from the page by cors.
+		//Clients outside of browsers send no origin
+		if origin := r.Header.Get("Origin"); origin != "" && !allowed(origin) && !sameOrigin(origin, r.Host) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		wrapped.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin reports whether the origin is the host the request was sent to
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == host
+}
+
+// serveHTTP serves the handler at addr until ctx is done. The returned function waits for the server to shut down
+func (s *Server) serveHTTP(ctx context.Context, name, addr string, handler http.Handler) func() {
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	if s.options.TLS != nil {
+		srv.TLSConfig = s.options.TLS.TLSConfig()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			s.logger.Errorw("failed to shut down "+name, "error", err)
+		}
+	}()
+	go func() {
+		s.logger.Infow("serving "+name, "address", addr)
+		var err error
+		if srv.TLSConfig != nil {
+			//The certificates come from the tls config
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Errorw(name+" failed", "error", err)
+		}
+	}()
+	return func() { <-done }
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type unimplementedSentenceGen struct {
+	pb.UnimplementedSentenceGenServer
+}
+
+// newGRPCWebHandler returns the grpc-web handler of a server with the SentenceGen, Admin and health services
+func newGRPCWebHandler(t *testing.T, allowedOrigins []string) http.Handler {
+	t.Helper()
+	srv := grpc.NewServer()
+	pb.RegisterSentenceGenServer(srv, unimplementedSentenceGen{})
+	pb.RegisterAdminServer(srv, pb.UnimplementedAdminServer{})
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	t.Cleanup(srv.Stop)
+	return grpcWebHandler(srv, allowedOrigins)
+}
+
+// grpcWebRequest sends a grpc-web call with an empty message from the origin
+func grpcWebRequest(h http.Handler, path, origin string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader("\x00\x00\x00\x00\x00"))
+	r.Header.Set("Content-Type", "application/grpc-web+proto")
+	r.Header.Set("X-Grpc-Web", "1")
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// preflight sends the cors preflight of a grpc-web call from the origin
+func preflight(h http.Handler, path, origin string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodOptions, path, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	r.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestGRPCWebHandler(t *testing.T) {
+	const translate = "/sentencegen.SentenceGen/Translate"
+	h := newGRPCWebHandler(t, []string{"https://app.example.com"})
+
+	tests := []struct {
+		name   string
+		path   string
+		origin string
+		//code is the http status, grpcCode the grpc status of calls that reach the server
+		code     int
+		grpcCode codes.Code
+		cors     bool
+	}{
+		{name: "allowed origin", path: translate, origin: "https://app.example.com", code: http.StatusOK, grpcCode: codes.Unimplemented, cors: true},
+		{name: "same origin", path: translate, origin: "http://example.com", code: http.StatusOK, grpcCode: codes.Unimplemented},
+		{name: "no origin", path: translate, code: http.StatusOK, grpcCode: codes.Unimplemented},
+		{name: "refused origin", path: translate, origin: "https://evil.example.com", code: http.StatusForbidden},
+		{name: "admin", path: "/sentencegen.Admin/GetSpendingReport", origin: "https://app.example.com", code: http.StatusNotFound},
+		{name: "health", path: "/grpc.health.v1.Health/Check", origin: "https://app.example.com", code: http.StatusNotFound},
+		{name: "reflection", path: "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", origin: "https://app.example.com", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := grpcWebRequest(h, tt.path, tt.origin)
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, strconv.Itoa(int(tt.grpcCode)), w.Header().Get("Grpc-Status"))
+			}
+			if tt.cors {
+				assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+			} else {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+}
+
+func TestGRPCWebHandler_Preflight(t *testing.T) {
+	const translate = "/sentencegen.SentenceGen/Translate"
+	h := newGRPCWebHandler(t, []string{"https://app.example.com"})
+
+	w := preflight(h, translate, "https://app.example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "X-Grpc-Web")
+
+	w = preflight(h, translate, "https://evil.example.com")
+	assert.NotEqual(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = preflight(h, "/sentencegen.Admin/GetSpendingReport", "https://app.example.com")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	//Any origin may call with *
+	w = grpcWebRequest(newGRPCWebHandler(t, []string{"*"}), translate, "https://evil.example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://evil.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"github.com/dafraer/sentence-gen-grpc-server/service"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// watchHealth updates the health status every interval until ctx is done.
+// The server as a whole ("") is serving while its dependencies are ready. The SentenceGen service
+// is also not serving while the budget is exhausted, the Admin service keeps serving
+func (s *Server) watchHealth(ctx context.Context, hs *health.Server, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.updateHealth(ctx, hs, interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) updateHealth(ctx context.Context, hs *health.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ready := s.srvc.Ready(ctx)
+	quota := s.srvc.CheckQuota(ctx)
+
+	server, sentenceGen := healthpb.HealthCheckResponse_SERVING, healthpb.HealthCheckResponse_SERVING
+	switch {
+	case ready != nil:
+		s.logger.Errorw("health check failed", "error", ready)
+		server, sentenceGen = healthpb.HealthCheckResponse_NOT_SERVING, healthpb.HealthCheckResponse_NOT_SERVING
+	case errors.Is(quota, service.ErrQuotaExceeded):
+		s.logger.Infow("health check: budget exhausted", "error", quota)
+		sentenceGen = healthpb.HealthCheckResponse_NOT_SERVING
+	case quota != nil:
+		s.logger.Errorw("health check failed to check quota", "error", quota)
+		sentenceGen = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	hs.SetServingStatus("", server)
+	hs.SetServingStatus(pb.SentenceGen_ServiceDesc.ServiceName, sentenceGen)
+	hs.SetServingStatus(pb.Admin_ServiceDesc.ServiceName, server)
+	s.logger.Debugw("health status updated", "server", server, "sentence_gen", sentenceGen)
+}
+
+// isHealthMethod reports whether the rpc belongs to the health service. Health checks come from probes
+// without credentials and must keep working when the budget is used up
+func isHealthMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/budget"
+	"github.com/dafraer/sentence-gen-grpc-server/config"
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/dafraer/sentence-gen-grpc-server/gemini"
+	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"github.com/dafraer/sentence-gen-grpc-server/service"
+	"github.com/dafraer/sentence-gen-grpc-server/tts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthStore is a spending store that only serves the spending read by health checks
+type healthStore struct {
+	mu     sync.Mutex
+	amount currency.MicroUSD
+	err    error
+}
+
+func (h *healthStore) set(amount currency.MicroUSD, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.amount, h.err = amount, err
+}
+
+func (h *healthStore) GetSpending(context.Context, string) (*db.Spending, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil {
+		return nil, h.err
+	}
+	return &db.Spending{Amount: h.amount}, nil
+}
+
+func (h *healthStore) GetPrincipalSpending(context.Context, string) (map[string]db.Usage, error) {
+	return nil, nil
+}
+
+func (h *healthStore) AddLedgerEntry(context.Context, *db.LedgerEntry) error { return nil }
+
+func (h *healthStore) MarkAlert(context.Context, string, int) (bool, error) { return false, nil }
+
+func (h *healthStore) AddSpending(context.Context, []string, *db.Spending) error { return nil }
+
+func (h *healthStore) ReserveSpending(context.Context, currency.MicroUSD, []db.Limit) (*db.Reservation, error) {
+	return &db.Reservation{}, nil
+}
+
+func (h *healthStore) SettleSpending(context.Context, *db.Reservation, *db.Spending) error {
+	return nil
+}
+
+func TestServer_updateHealth(t *testing.T) {
+	ctx := context.Background()
+	store := &healthStore{}
+	cfg := &config.Config{Budgets: []budget.Window{{Period: budget.Daily, Limit: 1000, Location: time.UTC}}}
+	logger := zap.NewNop().Sugar()
+	hs := health.NewServer()
+	status := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := hs.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.Status
+	}
+	serving, notServing := healthpb.HealthCheckResponse_SERVING, healthpb.HealthCheckResponse_NOT_SERVING
+
+	tests := []struct {
+		name        string
+		upstream    bool
+		amount      currency.MicroUSD
+		err         error
+		server      healthpb.HealthCheckResponse_ServingStatus
+		sentenceGen healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{name: "upstream clients missing", server: notServing, sentenceGen: notServing},
+		{name: "ready", upstream: true, amount: 999, server: serving, sentenceGen: serving},
+		//Admins can still inspect and raise the budget
+		{name: "budget exhausted", upstream: true, amount: 1000, server: serving, sentenceGen: notServing},
+		{name: "store unreachable", upstream: true, err: errors.New("store unavailable"), server: notServing, sentenceGen: notServing},
+		{name: "recovered", upstream: true, server: serving, sentenceGen: serving},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var geminiClient *gemini.Client
+			var ttsClient *tts.Client
+			if tt.upstream {
+				geminiClient, ttsClient = &gemini.Client{}, &tts.Client{}
+			}
+			srvc := service.New(ttsClient, geminiClient, logger, store, cfg, nil, nil)
+			s := NewServer(srvc, nil, nil, nil, nil, nil, Options{}, logger)
+			store.set(tt.amount, tt.err)
+
+			s.updateHealth(ctx, hs, time.Second)
+			assert.Equal(t, tt.server, status(""))
+			assert.Equal(t, tt.sentenceGen, status(pb.SentenceGen_ServiceDesc.ServiceName))
+			assert.Equal(t, tt.server, status(pb.Admin_ServiceDesc.ServiceName))
+		})
+	}
+}
+
+func TestIsHealthMethod(t *testing.T) {
+	assert.True(t, isHealthMethod("/grpc.health.v1.Health/Check"))
+	assert.True(t, isHealthMethod("/grpc.health.v1.Health/Watch"))
+	assert.False(t, isHealthMethod("/sentencegen.SentenceGen/Translate"))
+	assert.False(t, isHealthMethod("/grpc.health.v1.HealthX/Check"))
+}
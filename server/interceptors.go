@@ -2,24 +2,236 @@ package server
 
 import (
 	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
 
+	"github.com/dafraer/sentence-gen-grpc-server/auth"
+	"github.com/dafraer/sentence-gen-grpc-server/gateway"
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	"github.com/dafraer/sentence-gen-grpc-server/plan"
+	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"github.com/dafraer/sentence-gen-grpc-server/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
-// quotaLimitInterceptor checks that the request doesn't exceed daily quota
-func (s *Server) quotaLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	s.logger.Debugw("quota interceptor check started", "method", info.FullMethod)
-	exceeded, err := s.srvc.DailyQuotaExceeded(ctx)
+const (
+	apiKeyHeader        = "x-api-key"
+	authorizationHeader = "authorization"
+	bearerPrefix        = "bearer "
+	retryAfterTrailer   = "retry-after"
+	requestIDHeader     = "x-request-id"
+	maxRequestIDLength  = 128
+)
+
+// metricsInterceptor counts the rpcs by method and status code and records their latency.
+// It runs first, so calls rejected by the other interceptors are counted too
+func (s *Server) metricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if s.metrics == nil {
+		return handler(ctx, req)
+	}
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	s.metrics.ObserveRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+	return resp, err
+}
+
+// requestIDInterceptor puts the request id into the context and the response header.
+// The caller's x-request-id is kept if it is well formed, otherwise a new id is generated
+func (s *Server) requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(requestIDHeader); len(v) > 0 && validRequestID(v[0]) {
+			id = v[0]
+		}
+	}
+	if id == "" {
+		id = logging.NewRequestID()
+	}
+	ctx = logging.NewContext(ctx, id, s.logger)
+	if err := grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id)); err != nil {
+		s.log(ctx).Debugw("failed to set request id header", "error", err)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("sengen.request_id", id))
+	return handler(ctx, req)
+}
+
+// validRequestID checks that the id is short and printable, so it's safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' || r == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// authInterceptor authenticates the caller with the bearer token, the api key or the client certificate
+func (s *Server) authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if isHealthMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	if s.auth == nil && s.verifier == nil {
+		//Client certificates still name the caller for quotas and logs
+		if principal := certPrincipal(ctx); principal != nil {
+			ctx = auth.NewContext(ctx, principal)
+		}
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	principal, err := s.authenticate(ctx, md, info.FullMethod)
+	switch {
+	case err == nil:
+	case errors.Is(err, auth.ErrScopeDenied):
+		s.log(ctx).Infow("auth interceptor denied request", "method", info.FullMethod, "error", err)
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, auth.ErrMissingKey) || errors.Is(err, auth.ErrKeyNotFound) || errors.Is(err, auth.ErrKeyRevoked) || errors.Is(err, auth.ErrKeyExpired):
+		s.log(ctx).Infow("auth interceptor rejected request", "method", info.FullMethod, "error", err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, auth.ErrMissingToken) || errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrUnknownKey):
+		s.log(ctx).Infow("auth interceptor rejected request", "method", info.FullMethod, "error", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	default:
+		s.log(ctx).Errorw("auth interceptor failed to authenticate request", "error", err)
+		return nil, status.Error(codes.Internal, "failed to authenticate request")
+	}
+
+	s.log(ctx).Debugw("auth interceptor passed", "method", info.FullMethod, "principal", principal.Name, "kind", principal.Kind)
+	return handler(auth.NewContext(ctx, principal), req)
+}
+
+// authenticate verifies the bearer token if present, then the api key. Callers with a verified client certificate
+// and no api key are authenticated by the certificate
+func (s *Server) authenticate(ctx context.Context, md metadata.MD, fullMethod string) (*auth.Principal, error) {
+	if token, ok := bearerToken(md); ok && s.verifier != nil {
+		return s.verifier.Verify(ctx, token)
+	}
+	if principal := certPrincipal(ctx); principal != nil && firstValue(md, apiKeyHeader) == "" {
+		return principal, nil
+	}
+	if s.auth != nil {
+		return s.auth.Authenticate(ctx, firstValue(md, apiKeyHeader), fullMethod)
+	}
+	return nil, auth.ErrMissingToken
+}
+
+func bearerToken(md metadata.MD) (string, bool) {
+	value := firstValue(md, authorizationHeader)
+	if len(value) < len(bearerPrefix) || !strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(value[len(bearerPrefix):]), true
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// rateLimitInterceptor throttles callers that exceed their token bucket
+func (s *Server) rateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if s.limiter == nil || isHealthMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	principal := ""
+	if p, ok := auth.FromContext(ctx); ok {
+		principal = p.ID()
+	}
+	ip := peerIP(ctx)
+
+	allowed, retryAfter := s.limiter.Allow(info.FullMethod, principal, ip)
+	if allowed {
+		return handler(ctx, req)
+	}
+
+	s.log(ctx).Infow("rate limited request blocked", "method", info.FullMethod, "principal", principal, "ip", ip, "retry_after", retryAfter)
+	return nil, rateLimited(ctx, "rate limit exceeded", retryAfter)
+}
+
+// rateLimited returns the ResourceExhausted error telling the caller to retry after the delay
+func rateLimited(ctx context.Context, msg string, retryAfter time.Duration) error {
+	return retryLater(ctx, statusWithReason(codes.ResourceExhausted, msg, pb.ErrorReason_RATE_LIMITED, nil), retryAfter)
+}
+
+// planInterceptor enforces the rpcs and the rate limit of the caller's plan and passes the plan on to the service.
+// Anonymous callers are on the default plan. The admin rpcs are not part of any plan
+func (s *Server) planInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if s.plans == nil || isAdminMethod(info.FullMethod) || isHealthMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	principal := ""
+	if p, ok := auth.FromContext(ctx); ok {
+		principal = p.ID()
+	}
+	name, p := s.plans.Lookup(principal)
+	if !p.AllowsMethod(info.FullMethod) {
+		s.log(ctx).Infow("plan interceptor denied request", "method", info.FullMethod, "principal", principal, "plan", name)
+		return nil, statusWithReason(codes.PermissionDenied, "method is not included in plan "+name, pb.ErrorReason_NOT_IN_PLAN, map[string]string{"plan": name}).Err()
+	}
+	ip := peerIP(ctx)
+	if allowed, retryAfter := s.plans.Allow(name, info.FullMethod, principal, ip); !allowed {
+		s.log(ctx).Infow("plan rate limited request blocked", "method", info.FullMethod, "principal", principal, "ip", ip, "plan", name, "retry_after", retryAfter)
+		return nil, rateLimited(ctx, "rate limit of plan "+name+" exceeded", retryAfter)
+	}
+
+	s.log(ctx).Debugw("plan interceptor passed", "method", info.FullMethod, "principal", principal, "plan", name)
+	return handler(plan.NewContext(ctx, &plan.Subscription{Name: name, Plan: p}), req)
+}
+
+// isAdminMethod reports whether the rpc belongs to the admin service
+func isAdminMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+pb.Admin_ServiceDesc.ServiceName+"/")
+}
+
+// peerIP returns the ip address of the caller. Calls from the http gateway carry the ip of the http client,
+// the header is only trusted on the in-process connection, which can't be reached from outside
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if p.Addr.Network() == "bufconn" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(gateway.ClientIPHeader)) > 0 {
+			return md.Get(gateway.ClientIPHeader)[0]
+		}
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
 	if err != nil {
-		s.logger.Errorw("quota interceptor failed to check daily quota", "error", err)
-		return nil, status.Error(codes.Internal, err.Error())
+		return p.Addr.String()
+	}
+	return host
+}
+
+// quotaLimitInterceptor checks that the request doesn't exceed the quota of any budget window.
+// The admin and health rpcs don't spend anything and must keep working when the budget is used up
+func (s *Server) quotaLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if isAdminMethod(info.FullMethod) || isHealthMethod(info.FullMethod) {
+		return handler(ctx, req)
 	}
-	if exceeded {
-		s.logger.Infow("quota exceeded request blocked", "method", info.FullMethod)
-		return nil, status.Errorf(codes.ResourceExhausted, "daily quota limit exceeded")
+	s.log(ctx).Debugw("quota interceptor check started", "method", info.FullMethod)
+	if err := s.srvc.CheckQuota(ctx); err != nil {
+		if errors.Is(err, service.ErrQuotaExceeded) {
+			s.log(ctx).Infow("quota exceeded request blocked", "method", info.FullMethod, "error", err)
+		} else {
+			s.log(ctx).Errorw("quota interceptor failed to check quota", "error", err)
+		}
+		return nil, formatError(ctx, err)
 	}
-	s.logger.Debugw("quota interceptor passed", "method", info.FullMethod)
+	s.log(ctx).Debugw("quota interceptor passed", "method", info.FullMethod)
 	return handler(ctx, req)
 }
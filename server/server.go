@@ -4,32 +4,75 @@ import (
 	"context"
 	"errors"
 	"net"
+	"time"
 
+	"github.com/dafraer/sentence-gen-grpc-server/auth"
+	"github.com/dafraer/sentence-gen-grpc-server/certs"
+	"github.com/dafraer/sentence-gen-grpc-server/gateway"
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	"github.com/dafraer/sentence-gen-grpc-server/metrics"
+	"github.com/dafraer/sentence-gen-grpc-server/plan"
 	pb "github.com/dafraer/sentence-gen-grpc-server/proto"
+	"github.com/dafraer/sentence-gen-grpc-server/ratelimit"
 	"github.com/dafraer/sentence-gen-grpc-server/service"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	channelzservice "google.golang.org/grpc/channelz/service"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// gatewayBufferSize is the buffer of the in-process connection of the http gateway
+const gatewayBufferSize = 1 << 20
+
 type Server struct {
 	pb.UnimplementedSentenceGenServer
-	srvc   *service.Service
-	logger *zap.SugaredLogger
+	srvc     *service.Service
+	auth     *auth.Authenticator
+	verifier *auth.Verifier
+	limiter  *ratelimit.Limiter
+	plans    *plan.Registry
+	metrics  *metrics.Metrics
+	options  Options
+	logger   *zap.SugaredLogger
+}
+
+// Options switches the reflection and channelz services and tracing on, sets how often the health status is updated
+// and the addresses of the http gateway and the grpc-web server, which are off if empty
+type Options struct {
+	Reflection     bool
+	Channelz       bool
+	Tracing        bool
+	HealthInterval time.Duration
+	GatewayAddress string
+	GRPCWebAddress string
+	//CORSOrigins are the origins browsers may call the grpc-web server from, * allows any
+	CORSOrigins []string
+	//TLS serves the grpc listener, the gateway and the grpc-web server over tls with the reloaded certificates, nil serves plaintext
+	TLS *certs.Reloader
 }
 
-// NewServer creates new server
-func NewServer(srvc *service.Service, logger *zap.SugaredLogger) *Server {
-	return &Server{srvc: srvc, logger: logger}
+// NewServer creates new server. If both authenticator and verifier are nil requests are not authenticated,
+// if limiter is nil requests are not rate limited, if plans is nil every caller may use everything, if m is nil no metrics are collected
+func NewServer(srvc *service.Service, authenticator *auth.Authenticator, verifier *auth.Verifier, limiter *ratelimit.Limiter, plans *plan.Registry, m *metrics.Metrics, options Options, logger *zap.SugaredLogger) *Server {
+	return &Server{srvc: srvc, auth: authenticator, verifier: verifier, limiter: limiter, plans: plans, metrics: m, options: options, logger: logger}
 }
 
 func (s *Server) GenerateSentence(ctx context.Context, request *pb.GenerateSentenceRequest) (*pb.GenerateSentenceResponse, error) {
 	if request == nil {
-		s.logger.Errorw("generate sentence rpc failed: nil request", "error", errors.New("nil request"))
+		s.log(ctx).Errorw("generate sentence rpc failed: nil request", "error", errors.New("nil request"))
 		return nil, status.Error(codes.InvalidArgument, "nil request")
 	}
-	s.logger.Infow("generate sentence rpc request received", "word", request.Word, "word_language", request.WordLanguage, "translation_language", request.TranslationLanguage, "include_audio", request.IncludeAudio)
+	s.log(ctx).Infow("generate sentence rpc request received", "word", request.Word, "word_language", request.WordLanguage, "translation_language", request.TranslationLanguage, "include_audio", request.IncludeAudio)
 
 	result, err := s.srvc.GenerateSentence(ctx, &service.GenerateSentenceRequest{
 		Word:                request.Word,
@@ -40,8 +83,8 @@ func (s *Server) GenerateSentence(ctx context.Context, request *pb.GenerateSente
 		VoiceGender:         service.Gender(request.VoiceGender),
 	})
 	if err != nil {
-		s.logger.Errorw("generate sentence rpc failed", "error", err)
-		return nil, formatError(err)
+		s.log(ctx).Errorw("generate sentence rpc failed", "error", err)
+		return nil, formatError(ctx, err)
 	}
 	resp := &pb.GenerateSentenceResponse{
 		OriginalSentence:   result.OriginalSentence,
@@ -49,17 +92,19 @@ func (s *Server) GenerateSentence(ctx context.Context, request *pb.GenerateSente
 		Audio: &pb.Audio{
 			Data: result.Audio,
 		},
+		Usage:       usageToCallPB(result.Usage),
+		Degradation: degradationToPB(result.Degradation),
 	}
-	s.logger.Infow("generate sentence rpc completed", "has_audio", len(result.Audio) > 0)
+	s.log(ctx).Infow("generate sentence rpc completed", "has_audio", len(result.Audio) > 0)
 	return resp, nil
 }
 
 func (s *Server) Translate(ctx context.Context, request *pb.TranslateRequest) (*pb.TranslateResponse, error) {
 	if request == nil {
-		s.logger.Errorw("translate rpc failed: nil request", "error", errors.New("nil request"))
+		s.log(ctx).Errorw("translate rpc failed: nil request", "error", errors.New("nil request"))
 		return nil, status.Error(codes.InvalidArgument, "nil request")
 	}
-	s.logger.Infow("translate rpc request received", "word", request.Word, "from_language", request.FromLanguage, "to_language", request.ToLanguage, "include_audio", request.IncludeAudio)
+	s.log(ctx).Infow("translate rpc request received", "word", request.Word, "from_language", request.FromLanguage, "to_language", request.ToLanguage, "include_audio", request.IncludeAudio)
 
 	result, err := s.srvc.Translate(ctx, &service.TranslateRequest{
 		Word:            request.Word,
@@ -70,25 +115,27 @@ func (s *Server) Translate(ctx context.Context, request *pb.TranslateRequest) (*
 		VoiceGender:     service.Gender(request.VoiceGender),
 	})
 	if err != nil {
-		s.logger.Errorw("translate rpc failed", "error", err)
-		return nil, formatError(err)
+		s.log(ctx).Errorw("translate rpc failed", "error", err)
+		return nil, formatError(ctx, err)
 	}
 	resp := &pb.TranslateResponse{
 		Translation: result.Translation,
 		Audio: &pb.Audio{
 			Data: result.Audio,
 		},
+		Usage:       usageToCallPB(result.Usage),
+		Degradation: degradationToPB(result.Degradation),
 	}
-	s.logger.Infow("translate rpc completed", "has_audio", len(result.Audio) > 0)
+	s.log(ctx).Infow("translate rpc completed", "has_audio", len(result.Audio) > 0)
 	return resp, nil
 }
 
 func (s *Server) GenerateDefinition(ctx context.Context, request *pb.GenerateDefinitionRequest) (*pb.GenerateDefinitionResponse, error) {
 	if request == nil {
-		s.logger.Errorw("generate definition rpc failed: nil request", "error", errors.New("nil request"))
+		s.log(ctx).Errorw("generate definition rpc failed: nil request", "error", errors.New("nil request"))
 		return nil, status.Error(codes.InvalidArgument, "nil request")
 	}
-	s.logger.Infow("generate definition rpc request received", "word", request.Word, "language", request.Language, "include_audio", request.IncludeAudio)
+	s.log(ctx).Infow("generate definition rpc request received", "word", request.Word, "language", request.Language, "include_audio", request.IncludeAudio)
 
 	result, err := s.srvc.GenerateDefinition(ctx, &service.GenerateDefinitionRequest{
 		Word:           request.Word,
@@ -98,20 +145,27 @@ func (s *Server) GenerateDefinition(ctx context.Context, request *pb.GenerateDef
 		VoiceGender:    service.Gender(request.VoiceGender),
 	})
 	if err != nil {
-		s.logger.Errorw("generate definition rpc failed", "error", err)
-		return nil, formatError(err)
+		s.log(ctx).Errorw("generate definition rpc failed", "error", err)
+		return nil, formatError(ctx, err)
 	}
 	resp := &pb.GenerateDefinitionResponse{
 		Definition: result.Definition,
 		Audio: &pb.Audio{
 			Data: result.Audio,
 		},
+		Usage:       usageToCallPB(result.Usage),
+		Degradation: degradationToPB(result.Degradation),
 	}
-	s.logger.Infow("generate definition rpc completed", "has_audio", len(result.Audio) > 0)
+	s.log(ctx).Infow("generate definition rpc completed", "has_audio", len(result.Audio) > 0)
 
 	return resp, nil
 }
 
+// log returns the logger with the request id of ctx
+func (s *Server) log(ctx context.Context) *zap.SugaredLogger {
+	return logging.FromContext(ctx, s.logger)
+}
+
 func (s *Server) Run(ctx context.Context, addr string) error {
 	s.logger.Infow("starting grpc server", "address", addr)
 	l, err := net.Listen("tcp", addr)
@@ -121,10 +175,49 @@ func (s *Server) Run(ctx context.Context, addr string) error {
 	}
 
 	opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(s.quotaLimitInterceptor),
+		grpc.ChainUnaryInterceptor(s.metricsInterceptor, s.requestIDInterceptor, s.authInterceptor, s.planInterceptor, s.rateLimitInterceptor, s.quotaLimitInterceptor),
+	}
+	if s.options.TLS != nil {
+		opts = append(opts, grpc.Creds(listenerCredentials{credentials.NewTLS(s.options.TLS.TLSConfig())}))
+		s.logger.Infow("grpc server tls enabled")
+	}
+	if s.options.Tracing {
+		//Server spans continue the caller's trace, health checks aren't traced
+		opts = append(opts, grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))))
 	}
 	srv := grpc.NewServer(opts...)
 	pb.RegisterSentenceGenServer(srv, s)
+	pb.RegisterAdminServer(srv, &adminServer{srvc: s.srvc, plans: s.plans, logger: s.logger})
+
+	//Health checks are served while the server runs, the status follows the dependencies and the budget
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	healthCtx, stopHealth := context.WithCancel(ctx)
+	defer stopHealth()
+	go s.watchHealth(healthCtx, hs, s.options.HealthInterval)
+
+	//Reflection and channelz are stream services, so they are not authenticated
+	if s.options.Reflection {
+		reflection.Register(srv)
+		s.logger.Infow("grpc reflection enabled")
+	}
+	if s.options.Channelz {
+		channelzservice.RegisterChannelzServiceToServer(srv)
+		s.logger.Infow("grpc channelz enabled")
+	}
+
+	//The http gateway calls the rpcs over an in-process connection, so they pass the same interceptors
+	if s.options.GatewayAddress != "" {
+		stopGateway, err := s.runGateway(ctx, srv)
+		if err != nil {
+			return err
+		}
+		defer stopGateway()
+	}
+
+	if s.options.GRPCWebAddress != "" {
+		defer s.serveHTTP(ctx, "grpc-web server", s.options.GRPCWebAddress, grpcWebHandler(srv, s.options.CORSOrigins))()
+	}
 
 	//Create a channel to listen for errors
 	ch := make(chan error)
@@ -146,6 +239,8 @@ func (s *Server) Run(ctx context.Context, addr string) error {
 	select {
 	case <-ctx.Done():
 		s.logger.Infow("grpc server context canceled, stopping server")
+		//Tell the load balancers to stop sending requests before draining
+		hs.Shutdown()
 		srv.GracefulStop()
 		err := <-ch
 		if err != nil {
@@ -162,11 +257,66 @@ func (s *Server) Run(ctx context.Context, addr string) error {
 	return nil
 }
 
-func formatError(err error) error {
-	switch {
-	case errors.Is(err, service.ErrInvalidRequest) || errors.Is(err, service.ErrInvalidResponse):
-		return status.Error(codes.InvalidArgument, err.Error())
-	default:
-		return status.Error(codes.Internal, err.Error())
+// runGateway serves the grpc server on an in-process listener and the http gateway in front of it.
+// The returned function waits for the gateway to shut down once ctx is done
+func (s *Server) runGateway(ctx context.Context, srv *grpc.Server) (func(), error) {
+	lis := bufconn.Listen(gatewayBufferSize)
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			s.logger.Errorw("grpc server failed to serve the gateway", "error", err)
+		}
+	}()
+	conn, err := grpc.NewClient("passthrough:///gateway",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.logger.Errorw("failed to connect the gateway", "error", err)
+		return nil, err
+	}
+	wait := s.serveHTTP(ctx, "http gateway", s.options.GatewayAddress, gateway.New(pb.NewSentenceGenClient(conn), s.logger).Handler())
+	return func() {
+		wait()
+		_ = conn.Close()
+	}, nil
+}
+
+func usageToCallPB(u *service.Usage) *pb.CallUsage {
+	if u == nil {
+		return nil
+	}
+	resp := &pb.CallUsage{
+		CostMicroUsd:   int64(u.Cost),
+		Model:          u.GeminiModel,
+		InputTokens:    u.GeminiInputTokens,
+		CachedTokens:   u.GeminiCachedTokens,
+		ToolUseTokens:  u.GeminiToolUseTokens,
+		OutputTokens:   u.GeminiOutputTokens,
+		ThinkingTokens: u.GeminiThinkingTokens,
+		Voice:          u.TTSModel,
+		Characters:     u.Characters,
+	}
+	for _, b := range u.Budgets {
+		resp.Budgets = append(resp.Budgets, &pb.RemainingBudget{
+			Period:            string(b.Window.Period),
+			TimeZone:          b.Window.Location.String(),
+			RemainingMicroUsd: int64(b.Remaining),
+			ResetsAt:          timestamppb.New(b.ResetsAt),
+			Plan:              b.Plan,
+		})
+	}
+	return resp
+}
+
+func degradationToPB(d *service.Degradation) *pb.Degradation {
+	if d == nil {
+		return nil
+	}
+	return &pb.Degradation{
+		BudgetPercent: int32(d.BudgetPercent),
+		TtsVoice:      d.TTSVoice,
+		AudioDropped:  d.AudioDropped,
+		GeminiModel:   d.GeminiModel,
+		Cached:        d.Cached,
 	}
 }
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"net"
+
+	"github.com/dafraer/sentence-gen-grpc-server/auth"
+	"github.com/dafraer/sentence-gen-grpc-server/certs"
+	"github.com/dafraer/sentence-gen-grpc-server/gateway"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// listenerCredentials does the tls handshake on the tcp listener. The in-process connection of the http gateway
+// can't be reached from outside, so it stays plaintext
+type listenerCredentials struct {
+	credentials.TransportCredentials
+}
+
+func (c listenerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if conn.LocalAddr().Network() == "bufconn" {
+		return insecure.NewCredentials().ServerHandshake(conn)
+	}
+	return c.TransportCredentials.ServerHandshake(conn)
+}
+
+func (c listenerCredentials) Clone() credentials.TransportCredentials {
+	return listenerCredentials{c.TransportCredentials.Clone()}
+}
+
+// certPrincipal returns the principal of the verified client certificate of the caller, if any.
+// The principal is named by the common name of the subject or the whole subject without one.
+// Calls from the http gateway carry the subject of the certificate the gateway verified,
+// the header is only trusted on the in-process connection, which can't be reached from outside
+func certPrincipal(ctx context.Context) *auth.Principal {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if p.Addr != nil && p.Addr.Network() == "bufconn" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if name := firstValue(md, gateway.ClientCertHeader); name != "" {
+			return &auth.Principal{Name: name, Kind: auth.KindClientCert}
+		}
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return &auth.Principal{Name: certs.SubjectName(info.State.VerifiedChains[0][0]), Kind: auth.KindClientCert}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	"github.com/dafraer/sentence-gen-grpc-server/auth"
+	"github.com/dafraer/sentence-gen-grpc-server/gateway"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// bufconnAddr is the address of the in-process connection of the http gateway
+type bufconnAddr struct{}
+
+func (bufconnAddr) Network() string { return "bufconn" }
+func (bufconnAddr) String() string  { return "bufconn" }
+
+func TestCertPrincipal(t *testing.T) {
+	tcp := &net.TCPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 51234}
+	verified := func(subject pkix.Name) credentials.AuthInfo {
+		return credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: subject}}}}}
+	}
+	gatewayHeader := metadata.Pairs(gateway.ClientCertHeader, "mobile-app")
+
+	tests := []struct {
+		name      string
+		peer      *peer.Peer
+		md        metadata.MD
+		principal *auth.Principal
+	}{
+		{name: "no peer"},
+		{name: "plaintext", peer: &peer.Peer{Addr: tcp}},
+		{name: "verified certificate", peer: &peer.Peer{Addr: tcp, AuthInfo: verified(pkix.Name{CommonName: "mobile-app"})}, principal: &auth.Principal{Name: "mobile-app", Kind: auth.KindClientCert}},
+		{name: "subject without common name", peer: &peer.Peer{Addr: tcp, AuthInfo: verified(pkix.Name{Organization: []string{"Acme"}})}, principal: &auth.Principal{Name: "O=Acme", Kind: auth.KindClientCert}},
+		{name: "unverified certificate", peer: &peer.Peer{Addr: tcp, AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{{}}}}}},
+		{name: "gateway", peer: &peer.Peer{Addr: bufconnAddr{}}, md: gatewayHeader, principal: &auth.Principal{Name: "mobile-app", Kind: auth.KindClientCert}},
+		{name: "gateway without certificate", peer: &peer.Peer{Addr: bufconnAddr{}}},
+		//Only the gateway may name the certificate in a header
+		{name: "header over the network", peer: &peer.Peer{Addr: tcp}, md: gatewayHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.peer != nil {
+				ctx = peer.NewContext(ctx, tt.peer)
+			}
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+			assert.Equal(t, tt.principal, certPrincipal(ctx))
+		})
+	}
+}
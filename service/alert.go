@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/alert"
+)
+
+// checkAlerts fires the alerts for the thresholds the spending of every budget window has crossed.
+// Every alert fires once per window period, failures are only logged so they never fail the request
+func (s *Service) checkAlerts(ctx context.Context) {
+	if s.notifier == nil {
+		return
+	}
+	now := time.Now()
+	for _, w := range s.config.Budgets {
+		key := w.Key(now)
+		sp, err := s.store.GetSpending(ctx, key)
+		if err != nil {
+			s.log(ctx).Errorw("failed to get spending for alerts", "key", key, "error", err)
+			continue
+		}
+		for _, threshold := range s.notifier.Crossed(key, sp.Amount, w.Limit) {
+			first, err := s.store.MarkAlert(ctx, key, threshold)
+			if err != nil {
+				//The threshold isn't marked fired, so the next request retries it
+				s.log(ctx).Errorw("failed to mark budget alert", "key", key, "threshold", threshold, "error", err)
+				continue
+			}
+			s.notifier.MarkFired(key, threshold)
+			if !first {
+				continue
+			}
+			s.notifier.Send(alert.Event{
+				Period:    string(w.Period),
+				TimeZone:  w.Location.String(),
+				Key:       key,
+				Threshold: threshold,
+				Limit:     w.Limit,
+				Spent:     sp.Amount,
+				Time:      now,
+			})
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/alert"
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestService_checkAlerts(t *testing.T) {
+	ctx := context.Background()
+	var deliveries atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deliveries.Add(1)
+	}))
+	defer srv.Close()
+
+	store := newFakeStore()
+	s := newTestService(store, 1000)
+	s.notifier = alert.New(alert.Config{Thresholds: []int{50}, Webhooks: []alert.Webhook{{URL: srv.URL}}}, zap.NewNop().Sugar())
+	day := db.DayKey(time.Now())
+	store.add(day, &db.Spending{Amount: 600}, 0)
+
+	//An alert that fails to be recorded isn't lost, the next check fires it
+	store.failMarks = 1
+	s.checkAlerts(ctx)
+	s.notifier.Close()
+	assert.Zero(t, deliveries.Load())
+	assert.Empty(t, store.alerts)
+
+	s.checkAlerts(ctx)
+	s.notifier.Close()
+	assert.Equal(t, int32(1), deliveries.Load())
+	assert.True(t, store.alerts[day+"_50"])
+
+	//Once recorded it fires once per period
+	s.checkAlerts(ctx)
+	s.notifier.Close()
+	assert.Equal(t, int32(1), deliveries.Load())
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// resultCache keeps the most recently generated results, so they can still be served once the budget is exhausted.
+// A nil cache caches nothing
+type resultCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type cacheEntry struct {
+	key   string
+	value any
+}
+
+// newResultCache creates new cache of the given number of results, or nil if size is zero
+func newResultCache(size int) *resultCache {
+	if size <= 0 {
+		return nil
+	}
+	return &resultCache{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (c *resultCache) get(key string) (any, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).value, true
+}
+
+func (c *resultCache) add(key string, value any) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// resultKey returns the cache key of the request of the operation with the given fields.
+// voice is the tier the audio is generated with, empty if the request has no audio
+func resultKey(operation, voice string, gender Gender, fields ...string) string {
+	return strings.Join(append([]string{operation, voice, strconv.Itoa(int(gender))}, fields...), "\x00")
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/budget"
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/degrade"
+)
+
+// degradation decides how to degrade the request by how full the fullest budget window is, counting reservations.
+// It also returns the fullest window to report once the budget is exhausted
+func (s *Service) degradation(ctx context.Context) (degrade.Decision, budget.Window, error) {
+	if len(s.config.Degradation) == 0 {
+		return degrade.Decision{}, budget.Window{}, nil
+	}
+	now := time.Now()
+	percent, fullest := 0, budget.Window{}
+	for _, w := range s.config.Budgets {
+		key := w.Key(now)
+		sp, err := s.store.GetSpending(ctx, key)
+		if err != nil {
+			s.log(ctx).Errorw("failed to get spending for degradation", "key", key, "error", err)
+			return degrade.Decision{}, budget.Window{}, err
+		}
+		if p := fillPercent(sp.Amount+sp.Reserved, w.Limit); p >= percent {
+			percent, fullest = p, w
+		}
+	}
+	decision := degrade.Decide(s.config.Degradation, percent)
+	if decision.Degraded() {
+		s.log(ctx).Infow("degrading request", "budget_percent", percent, "period", fullest.Period, "tts_voice", decision.TTSVoice, "drop_audio", decision.DropAudio, "gemini_model", decision.GeminiModel, "cache_only", decision.CacheOnly)
+	}
+	return decision, fullest, nil
+}
+
+// fromCache serves the result of the request from the cache once the budget is exhausted.
+// The request is recorded as a cache hit at no cost. It fails with a QuotaExceededError for the window if the result isn't cached
+func (s *Service) fromCache(ctx context.Context, key string, params *AddDailySpendingParams, window budget.Window) (any, *Usage, error) {
+	value, ok := s.cache.get(key)
+	s.metrics.ObserveCache(ok)
+	if !ok {
+		s.log(ctx).Infow("budget exhausted and result not cached", "operation", params.Operation, "period", window.Period)
+		return nil, nil, &QuotaExceededError{Period: window.Period, ResetsAt: window.End(time.Now())}
+	}
+	params.CacheHit = true
+	s.settleSpending(ctx, params, nil)
+	s.log(ctx).Infow("result served from cache", "operation", params.Operation)
+	return value, s.usage(ctx, params), nil
+}
+
+// degradationOf returns what the decision degraded in a request that did or didn't ask for audio, or nil if nothing was degraded
+func degradationOf(decision degrade.Decision, includeAudio bool) *Degradation {
+	d := &Degradation{BudgetPercent: decision.Percent, GeminiModel: decision.GeminiModel}
+	if includeAudio {
+		d.AudioDropped = decision.DropAudio
+		if !decision.DropAudio {
+			d.TTSVoice = decision.TTSVoice
+		}
+	}
+	if d.GeminiModel == "" && !d.AudioDropped && d.TTSVoice == "" {
+		return nil
+	}
+	return d
+}
+
+// cachedDegradation returns the degradation of a result served from the cache, including what was degraded when it was generated
+func cachedDegradation(generated *Degradation, decision degrade.Decision) *Degradation {
+	d := &Degradation{}
+	if generated != nil {
+		*d = *generated
+	}
+	d.BudgetPercent = decision.Percent
+	d.Cached = true
+	return d
+}
+
+// fillPercent returns how many percent of the limit are spent
+func fillPercent(spent, limit currency.MicroUSD) int {
+	if limit <= 0 {
+		return 0
+	}
+	return int(int64(spent) * 100 / int64(limit))
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+)
+
+var (
+	ErrNotReady = errors.New("not ready")
+)
+
+// Ready checks that the upstream clients are initialized and the spending store is reachable
+func (s *Service) Ready(ctx context.Context) error {
+	if s.geminiClient == nil || s.ttsClient == nil {
+		return fmt.Errorf("%w: upstream clients are not initialized", ErrNotReady)
+	}
+	if _, err := s.store.GetSpending(ctx, db.DayKey(time.Now())); err != nil {
+		s.log(ctx).Errorw("spending store health check failed", "error", err)
+		return fmt.Errorf("%w: spending store is unreachable: %w", ErrNotReady, err)
+	}
+	return nil
+}
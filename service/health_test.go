@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dafraer/sentence-gen-grpc-server/gemini"
+	"github.com/dafraer/sentence-gen-grpc-server/tts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_Ready(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	s := newTestService(store, 1000)
+
+	//Not ready until both upstream clients are set up
+	assert.ErrorIs(t, s.Ready(ctx), ErrNotReady)
+	s.geminiClient = &gemini.Client{}
+	assert.ErrorIs(t, s.Ready(ctx), ErrNotReady)
+	s.ttsClient = &tts.Client{}
+	assert.NoError(t, s.Ready(ctx))
+
+	//Not ready while the spending store is unreachable
+	store.failGets = true
+	err := s.Ready(ctx)
+	assert.ErrorIs(t, err, ErrNotReady)
+	assert.ErrorIs(t, err, errStore)
+	store.failGets = false
+	assert.NoError(t, s.Ready(ctx))
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+)
+
+// Request outcomes recorded in the ledger
+const (
+	OutcomeOK              = "ok"
+	OutcomeInvalidResponse = "invalid_response"
+	OutcomeWordNotFound    = "word_not_found"
+	OutcomeCanceled        = "canceled"
+	OutcomeError           = "error"
+)
+
+// recordLedger records the request in the ledger if the ledger is enabled.
+// The word is redacted or hashed like in the logs
+func (s *Service) recordLedger(ctx context.Context, params *AddDailySpendingParams, sp *db.Spending) error {
+	if s.config.LedgerRetention <= 0 || params.Operation == "" {
+		return nil
+	}
+
+	now := time.Now()
+	entry := &db.LedgerEntry{
+		Time:           now,
+		Operation:      params.Operation,
+		Principal:      params.Principal,
+		Word:           s.config.Logging.Redact(params.Word),
+		FromLanguage:   params.FromLanguage,
+		ToLanguage:     params.ToLanguage,
+		Model:          params.GeminiModel,
+		Voice:          params.TTSModel,
+		InputTokens:    sp.GeminiInputTokens,
+		OutputTokens:   sp.GeminiOutputTokens,
+		CachedTokens:   sp.GeminiCachedTokens,
+		ToolUseTokens:  sp.GeminiToolUseTokens,
+		ThinkingTokens: sp.GeminiThinkingTokens,
+		Characters:     params.Characters,
+		Amount:         sp.Amount,
+		CacheHit:       params.CacheHit,
+		Outcome:        params.Outcome,
+		ExpireAt:       now.Add(s.config.LedgerRetention),
+	}
+	if entry.Principal == "" {
+		entry.Principal = anonymousPrincipal
+	}
+	if err := s.store.AddLedgerEntry(ctx, entry); err != nil {
+		s.log(ctx).Errorw("failed to record ledger entry", "error", err)
+		return err
+	}
+	return nil
+}
+
+// outcome classifies the error a request finished with
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case errors.Is(err, ErrInvalidResponse):
+		return OutcomeInvalidResponse
+	case errors.Is(err, ErrWordNotFound):
+		return OutcomeWordNotFound
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return OutcomeCanceled
+	default:
+		return OutcomeError
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_recordLedger(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	s := newTestService(store, 10000)
+	params := func() *AddDailySpendingParams {
+		return &AddDailySpendingParams{Operation: OperationTranslate, Word: "hund", FromLanguage: "de", ToLanguage: "en", GeminiModel: testModel, GeminiInputTokens: 10}
+	}
+
+	//No entries are recorded while the ledger is disabled
+	s.settleSpending(ctx, params(), nil)
+	assert.Empty(t, store.ledger)
+
+	//Entries expire the retention period after the request
+	s.config.LedgerRetention = 30 * 24 * time.Hour
+	before := time.Now()
+	s.settleSpending(ctx, params(), ErrWordNotFound)
+	after := time.Now()
+	require.Len(t, store.ledger, 1)
+	entry := store.ledger[0]
+	assert.False(t, entry.Time.Before(before) || entry.Time.After(after))
+	assert.Equal(t, entry.Time.Add(s.config.LedgerRetention), entry.ExpireAt)
+	assert.Equal(t, OperationTranslate, entry.Operation)
+	assert.Equal(t, anonymousPrincipal, entry.Principal)
+	assert.Equal(t, OutcomeWordNotFound, entry.Outcome)
+	assert.Equal(t, currency.MicroUSD(20), entry.Amount)
+
+	//The word is redacted like in the logs
+	assert.Equal(t, "hund", entry.Word)
+	s.config.Logging = logging.Config{Redaction: logging.RedactHash, HashKey: "key"}
+	s.settleSpending(ctx, params(), nil)
+	require.Len(t, store.ledger, 2)
+	assert.Equal(t, s.config.Logging.Redact("hund"), store.ledger[1].Word)
+	assert.NotContains(t, store.ledger[1].Word, "hund")
+	s.config.Logging = logging.Config{Redaction: logging.RedactRemove}
+	s.settleSpending(ctx, params(), nil)
+	require.Len(t, store.ledger, 3)
+	assert.NotContains(t, store.ledger[2].Word, "hund")
+
+	//Spending without an operation isn't a request and has no entry
+	s.settleSpending(ctx, &AddDailySpendingParams{GeminiModel: testModel, GeminiInputTokens: 10}, nil)
+	assert.Len(t, store.ledger, 3)
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/dafraer/sentence-gen-grpc-server/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	upstreamGemini = "gemini"
+	upstreamTTS    = "tts"
+)
+
+// instrumentedStore records the latency and the errors of the spending store operations
+type instrumentedStore struct {
+	store   SpendingStore
+	metrics *metrics.Metrics
+}
+
+func (s *instrumentedStore) AddLedgerEntry(ctx context.Context, entry *db.LedgerEntry) error {
+	start := time.Now()
+	err := s.store.AddLedgerEntry(ctx, entry)
+	s.metrics.ObserveStore("add_ledger_entry", time.Since(start), err)
+	return err
+}
+
+func (s *instrumentedStore) MarkAlert(ctx context.Context, key string, threshold int) (bool, error) {
+	start := time.Now()
+	first, err := s.store.MarkAlert(ctx, key, threshold)
+	s.metrics.ObserveStore("mark_alert", time.Since(start), err)
+	return first, err
+}
+
+func (s *instrumentedStore) GetSpending(ctx context.Context, key string) (*db.Spending, error) {
+	start := time.Now()
+	sp, err := s.store.GetSpending(ctx, key)
+	s.metrics.ObserveStore("get_spending", time.Since(start), err)
+	return sp, err
+}
+
+func (s *instrumentedStore) GetPrincipalSpending(ctx context.Context, key string) (map[string]db.Usage, error) {
+	start := time.Now()
+	usages, err := s.store.GetPrincipalSpending(ctx, key)
+	s.metrics.ObserveStore("get_principal_spending", time.Since(start), err)
+	return usages, err
+}
+
+func (s *instrumentedStore) AddSpending(ctx context.Context, keys []string, params *db.Spending) error {
+	start := time.Now()
+	err := s.store.AddSpending(ctx, keys, params)
+	s.metrics.ObserveStore("add_spending", time.Since(start), err)
+	return err
+}
+
+func (s *instrumentedStore) ReserveSpending(ctx context.Context, amount currency.MicroUSD, limits []db.Limit) (*db.Reservation, error) {
+	start := time.Now()
+	reservation, err := s.store.ReserveSpending(ctx, amount, limits)
+	s.metrics.ObserveStore("reserve_spending", time.Since(start), err)
+	return reservation, err
+}
+
+func (s *instrumentedStore) SettleSpending(ctx context.Context, reservation *db.Reservation, params *db.Spending) error {
+	start := time.Now()
+	err := s.store.SettleSpending(ctx, reservation, params)
+	s.metrics.ObserveStore("settle_spending", time.Since(start), err)
+	return err
+}
+
+// recordUsage counts the billed tokens, characters and cost of a request and adds them to the request span
+func (s *Service) recordUsage(ctx context.Context, params *AddDailySpendingParams, sp *db.Spending) {
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("sengen.operation", params.Operation),
+		attribute.String("gemini.model", params.GeminiModel),
+		attribute.Int64("gemini.input_tokens", sp.GeminiInputTokens),
+		attribute.Int64("gemini.cached_tokens", sp.GeminiCachedTokens),
+		attribute.Int64("gemini.tool_use_tokens", sp.GeminiToolUseTokens),
+		attribute.Int64("gemini.output_tokens", sp.GeminiOutputTokens),
+		attribute.Int64("gemini.thinking_tokens", sp.GeminiThinkingTokens),
+		attribute.Int64("tts.characters", params.Characters),
+		attribute.Int64("sengen.cost_micro_usd", int64(sp.Amount)),
+		attribute.Bool("sengen.cache_hit", params.CacheHit),
+	)
+	s.metrics.AddTokens(params.GeminiModel, "input", sp.GeminiInputTokens)
+	s.metrics.AddTokens(params.GeminiModel, "cached", sp.GeminiCachedTokens)
+	s.metrics.AddTokens(params.GeminiModel, "tool_use", sp.GeminiToolUseTokens)
+	s.metrics.AddTokens(params.GeminiModel, "output", sp.GeminiOutputTokens)
+	s.metrics.AddTokens(params.GeminiModel, "thinking", sp.GeminiThinkingTokens)
+	s.metrics.AddCharacters(params.TTSModel, params.Characters)
+	s.metrics.AddCost(params.Operation, int64(sp.Amount))
+}
@@ -1,10 +1,26 @@
 package service
 
+import (
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/budget"
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/dafraer/sentence-gen-grpc-server/gemini"
+)
+
 const (
 	Female = iota
 	Male
 )
 
+// Operations the spending is attributed to
+const (
+	OperationSentence   = "sentence"
+	OperationTranslate  = "translate"
+	OperationDefinition = "definition"
+)
+
 type Gender int
 
 type GenerateSentenceRequest struct {
@@ -20,6 +36,8 @@ type GenerateSentenceResponse struct {
 	OriginalSentence   string
 	TranslatedSentence string
 	Audio              []byte
+	Usage              *Usage
+	Degradation        *Degradation
 }
 
 type GenerateDefinitionRequest struct {
@@ -31,8 +49,10 @@ type GenerateDefinitionRequest struct {
 }
 
 type GenerateDefinitionResponse struct {
-	Definition string
-	Audio      []byte
+	Definition  string
+	Audio       []byte
+	Usage       *Usage
+	Degradation *Degradation
 }
 
 type TranslateRequest struct {
@@ -47,11 +67,74 @@ type TranslateRequest struct {
 type TranslateResponse struct {
 	Translation string
 	Audio       []byte
+	Usage       *Usage
+	Degradation *Degradation
+}
+
+// Usage is the usage and cost of a single call and the budget left after it
+type Usage struct {
+	Cost                 currency.MicroUSD
+	GeminiModel          string
+	GeminiInputTokens    int64
+	GeminiCachedTokens   int64
+	GeminiToolUseTokens  int64
+	GeminiOutputTokens   int64
+	GeminiThinkingTokens int64
+	TTSModel             string
+	Characters           int64
+	Budgets              []RemainingBudget
+}
+
+// Degradation is what was degraded in a call because the budget is filling up
+type Degradation struct {
+	BudgetPercent int
+	//TTSVoice is the voice tier the audio was switched to
+	TTSVoice     string
+	AudioDropped bool
+	//GeminiModel is the model the call was switched to
+	GeminiModel string
+	//Cached is set if the result was served from the cache
+	Cached bool
+}
+
+// RemainingBudget is the budget left in the current period of a budget window. Plan is set for the windows of the caller's plan
+type RemainingBudget struct {
+	Window    budget.Window
+	Plan      string
+	Remaining currency.MicroUSD
+	ResetsAt  time.Time
 }
 
 type AddDailySpendingParams struct {
-	GeminiInputTokens  int64
-	GeminiOutputTokens int64
-	Characters         int64
-	TTSModel           string
+	//Operation and Principal attribute the spending, they may be empty
+	Operation            string
+	Principal            string
+	Word                 string
+	FromLanguage         string
+	ToLanguage           string
+	CacheHit             bool
+	Outcome              string
+	GeminiModel          string
+	GeminiInputTokens    int64
+	GeminiCachedTokens   int64
+	GeminiToolUseTokens  int64
+	GeminiOutputTokens   int64
+	GeminiThinkingTokens int64
+	Characters           int64
+	TTSModel             string
+	//Reservation is released when the spending is added, may be nil
+	Reservation *db.Reservation
+}
+
+// addTokens adds the gemini tokens to the spending. tokens may be nil if the call failed before being billed
+func (p *AddDailySpendingParams) addTokens(tokens *gemini.Tokens) {
+	if tokens == nil {
+		return
+	}
+	p.GeminiModel = tokens.Model
+	p.GeminiInputTokens += tokens.InputTokens
+	p.GeminiCachedTokens += tokens.CachedTokens
+	p.GeminiToolUseTokens += tokens.ToolUseTokens
+	p.GeminiOutputTokens += tokens.OutputTokens
+	p.GeminiThinkingTokens += tokens.ThinkingTokens
 }
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dafraer/sentence-gen-grpc-server/plan"
+	"github.com/dafraer/sentence-gen-grpc-server/tts"
+)
+
+var (
+	ErrNotInPlan = errors.New("not included in plan")
+)
+
+// planVoice returns the voice tier to generate the audio with: the degraded tier if not empty, otherwise Chirp3-HD,
+// switched to a tier of the caller's plan if the plan doesn't include it. It fails with ErrNotInPlan if audio is requested
+// and the plan includes none
+func (s *Service) planVoice(ctx context.Context, includeAudio bool, degraded string) (string, error) {
+	voice := tts.Chirp3HD
+	if degraded != "" {
+		voice = degraded
+	}
+	sub, ok := plan.FromContext(ctx)
+	if !includeAudio || !ok {
+		return voice, nil
+	}
+	planVoice, ok := sub.Plan.Voice(voice)
+	if !ok {
+		s.log(ctx).Infow("audio not included in plan", "plan", sub.Name, "principal", principalName(ctx))
+		return "", fmt.Errorf("audio is %w %s", ErrNotInPlan, sub.Name)
+	}
+	if planVoice != voice {
+		s.log(ctx).Debugw("voice tier switched to plan tier", "plan", sub.Name, "requested", voice, "voice", planVoice)
+	}
+	return planVoice, nil
+}
@@ -3,60 +3,323 @@ package service
 import (
 	"context"
 	"errors"
+	"math"
+	"strings"
+	"time"
 
+	"github.com/dafraer/sentence-gen-grpc-server/budget"
 	"github.com/dafraer/sentence-gen-grpc-server/currency"
 	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/dafraer/sentence-gen-grpc-server/degrade"
+	"github.com/dafraer/sentence-gen-grpc-server/plan"
 	"github.com/dafraer/sentence-gen-grpc-server/tts"
 )
 
 const (
-	chirp3HDVoicePerCharacterPrice = currency.MicroUSD(30)
-	standardVoicePerCharacterPrice = currency.MicroUSD(4)
+	anonymousPrincipal = "anonymous"
+	//settleAttempts and settleBackoff bound the retries of a failed settlement. The backoff doubles on every retry
+	settleAttempts = 3
+	settleBackoff  = 100 * time.Millisecond
 )
 
-func (s *Service) DailyQuotaExceeded(ctx context.Context) (bool, error) {
-	s.logger.Debugw("checking daily quota")
-	spending, err := s.store.GetDailySpending(ctx)
-	if err != nil {
-		s.logger.Errorw("failed to get daily spending", "error", err)
-		return false, err
+var (
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// QuotaExceededError reports the budget window that has no room left and when its period ends. It matches ErrQuotaExceeded.
+// Plan is set if the window is a budget of the caller's plan
+type QuotaExceededError struct {
+	Period   budget.Period
+	Plan     string
+	ResetsAt time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.Plan != "" {
+		return string(e.Period) + " quota limit of the " + e.Plan + " plan exceeded"
 	}
-	if spending.Amount >= s.config.DailyQuota {
-		s.logger.Infow("daily quota exceeded", "amount", spending.Amount, "quota", s.config.DailyQuota)
-		return true, nil
+	return string(e.Period) + " quota limit exceeded"
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// CheckQuota checks the spending of every budget window, including those of the caller's plan, against its limit.
+// It fails with a QuotaExceededError naming the first window that is used up, unless cached results are served in that case
+func (s *Service) CheckQuota(ctx context.Context) error {
+	s.log(ctx).Debugw("checking quota")
+	now := time.Now()
+	for _, w := range s.windows(ctx) {
+		key := w.key(now)
+		spending, err := s.store.GetSpending(ctx, key)
+		if err != nil {
+			s.log(ctx).Errorw("failed to get spending", "key", key, "error", err)
+			return err
+		}
+		if w.plan == "" {
+			s.metrics.SetBudget(string(w.Period), w.Location.String(), int64(spending.Amount), int64(max(w.Limit-spending.Amount, 0)))
+		}
+		//Exhausted global budgets still serve cached results if a degradation policy says so
+		if spending.Amount >= w.Limit && w.plan == "" && degrade.CacheOnlyAt(s.config.Degradation, fillPercent(spending.Amount, w.Limit)) {
+			s.log(ctx).Infow("quota exceeded, serving cached results only", "period", w.Period, "key", key, "amount", spending.Amount, "quota", w.Limit)
+			continue
+		}
+		if spending.Amount >= w.Limit {
+			s.log(ctx).Infow("quota exceeded", "period", w.Period, "plan", w.plan, "key", key, "amount", spending.Amount, "quota", w.Limit)
+			return &QuotaExceededError{Period: w.Period, Plan: w.plan, ResetsAt: w.End(now)}
+		}
+		s.log(ctx).Debugw("quota check passed", "period", w.Period, "plan", w.plan, "key", key, "amount", spending.Amount, "quota", w.Limit)
+	}
+	return nil
+}
+
+// ReserveSpending holds the cost of the estimated usage against every budget window until the request is settled with AddSpending.
+// It fails with a QuotaExceededError if a window has no room for the estimate
+func (s *Service) ReserveSpending(ctx context.Context, estimate *AddDailySpendingParams) (*db.Reservation, error) {
+	if estimate == nil {
+		s.log(ctx).Errorw("reserve spending failed: nil estimate", "error", errors.New("estimate cannot be nil"))
+		return nil, errors.New("estimate cannot be nil")
+	}
+
+	sp := s.spending(estimate)
+	now := time.Now()
+	reservation, err := s.store.ReserveSpending(ctx, sp.Amount, s.limits(ctx, now))
+	if dbErr := (*db.QuotaExceededError)(nil); errors.As(err, &dbErr) {
+		s.log(ctx).Infow("spending reservation rejected", "amount", sp.Amount, "key", dbErr.Key)
+		return nil, s.quotaExceeded(ctx, dbErr.Key, now)
+	}
+	if err != nil {
+		s.log(ctx).Errorw("failed to reserve spending", "error", err)
+		return nil, err
 	}
-	s.logger.Debugw("daily quota check passed", "amount", spending.Amount, "quota", s.config.DailyQuota)
-	return false, nil
+	s.log(ctx).Debugw("spending reserved", "amount", sp.Amount, "keys", reservation.Keys)
+	return reservation, nil
 }
 
+// AddSpending persists the spending. If params hold a reservation it is released in the same write
 func (s *Service) AddSpending(ctx context.Context, params *AddDailySpendingParams) error {
 	if params == nil {
-		s.logger.Errorw("add spending failed: nil params", "error", errors.New("params cannot be nil"))
+		s.log(ctx).Errorw("add spending failed: nil params", "error", errors.New("params cannot be nil"))
 		return errors.New("params cannot be nil")
 	}
 
-	sp := db.Spending{}
-	if params.TTSModel == tts.Chirp3HD {
-		sp.Amount += currency.MicroUSD(params.Characters) * chirp3HDVoicePerCharacterPrice
-		sp.Chirp3HDCharacters += params.Characters
+	sp := s.spending(params)
+
+	var err error
+	if params.Reservation != nil {
+		err = s.settle(ctx, params.Reservation, &sp)
+	} else {
+		err = s.store.AddSpending(ctx, s.keys(ctx, time.Now()), &sp)
+	}
+	if err != nil {
+		s.log(ctx).Errorw("failed to persist spending", "error", err)
+		return errors.Join(err, s.recordLedger(ctx, params, &sp))
+	}
+	s.recordUsage(ctx, params, &sp)
+	if err := s.recordLedger(ctx, params, &sp); err != nil {
+		return err
+	}
+	s.checkAlerts(ctx)
+	s.log(ctx).Debugw("spending persisted", "amount", sp.Amount, "chirp3hd_characters", sp.Chirp3HDCharacters, "standard_characters", sp.StandardVoiceCharacters, "gemini_input_tokens", sp.GeminiInputTokens, "gemini_cached_tokens", sp.GeminiCachedTokens, "gemini_tool_use_tokens", sp.GeminiToolUseTokens, "gemini_output_tokens", sp.GeminiOutputTokens, "gemini_thinking_tokens", sp.GeminiThinkingTokens)
+
+	return nil
+}
+
+// settle releases the reservation and adds the spending, retrying failed writes.
+// A reservation that is never released holds its amount against the budget until the window resets
+func (s *Service) settle(ctx context.Context, reservation *db.Reservation, sp *db.Spending) error {
+	wait := settleBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.store.SettleSpending(ctx, reservation, sp)
+		if err == nil || attempt >= settleAttempts {
+			return err
+		}
+		s.log(ctx).Warnw("retrying spending settlement", "attempt", attempt, "wait", wait, "error", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		wait *= 2
 	}
+}
 
-	if params.TTSModel == tts.Standard {
-		sp.Amount += currency.MicroUSD(params.Characters) * standardVoicePerCharacterPrice
-		sp.StandardVoiceCharacters += params.Characters
+// settleSpending adds the actual spending of a request with the outcome of the request and releases its reservation.
+// It runs deferred after the upstream calls, so it ignores cancellation of the request and only logs failures
+func (s *Service) settleSpending(ctx context.Context, params *AddDailySpendingParams, reqErr error) {
+	params.Outcome = outcome(reqErr)
+	if err := s.AddSpending(context.WithoutCancel(ctx), params); err != nil {
+		s.log(ctx).Errorw("failed to settle spending", "error", err)
 	}
+}
 
-	sp.Amount += s.config.GeminiInputPrice * currency.MicroUSD(params.GeminiInputTokens)
-	sp.GeminiInputTokens = params.GeminiInputTokens
+// spending calculates the cost of the usage with the prices of the model and voice valid now and attributes it to the operation,
+// model, voice tier and principal. Usage without a price is recorded at no cost, the configured model and voices are checked to have prices on startup
+func (s *Service) spending(params *AddDailySpendingParams) db.Spending {
+	now := time.Now()
+	sp := db.Spending{Requests: 1}
+
+	var voice db.Usage
+	if params.Characters > 0 {
+		price, err := s.config.Pricing.Voice(params.TTSModel, now)
+		if err != nil {
+			s.logger.Errorw("failed to price tts characters", "error", err)
+		}
+		voice = db.Usage{Amount: s.cost([]currency.MicroUSD{price.Character}, []int64{params.Characters}), Requests: 1, Characters: params.Characters}
+		switch params.TTSModel {
+		case tts.Chirp3HD:
+			sp.Chirp3HDCharacters += params.Characters
+		case tts.Standard:
+			sp.StandardVoiceCharacters += params.Characters
+		}
+	}
 
-	sp.Amount += s.config.GeminiOutputPrice * currency.MicroUSD(params.GeminiOutputTokens)
+	var model db.Usage
+	if params.GeminiInputTokens > 0 || params.GeminiCachedTokens > 0 || params.GeminiToolUseTokens > 0 || params.GeminiOutputTokens > 0 || params.GeminiThinkingTokens > 0 {
+		price, err := s.config.Pricing.Model(params.GeminiModel, now)
+		if err != nil {
+			s.logger.Errorw("failed to price gemini tokens", "error", err)
+		}
+		model = db.Usage{
+			//Tool use prompts are billed as input
+			Amount: s.cost(
+				[]currency.MicroUSD{price.Input, price.Input, price.Cached, price.Output, price.Thinking},
+				[]int64{params.GeminiInputTokens, params.GeminiToolUseTokens, params.GeminiCachedTokens, params.GeminiOutputTokens, params.GeminiThinkingTokens},
+			),
+			Requests:       1,
+			InputTokens:    params.GeminiInputTokens,
+			CachedTokens:   params.GeminiCachedTokens,
+			ToolUseTokens:  params.GeminiToolUseTokens,
+			OutputTokens:   params.GeminiOutputTokens,
+			ThinkingTokens: params.GeminiThinkingTokens,
+		}
+	}
+	sp.Amount = s.cost([]currency.MicroUSD{model.Amount, voice.Amount}, []int64{1, 1})
+	sp.GeminiInputTokens = params.GeminiInputTokens
+	sp.GeminiCachedTokens = params.GeminiCachedTokens
+	sp.GeminiToolUseTokens = params.GeminiToolUseTokens
 	sp.GeminiOutputTokens = params.GeminiOutputTokens
+	sp.GeminiThinkingTokens = params.GeminiThinkingTokens
 
-	if err := s.store.AddDailySpending(ctx, &sp); err != nil {
-		s.logger.Errorw("failed to persist spending", "error", err)
-		return err
+	//The operation and principal carry the whole usage, the model and voice their part of it
+	total := model
+	total.Characters = voice.Characters
+	total.Amount = sp.Amount
+	total.Requests = 1
+	if params.Operation != "" {
+		sp.Operations = map[string]db.Usage{params.Operation: total}
+	}
+	principal := params.Principal
+	if principal == "" {
+		principal = anonymousPrincipal
+	}
+	sp.Principals = map[string]db.Usage{principal: total}
+	if model.Requests > 0 && params.GeminiModel != "" {
+		sp.Models = map[string]db.Usage{params.GeminiModel: model}
+	}
+	if voice.Requests > 0 && params.TTSModel != "" {
+		sp.Voices = map[string]db.Usage{params.TTSModel: voice}
 	}
-	s.logger.Debugw("spending persisted", "amount", sp.Amount, "chirp3hd_characters", sp.Chirp3HDCharacters, "standard_characters", sp.StandardVoiceCharacters, "gemini_input_tokens", sp.GeminiInputTokens, "gemini_output_tokens", sp.GeminiOutputTokens)
 
-	return nil
+	return sp
+}
+
+// budgetWindow is a budget window with the prefix of the keys its spending is stored under.
+// The windows of a plan count the spending of each principal on it separately
+type budgetWindow struct {
+	budget.Window
+	plan   string
+	prefix string
+}
+
+func (w *budgetWindow) key(now time.Time) string {
+	return w.prefix + w.Window.Key(now)
+}
+
+// windows returns the global budget windows and the windows of the caller's plan
+func (s *Service) windows(ctx context.Context) []budgetWindow {
+	windows := make([]budgetWindow, 0, len(s.config.Budgets))
+	for _, w := range s.config.Budgets {
+		windows = append(windows, budgetWindow{Window: w})
+	}
+	sub, ok := plan.FromContext(ctx)
+	if !ok {
+		return windows
+	}
+	principal := principalName(ctx)
+	if principal == "" {
+		principal = anonymousPrincipal
+	}
+	//Doc ids can't contain slashes
+	prefix := "principal_" + strings.ReplaceAll(principal, "/", "_") + "_"
+	for _, w := range sub.Plan.Budgets {
+		windows = append(windows, budgetWindow{Window: w, plan: sub.Name, prefix: prefix})
+	}
+	return windows
+}
+
+// cost returns the sum of the prices times the quantities.
+// A cost that overflows is logged and capped at the largest amount, so it can never slip under a quota
+func (s *Service) cost(prices []currency.MicroUSD, quantities []int64) currency.MicroUSD {
+	var total currency.MicroUSD
+	for i, price := range prices {
+		c, err := currency.Mul(price, quantities[i])
+		if err == nil {
+			total, err = currency.Add(total, c)
+		}
+		if err != nil {
+			s.logger.Errorw("cost overflows", "price", price, "quantity", quantities[i], "error", err)
+			return math.MaxInt64
+		}
+	}
+	return total
+}
+
+// limits returns the spending limits of the budget windows at the given time.
+// The daily UTC spending is always recorded for the reports, without a limit if there is no daily UTC window
+func (s *Service) limits(ctx context.Context, now time.Time) []db.Limit {
+	windows := s.windows(ctx)
+	limits := make([]db.Limit, 0, len(windows)+1)
+	day := db.DayKey(now)
+	reported := false
+	for _, w := range windows {
+		key := w.key(now)
+		reported = reported || key == day
+		limits = append(limits, db.Limit{Key: key, Quota: w.Limit})
+	}
+	if !reported {
+		limits = append(limits, db.Limit{Key: day})
+	}
+	return limits
+}
+
+// keys returns the spending keys of the budget windows at the given time, including the daily UTC key
+func (s *Service) keys(ctx context.Context, now time.Time) []string {
+	limits := s.limits(ctx, now)
+	keys := make([]string, len(limits))
+	for i, l := range limits {
+		keys[i] = l.Key
+	}
+	return keys
+}
+
+// quotaExceeded returns the error about the budget window whose spending is stored under the key
+func (s *Service) quotaExceeded(ctx context.Context, key string, now time.Time) error {
+	for _, w := range s.windows(ctx) {
+		if w.key(now) == key {
+			return &QuotaExceededError{Period: w.Period, Plan: w.plan, ResetsAt: w.End(now)}
+		}
+	}
+	return ErrQuotaExceeded
+}
+
+// audioCharacters returns the number of characters to reserve for the audio
+func audioCharacters(includeAudio bool, characters int) int64 {
+	if !includeAudio {
+		return 0
+	}
+	return int64(characters)
 }
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/budget"
+	"github.com/dafraer/sentence-gen-grpc-server/config"
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/dafraer/sentence-gen-grpc-server/pricing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const testModel = "gemini-test"
+
+var errStore = errors.New("store unavailable")
+
+// fakeStore keeps the spending in memory like db.Store keeps it in firestore
+type fakeStore struct {
+	mu         sync.Mutex
+	spending   map[string]*db.Spending
+	principals map[string]map[string]db.Usage
+	ledger     []*db.LedgerEntry
+	alerts     map[string]bool
+	//failSettles and failMarks make the next settlements and alert marks fail with errStore, failGets every read of the spending
+	failSettles int
+	failMarks   int
+	failGets    bool
+	settles     int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{spending: make(map[string]*db.Spending), principals: make(map[string]map[string]db.Usage), alerts: make(map[string]bool)}
+}
+
+func (f *fakeStore) AddLedgerEntry(_ context.Context, entry *db.LedgerEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ledger = append(f.ledger, entry)
+	return nil
+}
+
+func (f *fakeStore) MarkAlert(_ context.Context, key string, threshold int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failMarks > 0 {
+		f.failMarks--
+		return false, errStore
+	}
+	id := fmt.Sprintf("%s_%d", key, threshold)
+	if f.alerts[id] {
+		return false, nil
+	}
+	f.alerts[id] = true
+	return true, nil
+}
+
+func (f *fakeStore) GetSpending(_ context.Context, key string) (*db.Spending, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failGets {
+		return nil, errStore
+	}
+	return f.get(key), nil
+}
+
+func (f *fakeStore) GetPrincipalSpending(_ context.Context, key string) (map[string]db.Usage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	principals := make(map[string]db.Usage, len(f.principals[key]))
+	for name, u := range f.principals[key] {
+		principals[name] = u
+	}
+	return principals, nil
+}
+
+func (f *fakeStore) AddSpending(_ context.Context, keys []string, params *db.Spending) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		f.add(key, params, 0)
+	}
+	return nil
+}
+
+func (f *fakeStore) ReserveSpending(_ context.Context, amount currency.MicroUSD, limits []db.Limit) (*db.Reservation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, len(limits))
+	for i, l := range limits {
+		sp := f.get(l.Key)
+		if l.Quota > 0 && sp.Amount+sp.Reserved+amount > l.Quota {
+			return nil, &db.QuotaExceededError{Key: l.Key}
+		}
+		keys[i] = l.Key
+	}
+	for _, key := range keys {
+		f.add(key, &db.Spending{Reserved: amount}, 0)
+	}
+	return &db.Reservation{Keys: keys, Amount: amount}, nil
+}
+
+func (f *fakeStore) SettleSpending(_ context.Context, reservation *db.Reservation, params *db.Spending) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.settles++
+	if f.failSettles > 0 {
+		f.failSettles--
+		return errStore
+	}
+	for _, key := range reservation.Keys {
+		f.add(key, params, reservation.Amount)
+	}
+	return nil
+}
+
+// get returns a copy of the spending of the key. Must be called with mu held
+func (f *fakeStore) get(key string) *db.Spending {
+	sp := &db.Spending{}
+	if stored, ok := f.spending[key]; ok {
+		*sp = stored.Clone()
+	}
+	return sp
+}
+
+// add adds the spending to the key and releases the reserved amount. Principals are kept apart from the spending
+// like db.Store keeps them in docs of their own. Must be called with mu held
+func (f *fakeStore) add(key string, params *db.Spending, release currency.MicroUSD) {
+	sp, ok := f.spending[key]
+	if !ok {
+		sp = &db.Spending{}
+		f.spending[key] = sp
+	}
+	cp := *params
+	cp.Principals = nil
+	sp.Add(&cp)
+	sp.Reserved -= release
+	principals := db.Spending{Principals: f.principals[key]}
+	principals.Add(&db.Spending{Principals: params.Principals})
+	f.principals[key] = principals.Principals
+}
+
+// newTestService creates a service without upstream clients, spending in the store with a daily UTC budget of the limit.
+// Input tokens cost 2, output tokens 12 and Chirp3-HD characters 30 micro USD
+func newTestService(store SpendingStore, limit currency.MicroUSD) *Service {
+	cfg := &config.Config{
+		Budgets: []budget.Window{{Period: budget.Daily, Limit: limit, Location: time.UTC}},
+		Pricing: pricing.Default(testModel, 2, 12),
+	}
+	return New(nil, nil, zap.NewNop().Sugar(), store, cfg, nil, nil)
+}
+
+func TestService_ReserveAndSettle(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	s := newTestService(store, 10000)
+	day := db.DayKey(time.Now())
+
+	reservation, err := s.ReserveSpending(ctx, &AddDailySpendingParams{GeminiModel: testModel, GeminiInputTokens: 100, GeminiOutputTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, currency.MicroUSD(1400), reservation.Amount)
+	assert.Equal(t, []string{day}, reservation.Keys)
+	assert.Equal(t, currency.MicroUSD(1400), store.get(day).Reserved)
+
+	//Settling swaps the reservation for the actual cost
+	s.settleSpending(ctx, &AddDailySpendingParams{Operation: OperationTranslate, GeminiModel: testModel, GeminiInputTokens: 10, GeminiOutputTokens: 10, Reservation: reservation}, nil)
+	sp := store.get(day)
+	assert.Equal(t, currency.MicroUSD(140), sp.Amount)
+	assert.Zero(t, sp.Reserved)
+	assert.Equal(t, int64(1), sp.Operations[OperationTranslate].Requests)
+
+	//A failed request releases its reservation too, keeping what was billed before the failure
+	reservation, err = s.ReserveSpending(ctx, &AddDailySpendingParams{GeminiModel: testModel, GeminiInputTokens: 100, GeminiOutputTokens: 100})
+	require.NoError(t, err)
+	params := &AddDailySpendingParams{Operation: OperationTranslate, GeminiModel: testModel, GeminiInputTokens: 10, Reservation: reservation}
+	s.settleSpending(ctx, params, errors.New("unparsable response"))
+	assert.Equal(t, OutcomeError, params.Outcome)
+	sp = store.get(day)
+	assert.Equal(t, currency.MicroUSD(160), sp.Amount)
+	assert.Zero(t, sp.Reserved)
+}
+
+func TestService_ReserveSpending_QuotaExceeded(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	s := newTestService(store, 1000)
+
+	_, err := s.ReserveSpending(ctx, &AddDailySpendingParams{GeminiModel: testModel, GeminiInputTokens: 100, GeminiOutputTokens: 100})
+	var quotaErr *QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Equal(t, budget.Daily, quotaErr.Period)
+	assert.True(t, quotaErr.ResetsAt.After(time.Now()))
+	assert.Zero(t, store.get(db.DayKey(time.Now())).Reserved)
+}
+
+func TestService_SettleRetry(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	s := newTestService(store, 10000)
+	day := db.DayKey(time.Now())
+	estimate := &AddDailySpendingParams{GeminiModel: testModel, GeminiInputTokens: 100, GeminiOutputTokens: 100}
+
+	//A transient failure doesn't leave the reservation behind
+	reservation, err := s.ReserveSpending(ctx, estimate)
+	require.NoError(t, err)
+	store.failSettles = settleAttempts - 1
+	s.settleSpending(ctx, &AddDailySpendingParams{GeminiModel: testModel, GeminiInputTokens: 10, Reservation: reservation}, nil)
+	assert.Equal(t, settleAttempts, store.settles)
+	assert.Zero(t, store.get(day).Reserved)
+	assert.Equal(t, currency.MicroUSD(20), store.get(day).Amount)
+
+	//Once the attempts run out the reservation stays held until the window resets
+	store.settles = 0
+	reservation, err = s.ReserveSpending(ctx, estimate)
+	require.NoError(t, err)
+	store.failSettles = settleAttempts
+	s.settleSpending(ctx, &AddDailySpendingParams{GeminiModel: testModel, GeminiInputTokens: 10, Reservation: reservation}, nil)
+	assert.Equal(t, settleAttempts, store.settles)
+	assert.Equal(t, currency.MicroUSD(1400), store.get(day).Reserved)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/budget"
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+)
+
+const maxReportDays = 366
+
+type SpendingReport struct {
+	Days    []DaySpending
+	Total   db.Spending
+	Budgets []BudgetStatus
+}
+
+// DaySpending is the spending of a UTC day with its breakdowns
+type DaySpending struct {
+	Date     string
+	Spending db.Spending
+}
+
+// BudgetStatus is the current period of a budget window
+type BudgetStatus struct {
+	Window    budget.Window
+	Key       string
+	Spent     currency.MicroUSD
+	Reserved  currency.MicroUSD
+	Remaining currency.MicroUSD
+	ResetsAt  time.Time
+}
+
+// SpendingReport returns the spending of every UTC day from start to end inclusive and the current status of every budget window
+func (s *Service) SpendingReport(ctx context.Context, start, end time.Time) (*SpendingReport, error) {
+	start, end = start.UTC().Truncate(24*time.Hour), end.UTC().Truncate(24*time.Hour)
+	days := int(end.Sub(start)/(24*time.Hour)) + 1
+	if end.Before(start) || days > maxReportDays {
+		s.log(ctx).Errorw("spending report request validation failed", "start", start, "end", end)
+		return nil, errors.Join(errors.New("date range must be ordered and at most a year long"), ErrInvalidRequest)
+	}
+	s.log(ctx).Infow("spending report request received", "principal", principalName(ctx), "start", db.DayKey(start), "end", db.DayKey(end))
+
+	report := &SpendingReport{Days: make([]DaySpending, 0, days)}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		key := db.DayKey(day)
+		sp, err := s.store.GetSpending(ctx, key)
+		if err != nil {
+			s.log(ctx).Errorw("failed to get spending for report", "day", key, "error", err)
+			return nil, err
+		}
+		principals, err := s.store.GetPrincipalSpending(ctx, key)
+		if err != nil {
+			s.log(ctx).Errorw("failed to get principal spending for report", "day", key, "error", err)
+			return nil, err
+		}
+		sp.Add(&db.Spending{Principals: principals})
+		report.Days = append(report.Days, DaySpending{Date: key, Spending: *sp})
+		report.Total.Add(sp)
+	}
+
+	now := time.Now()
+	for _, w := range s.config.Budgets {
+		key := w.Key(now)
+		sp, err := s.store.GetSpending(ctx, key)
+		if err != nil {
+			s.log(ctx).Errorw("failed to get budget spending for report", "key", key, "error", err)
+			return nil, err
+		}
+		report.Budgets = append(report.Budgets, BudgetStatus{
+			Window:    w,
+			Key:       key,
+			Spent:     sp.Amount,
+			Reserved:  sp.Reserved,
+			Remaining: max(w.Limit-sp.Amount-sp.Reserved, 0),
+			ResetsAt:  w.End(now),
+		})
+	}
+
+	s.log(ctx).Debugw("spending report completed", "days", len(report.Days), "amount", report.Total.Amount)
+	return report, nil
+}
+
+// FormatAmount returns the amount in the currency for display, converted with the configured exchange rates.
+// An empty code or USD formats the amount in USD
+func (s *Service) FormatAmount(amount currency.MicroUSD, code string) (string, error) {
+	return s.config.ExchangeRates.Format(amount, code)
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_SpendingReport_Principals(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	s := newTestService(store, 10000)
+	day := db.DayKey(time.Now())
+
+	for _, principal := range []string{"api_key:app", "api_key:app", ""} {
+		reservation, err := s.ReserveSpending(ctx, &AddDailySpendingParams{GeminiModel: testModel, GeminiInputTokens: 10})
+		require.NoError(t, err)
+		s.settleSpending(ctx, &AddDailySpendingParams{Operation: OperationTranslate, Principal: principal, GeminiModel: testModel, GeminiInputTokens: 10, Reservation: reservation}, nil)
+	}
+	//The spending doc stays the same size however many principals spend
+	assert.Empty(t, store.get(day).Principals)
+
+	report, err := s.SpendingReport(ctx, time.Now(), time.Now())
+	require.NoError(t, err)
+	require.Len(t, report.Days, 1)
+	principals := report.Days[0].Spending.Principals
+	assert.Equal(t, db.Usage{Amount: 40, Requests: 2, InputTokens: 20}, principals["api_key:app"])
+	assert.Equal(t, int64(1), principals[anonymousPrincipal].Requests)
+	assert.Equal(t, currency.MicroUSD(60), report.Total.Amount)
+	assert.Len(t, report.Total.Principals, 2)
+}
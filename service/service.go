@@ -3,241 +3,339 @@ package service
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/dafraer/sentence-gen-grpc-server/alert"
+	"github.com/dafraer/sentence-gen-grpc-server/auth"
 	"github.com/dafraer/sentence-gen-grpc-server/config"
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
 	"github.com/dafraer/sentence-gen-grpc-server/db"
 	"github.com/dafraer/sentence-gen-grpc-server/gemini"
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	"github.com/dafraer/sentence-gen-grpc-server/metrics"
 	"github.com/dafraer/sentence-gen-grpc-server/tts"
 	"go.uber.org/zap"
 )
 
+// SpendingStore persists the spending of the budget windows, keyed by window period, the reservations against their quotas
+// the ledger of requests and the budget alerts that fired.
+// It is implemented by db.Store and by the in-process db.Aggregator in front of it
+type SpendingStore interface {
+	AddLedgerEntry(ctx context.Context, entry *db.LedgerEntry) error
+	MarkAlert(ctx context.Context, key string, threshold int) (bool, error)
+	GetSpending(ctx context.Context, key string) (*db.Spending, error)
+	GetPrincipalSpending(ctx context.Context, key string) (map[string]db.Usage, error)
+	AddSpending(ctx context.Context, keys []string, params *db.Spending) error
+	ReserveSpending(ctx context.Context, amount currency.MicroUSD, limits []db.Limit) (*db.Reservation, error)
+	SettleSpending(ctx context.Context, reservation *db.Reservation, params *db.Spending) error
+}
+
 type Service struct {
 	ttsClient    *tts.Client
 	geminiClient *gemini.Client
 	logger       *zap.SugaredLogger
-	store        *db.Store
+	store        SpendingStore
 	config       *config.Config
+	notifier     *alert.Notifier
+	metrics      *metrics.Metrics
+	cache        *resultCache
 }
 
-func New(ttsClient *tts.Client, geminiClient *gemini.Client, logger *zap.SugaredLogger, store *db.Store, cfg *config.Config) *Service {
+// New creates new service. If notifier is nil budget alerts are disabled, if metrics is nil no metrics are collected
+func New(ttsClient *tts.Client, geminiClient *gemini.Client, logger *zap.SugaredLogger, store SpendingStore, cfg *config.Config, notifier *alert.Notifier, m *metrics.Metrics) *Service {
+	if m != nil {
+		store = &instrumentedStore{store: store, metrics: m}
+	}
 	return &Service{
 		ttsClient:    ttsClient,
 		geminiClient: geminiClient,
 		logger:       logger,
 		store:        store,
 		config:       cfg,
+		notifier:     notifier,
+		metrics:      m,
+		cache:        newResultCache(cfg.ResultCacheSize),
 	}
 }
 
 func (s *Service) GenerateSentence(ctx context.Context, req *GenerateSentenceRequest) (*GenerateSentenceResponse, error) {
-	s.logger.Infow("generate sentence request received", "word", req.Word, "word_language", req.WordLanguage, "translation_language", req.TranslationLanguage, "include_audio", req.IncludeAudio)
+	s.log(ctx).Infow("generate sentence request received", "principal", principalName(ctx), "word", req.Word, "word_language", req.WordLanguage, "translation_language", req.TranslationLanguage, "include_audio", req.IncludeAudio)
 
 	if err := req.validate(); err != nil {
-		s.logger.Errorw("generate sentence request validation failed", "error", err)
+		s.log(ctx).Errorw("generate sentence request validation failed", "error", err)
 		return nil, err
 	}
 
-	sentences, tokenCnt, err := s.geminiClient.GenerateSentence(ctx, &gemini.SentenceGenerationRequest{
-		Word:                req.Word,
-		WordLanguage:        req.WordLanguage,
-		TranslationLanguage: req.TranslationLanguage,
-		TranslationHint:     req.TranslationHint,
+	geminiReq := func(model string) *gemini.SentenceGenerationRequest {
+		return &gemini.SentenceGenerationRequest{
+			Word:                req.Word,
+			WordLanguage:        req.WordLanguage,
+			TranslationLanguage: req.TranslationLanguage,
+			TranslationHint:     req.TranslationHint,
+			Model:               model,
+		}
+	}
+	res, err := s.serve(ctx, &call{
+		spent:         AddDailySpendingParams{Operation: OperationSentence, Word: req.Word, FromLanguage: req.WordLanguage, ToLanguage: req.TranslationLanguage},
+		includeAudio:  req.IncludeAudio,
+		gender:        req.VoiceGender,
+		audioLanguage: req.WordLanguage,
+		//The sentence isn't known before the call, so its audio is reserved by estimate and settled at the actual length
+		maxAudio: s.config.AudioReserve,
+		fields:   []string{req.Word, req.WordLanguage, req.TranslationLanguage, req.TranslationHint},
+		estimate: func(model string) *gemini.Tokens { return s.geminiClient.EstimateSentence(geminiReq(model)) },
+		generate: func(ctx context.Context, model string) (any, string, *gemini.Tokens, error) {
+			sentences, tokens, err := s.geminiClient.GenerateSentence(ctx, geminiReq(model))
+			if err != nil {
+				return nil, "", tokens, err
+			}
+			resp := &GenerateSentenceResponse{OriginalSentence: sentences.OriginalSentence, TranslatedSentence: sentences.TranslatedSentence}
+			if err := resp.validate(); err != nil {
+				s.log(ctx).Errorw("generate sentence response validation failed", "error", err)
+				return nil, "", tokens, err
+			}
+			return resp, resp.OriginalSentence, tokens, nil
+		},
 	})
 	if err != nil {
-		s.logger.Errorw("generate sentence via gemini failed", "error", err)
 		return nil, err
 	}
-	s.logger.Debugw("generate sentence via gemini succeeded", "input_tokens", tokenCnt.InputTokens, "output_tokens", tokenCnt.OutputTokens)
-
-	resp := &GenerateSentenceResponse{
-		OriginalSentence:   sentences.OriginalSentence,
-		TranslatedSentence: sentences.TranslatedSentence,
-	}
-
-	if err := s.AddSpending(ctx, &AddDailySpendingParams{
-		GeminiInputTokens:  tokenCnt.InputTokens,
-		GeminiOutputTokens: tokenCnt.OutputTokens,
-	}); err != nil {
-		s.logger.Errorw("failed to add gemini spending for sentence generation", "error", err)
-		return nil, err
-	}
-	s.logger.Debugw("added gemini spending for sentence generation", "input_tokens", tokenCnt.InputTokens, "output_tokens", tokenCnt.OutputTokens)
-
-	if err := resp.validate(); err != nil {
-		s.logger.Errorw("generate sentence response validation failed", "error", err)
-		return nil, err
-	}
-
-	if req.IncludeAudio {
-		gender := tts.Female
-		if req.VoiceGender == Male {
-			gender = tts.Male
-		}
-		s.logger.Debugw("generating sentence audio", "language", req.WordLanguage, "gender", gender, "model", tts.Chirp3HD)
-		audio, err := s.ttsClient.Generate(ctx, sentences.OriginalSentence, req.WordLanguage, gender, tts.Chirp3HD) //TODO: Should be variable in the future
-		if err != nil && !errors.Is(err, tts.ErrNoSuchVoice) {
-			s.logger.Errorw("sentence audio generation failed", "error", err)
-			return nil, err
-		}
-		if errors.Is(err, tts.ErrNoSuchVoice) {
-			s.logger.Debugw("sentence audio generation skipped due to missing voice", "language", req.WordLanguage, "gender", gender, "model", tts.Chirp3HD)
-		}
-
-		if !errors.Is(err, tts.ErrNoSuchVoice) {
-			if err := s.AddSpending(ctx, &AddDailySpendingParams{
-				Characters: int64(len([]rune(sentences.OriginalSentence))),
-				TTSModel:   tts.Chirp3HD, //TODO: Should be variable in the future
-			}); err != nil {
-				s.logger.Errorw("failed to add tts spending for sentence generation", "error", err)
-				return nil, err
-			}
-			s.logger.Debugw("added tts spending for sentence generation", "characters", int64(len([]rune(sentences.OriginalSentence))), "model", tts.Chirp3HD)
-		}
-		resp.Audio = audio
-	}
-
-	s.logger.Infow("generate sentence request completed", "has_audio", len(resp.Audio) > 0)
 
-	return resp, nil
+	resp := *res.value.(*GenerateSentenceResponse)
+	resp.Audio, resp.Usage, resp.Degradation = res.audio, res.usage, res.degradation
+	s.log(ctx).Infow("generate sentence request completed", "has_audio", len(resp.Audio) > 0, "cached", res.cached, "cost", resp.Usage.Cost)
+	return &resp, nil
 }
 
 func (s *Service) Translate(ctx context.Context, req *TranslateRequest) (*TranslateResponse, error) {
-	s.logger.Infow("translate request received", "word", req.Word, "from_language", req.FromLanguage, "to_language", req.ToLanguage, "include_audio", req.IncludeAudio)
+	s.log(ctx).Infow("translate request received", "principal", principalName(ctx), "word", req.Word, "from_language", req.FromLanguage, "to_language", req.ToLanguage, "include_audio", req.IncludeAudio)
 
 	if err := req.validate(); err != nil {
-		s.logger.Errorw("translate request validation failed", "error", err)
+		s.log(ctx).Errorw("translate request validation failed", "error", err)
 		return nil, err
 	}
 
-	translation, tokenCnt, err := s.geminiClient.Translate(ctx, &gemini.TranslationRequest{
-		Word:            req.Word,
-		FromLanguage:    req.FromLanguage,
-		ToLanguage:      req.ToLanguage,
-		TranslationHint: req.TranslationHint,
+	geminiReq := func(model string) *gemini.TranslationRequest {
+		return &gemini.TranslationRequest{
+			Word:            req.Word,
+			FromLanguage:    req.FromLanguage,
+			ToLanguage:      req.ToLanguage,
+			TranslationHint: req.TranslationHint,
+			Model:           model,
+		}
+	}
+	res, err := s.serve(ctx, &call{
+		spent:         AddDailySpendingParams{Operation: OperationTranslate, Word: req.Word, FromLanguage: req.FromLanguage, ToLanguage: req.ToLanguage},
+		includeAudio:  req.IncludeAudio,
+		gender:        req.VoiceGender,
+		audioLanguage: req.FromLanguage,
+		maxAudio:      len([]rune(req.Word)),
+		fields:        []string{req.Word, req.FromLanguage, req.ToLanguage, req.TranslationHint},
+		estimate:      func(model string) *gemini.Tokens { return s.geminiClient.EstimateTranslation(geminiReq(model)) },
+		generate: func(ctx context.Context, model string) (any, string, *gemini.Tokens, error) {
+			translation, tokens, err := s.geminiClient.Translate(ctx, geminiReq(model))
+			if err != nil {
+				return nil, "", tokens, err
+			}
+			resp := &TranslateResponse{Translation: translation.Translation}
+			if err := resp.validate(); err != nil {
+				s.log(ctx).Errorw("translate response validation failed", "error", err)
+				return nil, "", tokens, err
+			}
+			return resp, req.Word, tokens, nil
+		},
 	})
 	if err != nil {
-		s.logger.Errorw("translate via gemini failed", "error", err)
 		return nil, err
 	}
-	s.logger.Debugw("translate via gemini succeeded", "input_tokens", tokenCnt.InputTokens, "output_tokens", tokenCnt.OutputTokens)
 
-	resp := &TranslateResponse{
-		Translation: translation.Translation,
-	}
+	resp := *res.value.(*TranslateResponse)
+	resp.Audio, resp.Usage, resp.Degradation = res.audio, res.usage, res.degradation
+	s.log(ctx).Infow("translate request completed", "has_audio", len(resp.Audio) > 0, "cached", res.cached, "cost", resp.Usage.Cost)
+	return &resp, nil
+}
 
-	if err := s.AddSpending(ctx, &AddDailySpendingParams{
-		GeminiInputTokens:  tokenCnt.InputTokens,
-		GeminiOutputTokens: tokenCnt.OutputTokens,
-	}); err != nil {
-		s.logger.Errorw("failed to add gemini spending for translation", "error", err)
-		return nil, err
-	}
-	s.logger.Debugw("added gemini spending for translation", "input_tokens", tokenCnt.InputTokens, "output_tokens", tokenCnt.OutputTokens)
+func (s *Service) GenerateDefinition(ctx context.Context, req *GenerateDefinitionRequest) (*GenerateDefinitionResponse, error) {
+	s.log(ctx).Infow("generate definition request received", "principal", principalName(ctx), "word", req.Word, "language", req.Language, "include_audio", req.IncludeAudio)
 
-	if err := resp.validate(); err != nil {
-		s.logger.Errorw("translate response validation failed", "error", err)
+	if err := req.validate(); err != nil {
+		s.log(ctx).Errorw("generate definition request validation failed", "error", err)
 		return nil, err
 	}
 
-	if req.IncludeAudio {
-		gender := tts.Female
-		if req.VoiceGender == Male {
-			gender = tts.Male
-		}
-		s.logger.Debugw("generating translation audio", "language", req.FromLanguage, "gender", gender, "model", tts.Chirp3HD)
-		audio, err := s.ttsClient.Generate(ctx, req.Word, req.FromLanguage, gender, tts.Chirp3HD)
-		if err != nil && !errors.Is(err, tts.ErrNoSuchVoice) {
-			s.logger.Errorw("translation audio generation failed", "error", err)
-			return nil, err
+	geminiReq := func(model string) *gemini.DefinitionRequest {
+		return &gemini.DefinitionRequest{
+			Word:           req.Word,
+			Language:       req.Language,
+			DefinitionHint: req.DefinitionHint,
+			Model:          model,
 		}
-		if errors.Is(err, tts.ErrNoSuchVoice) {
-			s.logger.Debugw("translation audio generation skipped due to missing voice", "language", req.FromLanguage, "gender", gender, "model", tts.Chirp3HD)
-		}
-
-		if !errors.Is(err, tts.ErrNoSuchVoice) {
-			if err := s.AddSpending(ctx, &AddDailySpendingParams{
-				Characters: int64(len([]rune(req.Word))),
-				TTSModel:   tts.Chirp3HD, //TODO: Should be variable in the future
-			}); err != nil {
-				s.logger.Errorw("failed to add tts spending for translation", "error", err)
-				return nil, err
+	}
+	res, err := s.serve(ctx, &call{
+		spent:         AddDailySpendingParams{Operation: OperationDefinition, Word: req.Word, FromLanguage: req.Language},
+		includeAudio:  req.IncludeAudio,
+		gender:        req.VoiceGender,
+		audioLanguage: req.Language,
+		maxAudio:      len([]rune(req.Word)),
+		fields:        []string{req.Word, req.Language, req.DefinitionHint},
+		estimate:      func(model string) *gemini.Tokens { return s.geminiClient.EstimateDefinition(geminiReq(model)) },
+		generate: func(ctx context.Context, model string) (any, string, *gemini.Tokens, error) {
+			definition, tokens, err := s.geminiClient.GenerateDefinition(ctx, geminiReq(model))
+			if err != nil {
+				return nil, "", tokens, err
 			}
-			s.logger.Debugw("added tts spending for translation", "characters", int64(len([]rune(req.Word))), "model", tts.Chirp3HD)
-		}
-
-		resp.Audio = audio
+			resp := &GenerateDefinitionResponse{Definition: definition.Definition}
+			if err := resp.validate(); err != nil {
+				s.log(ctx).Errorw("generate definition response validation failed", "error", err)
+				return nil, "", tokens, err
+			}
+			return resp, req.Word, tokens, nil
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	s.logger.Infow("translate request completed", "has_audio", len(resp.Audio) > 0)
+	resp := *res.value.(*GenerateDefinitionResponse)
+	resp.Audio, resp.Usage, resp.Degradation = res.audio, res.usage, res.degradation
+	s.log(ctx).Infow("generate definition request completed", "has_audio", len(resp.Audio) > 0, "cached", res.cached, "cost", resp.Usage.Cost)
+	return &resp, nil
+}
 
-	return resp, nil
+// call is a request of an operation served by serve
+type call struct {
+	//spent attributes the spending of the request to its operation, word and languages
+	spent        AddDailySpendingParams
+	includeAudio bool
+	gender       Gender
+	//audioLanguage is the language of the audio, maxAudio bounds its characters before the text to speak is known
+	audioLanguage string
+	maxAudio      int
+	//fields identify the result in the cache together with the operation, voice tier and gender
+	fields []string
+	//estimate returns the worst case tokens of the gemini call with the model
+	estimate func(model string) *gemini.Tokens
+	//generate calls gemini with the model and returns the validated result and the text to speak
+	generate func(ctx context.Context, model string) (any, string, *gemini.Tokens, error)
 }
 
-func (s *Service) GenerateDefinition(ctx context.Context, req *GenerateDefinitionRequest) (*GenerateDefinitionResponse, error) {
-	s.logger.Infow("generate definition request received", "word", req.Word, "language", req.Language, "include_audio", req.IncludeAudio)
+// result is the outcome of a call. value is the response of the operation without its audio, usage and degradation
+type result struct {
+	value       any
+	audio       []byte
+	usage       *Usage
+	degradation *Degradation
+	cached      bool
+}
 
-	if err := req.validate(); err != nil {
-		s.logger.Errorw("generate definition request validation failed", "error", err)
+// serve degrades the call by how full the budget is, serves it from the cache once the budget is exhausted,
+// and otherwise reserves its worst case cost, calls gemini and tts, caches the result and settles the actual spending
+func (s *Service) serve(ctx context.Context, c *call) (_ *result, err error) {
+	operation := c.spent.Operation
+	c.spent.Principal = principalName(ctx)
+
+	decision, fullest, err := s.degradation(ctx)
+	if err != nil {
 		return nil, err
 	}
-	definition, tokenCnt, err := s.geminiClient.GenerateDefinition(ctx, &gemini.DefinitionRequest{
-		Word:           req.Word,
-		Language:       req.Language,
-		DefinitionHint: req.DefinitionHint,
-	})
+	voice, err := s.planVoice(ctx, c.includeAudio, decision.TTSVoice)
 	if err != nil {
-		s.logger.Errorw("generate definition via gemini failed", "error", err)
 		return nil, err
 	}
-	s.logger.Debugw("generate definition via gemini succeeded", "input_tokens", tokenCnt.InputTokens, "output_tokens", tokenCnt.OutputTokens)
-	resp := &GenerateDefinitionResponse{
-		Definition: definition.Definition,
+	//Results are cached per voice tier, so a result isn't served to a caller whose plan or degradation asks for another tier
+	cacheVoice := ""
+	if c.includeAudio {
+		cacheVoice = voice
 	}
-
-	if err := s.AddSpending(ctx, &AddDailySpendingParams{
-		GeminiInputTokens:  tokenCnt.InputTokens,
-		GeminiOutputTokens: tokenCnt.OutputTokens,
-	}); err != nil {
-		s.logger.Errorw("failed to add gemini spending for definition generation", "error", err)
+	cacheKey := resultKey(operation, cacheVoice, c.gender, c.fields...)
+	if decision.CacheOnly {
+		value, usage, err := s.fromCache(ctx, cacheKey, &c.spent, fullest)
+		if err != nil {
+			return nil, err
+		}
+		res := *value.(*result)
+		res.usage = usage
+		res.degradation = cachedDegradation(res.degradation, decision)
+		res.cached = true
+		return &res, nil
+	}
+	includeAudio := c.includeAudio && !decision.DropAudio
+
+	//Reserve the worst case cost before calling upstream
+	estimate := c.estimate(decision.GeminiModel)
+	reservation, err := s.ReserveSpending(ctx, &AddDailySpendingParams{
+		GeminiModel:          estimate.Model,
+		GeminiInputTokens:    estimate.InputTokens,
+		GeminiOutputTokens:   estimate.OutputTokens,
+		GeminiThinkingTokens: estimate.ThinkingTokens,
+		Characters:           audioCharacters(includeAudio, c.maxAudio),
+		TTSModel:             voice,
+	})
+	if err != nil {
+		s.log(ctx).Errorw("failed to reserve spending", "operation", operation, "error", err)
 		return nil, err
 	}
-	s.logger.Debugw("added gemini spending for definition generation", "input_tokens", tokenCnt.InputTokens, "output_tokens", tokenCnt.OutputTokens)
-
-	if err := resp.validate(); err != nil {
-		s.logger.Errorw("generate definition response validation failed", "error", err)
+	spent := &c.spent
+	spent.Reservation = reservation
+	defer func() { s.settleSpending(ctx, spent, err) }()
+
+	start := time.Now()
+	value, speech, tokenCnt, err := c.generate(ctx, decision.GeminiModel)
+	s.metrics.ObserveUpstream(upstreamGemini, operation, time.Since(start), err)
+	spent.addTokens(tokenCnt)
+	if err != nil {
+		s.log(ctx).Errorw("gemini call failed", "operation", operation, "error", err)
 		return nil, err
 	}
+	s.log(ctx).Debugw("gemini call succeeded", "operation", operation, "input_tokens", tokenCnt.InputTokens, "output_tokens", tokenCnt.OutputTokens, "thinking_tokens", tokenCnt.ThinkingTokens)
 
-	if req.IncludeAudio {
+	res := &result{value: value, degradation: degradationOf(decision, c.includeAudio)}
+	if includeAudio {
 		gender := tts.Female
-		if req.VoiceGender == Male {
+		if c.gender == Male {
 			gender = tts.Male
 		}
-		s.logger.Debugw("generating definition audio", "language", req.Language, "gender", gender, "model", tts.Chirp3HD)
-		audio, err := s.ttsClient.Generate(ctx, req.Word, req.Language, gender, tts.Chirp3HD)
-		if err != nil && !errors.Is(err, tts.ErrNoSuchVoice) {
-			s.logger.Errorw("definition audio generation failed", "error", err)
+		s.log(ctx).Debugw("generating audio", "operation", operation, "language", c.audioLanguage, "gender", gender, "model", voice)
+		start := time.Now()
+		audio, err := s.ttsClient.Generate(ctx, speech, c.audioLanguage, gender, voice)
+		s.metrics.ObserveUpstream(upstreamTTS, operation, time.Since(start), ignoreNoVoice(err))
+		switch {
+		case errors.Is(err, tts.ErrNoSuchVoice):
+			s.log(ctx).Debugw("audio generation skipped due to missing voice", "operation", operation, "language", c.audioLanguage, "gender", gender, "model", voice)
+		case err != nil:
+			s.log(ctx).Errorw("audio generation failed", "operation", operation, "error", err)
 			return nil, err
+		default:
+			spent.Characters = int64(len([]rune(speech)))
+			spent.TTSModel = voice
+			s.log(ctx).Debugw("tts spending", "operation", operation, "characters", spent.Characters, "model", spent.TTSModel)
 		}
-		if errors.Is(err, tts.ErrNoSuchVoice) {
-			s.logger.Debugw("definition audio generation skipped due to missing voice", "language", req.Language, "gender", gender, "model", tts.Chirp3HD)
-		}
+		res.audio = audio
+	}
 
-		if !errors.Is(err, tts.ErrNoSuchVoice) {
-			if err := s.AddSpending(ctx, &AddDailySpendingParams{
-				Characters: int64(len([]rune(req.Word))),
-				TTSModel:   tts.Chirp3HD, //TODO: Should be variable in the future
-			}); err != nil {
-				s.logger.Errorw("failed to add tts spending for definition generation", "error", err)
-				return nil, err
-			}
-			s.logger.Debugw("added tts spending for definition generation", "characters", int64(len([]rune(req.Word))), "model", tts.Chirp3HD)
-		}
+	cached := *res
+	s.cache.add(cacheKey, &cached)
+	res.usage = s.usage(ctx, spent)
+	return res, nil
+}
 
-		resp.Audio = audio
-	}
+// log returns the logger with the request id of ctx
+func (s *Service) log(ctx context.Context) *zap.SugaredLogger {
+	return logging.FromContext(ctx, s.logger)
+}
 
-	s.logger.Infow("generate definition request completed", "has_audio", len(resp.Audio) > 0)
+// ignoreNoVoice returns nil for a missing voice, which skips the audio instead of failing the call
+func ignoreNoVoice(err error) error {
+	if errors.Is(err, tts.ErrNoSuchVoice) {
+		return nil
+	}
+	return err
+}
 
-	return resp, nil
+// principalName returns the authenticated caller in the "kind:name" form, or an empty string if the request is anonymous
+func principalName(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return p.ID()
+	}
+	return ""
 }
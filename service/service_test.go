@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/dafraer/sentence-gen-grpc-server/degrade"
+	"github.com/dafraer/sentence-gen-grpc-server/gemini"
+	"github.com/dafraer/sentence-gen-grpc-server/plan"
+	"github.com/dafraer/sentence-gen-grpc-server/tts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_serve_CachePerVoice(t *testing.T) {
+	store := newFakeStore()
+	s := newTestService(store, 1000)
+	s.config.ResultCacheSize = 10
+	s.cache = newResultCache(s.config.ResultCacheSize)
+	s.config.Degradation = []degrade.Policy{{AbovePercent: 50, DropAudio: true}, {AbovePercent: 90, CacheOnly: true}}
+	day := db.DayKey(time.Now())
+	withPlan := func(name, voice string) context.Context {
+		return plan.NewContext(context.Background(), &plan.Subscription{Name: name, Plan: &plan.Plan{AudioTiers: []string{voice}}})
+	}
+	var generated int
+	newCall := func() *call {
+		return &call{
+			spent:        AddDailySpendingParams{Operation: OperationTranslate, Word: "hund", FromLanguage: "de", ToLanguage: "en"},
+			includeAudio: true,
+			maxAudio:     4,
+			fields:       []string{"hund", "de", "en", ""},
+			estimate:     func(string) *gemini.Tokens { return &gemini.Tokens{Model: testModel, InputTokens: 10} },
+			generate: func(context.Context, string) (any, string, *gemini.Tokens, error) {
+				generated++
+				return &TranslateResponse{Translation: "dog"}, "hund", &gemini.Tokens{Model: testModel, InputTokens: 10}, nil
+			},
+		}
+	}
+
+	//Past half the budget the audio is dropped and the result is generated and cached for the caller's voice tier
+	store.add(day, &db.Spending{Amount: 600}, 0)
+	res, err := s.serve(withPlan("premium", tts.Chirp3HD), newCall())
+	require.NoError(t, err)
+	assert.Equal(t, 1, generated)
+	assert.Equal(t, "dog", res.value.(*TranslateResponse).Translation)
+	assert.True(t, res.degradation.AudioDropped)
+	assert.False(t, res.cached)
+	assert.Equal(t, int64(1), store.get(day).Operations[OperationTranslate].Requests)
+
+	//Once only cached results are served, the result is served to callers of the same tier only
+	store.add(day, &db.Spending{Amount: 350}, 0)
+	res, err = s.serve(withPlan("premium", tts.Chirp3HD), newCall())
+	require.NoError(t, err)
+	assert.Equal(t, 1, generated)
+	assert.True(t, res.cached)
+	assert.True(t, res.degradation.Cached)
+	assert.Equal(t, "dog", res.value.(*TranslateResponse).Translation)
+
+	_, err = s.serve(withPlan("basic", tts.Standard), newCall())
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Equal(t, 1, generated)
+}
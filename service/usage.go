@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// usage returns the usage and cost of the call with the budget left in every window once it is settled.
+// The call's own reservation is still held, so it is swapped for the actual cost. The budgets are omitted if the spending can't be read
+func (s *Service) usage(ctx context.Context, params *AddDailySpendingParams) *Usage {
+	sp := s.spending(params)
+	u := &Usage{
+		Cost:                 sp.Amount,
+		GeminiModel:          params.GeminiModel,
+		GeminiInputTokens:    params.GeminiInputTokens,
+		GeminiCachedTokens:   params.GeminiCachedTokens,
+		GeminiToolUseTokens:  params.GeminiToolUseTokens,
+		GeminiOutputTokens:   params.GeminiOutputTokens,
+		GeminiThinkingTokens: params.GeminiThinkingTokens,
+	}
+	if params.Characters > 0 {
+		u.TTSModel = params.TTSModel
+		u.Characters = params.Characters
+	}
+
+	now := time.Now()
+	for _, w := range s.windows(ctx) {
+		key := w.key(now)
+		current, err := s.store.GetSpending(ctx, key)
+		if err != nil {
+			s.log(ctx).Errorw("failed to get spending for usage", "key", key, "error", err)
+			u.Budgets = nil
+			break
+		}
+		committed := current.Amount + current.Reserved + sp.Amount
+		//The reservation may be held in the previous period if the window reset during the call
+		if params.Reservation != nil && slices.Contains(params.Reservation.Keys, key) {
+			committed -= params.Reservation.Amount
+		}
+		u.Budgets = append(u.Budgets, RemainingBudget{
+			Window:    w.Window,
+			Plan:      w.plan,
+			Remaining: max(w.Limit-committed, 0),
+			ResetsAt:  w.End(now),
+		})
+	}
+	return u
+}
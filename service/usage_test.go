@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/budget"
+	"github.com/dafraer/sentence-gen-grpc-server/currency"
+	"github.com/dafraer/sentence-gen-grpc-server/db"
+	"github.com/dafraer/sentence-gen-grpc-server/plan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_usage(t *testing.T) {
+	store := newFakeStore()
+	s := newTestService(store, 10000)
+	ctx := plan.NewContext(context.Background(), &plan.Subscription{
+		Name: "free",
+		Plan: &plan.Plan{Budgets: []budget.Window{{Period: budget.Daily, Limit: 500, Location: time.UTC}}},
+	})
+	now := time.Now()
+	windows := s.windows(ctx)
+	require.Len(t, windows, 2)
+	store.add(windows[0].key(now), &db.Spending{Amount: 1000}, 0)
+
+	//The call's reservation is swapped for its actual cost in every window
+	reservation, err := s.ReserveSpending(ctx, &AddDailySpendingParams{GeminiModel: testModel, GeminiInputTokens: 10, GeminiOutputTokens: 10})
+	require.NoError(t, err)
+	assert.Len(t, reservation.Keys, 2)
+	params := &AddDailySpendingParams{GeminiModel: testModel, GeminiInputTokens: 10, Reservation: reservation}
+	u := s.usage(ctx, params)
+	assert.Equal(t, currency.MicroUSD(20), u.Cost)
+	require.Len(t, u.Budgets, 2)
+	assert.Equal(t, currency.MicroUSD(10000-1000-20), u.Budgets[0].Remaining)
+	assert.Empty(t, u.Budgets[0].Plan)
+	assert.Equal(t, currency.MicroUSD(500-20), u.Budgets[1].Remaining)
+	assert.Equal(t, "free", u.Budgets[1].Plan)
+	for _, b := range u.Budgets {
+		assert.Equal(t, b.Window.End(now), b.ResetsAt)
+	}
+
+	//The remaining budget doesn't go below zero
+	store.add(windows[1].key(now), &db.Spending{Amount: 1000}, 0)
+	u = s.usage(ctx, params)
+	require.Len(t, u.Budgets, 2)
+	assert.Zero(t, u.Budgets[1].Remaining)
+
+	//The budgets are left out if the spending can't be read, the cost is still returned
+	store.failGets = true
+	u = s.usage(ctx, params)
+	assert.Nil(t, u.Budgets)
+	assert.Equal(t, currency.MicroUSD(20), u.Cost)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"fmt"
 
 	"golang.org/x/text/language"
 )
@@ -12,105 +13,125 @@ const (
 )
 
 var (
-	ErrInvalidRequest  = errors.New("validation error")
-	ErrHintTooLong     = errors.New("hint too long")
-	ErrEmptyWord       = errors.New("empty word")
-	ErrWordTooLong     = errors.New("word too long")
+	ErrInvalidRequest = errors.New("validation error")
+	ErrHintTooLong    = errors.New("hint too long")
+	ErrEmptyWord      = errors.New("empty word")
+	ErrWordTooLong    = errors.New("word too long")
+	//ErrUnsupportedLanguage is returned for language codes that aren't BCP 47 tags or don't name a language
+	ErrUnsupportedLanguage = errors.New("unsupported language")
+	//ErrWordNotFound is returned when gemini leaves the output empty because the word doesn't exist in the language
+	ErrWordNotFound = errors.New("word not found")
+	//ErrInvalidResponse is returned when gemini fills only part of the output
 	ErrInvalidResponse = errors.New("invalid response")
 )
 
-func (req *GenerateSentenceRequest) validate() error {
-	if err := validateWord(req.Word); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
+// FieldError reports the request field that failed validation. It matches ErrInvalidRequest
+type FieldError struct {
+	//Field is the name of the field in the api
+	Field string
+	Err   error
+}
 
-	if err := validateLanguageCode(req.WordLanguage); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
 
-	if err := validateLanguageCode(req.TranslationLanguage); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
 
-	if err := validateHint(req.TranslationHint); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
-	return nil
+func (e *FieldError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+// The validators join the errors of every invalid field, so callers can fix them all at once
+
+func (req *GenerateSentenceRequest) validate() error {
+	return errors.Join(
+		validateWord("word", req.Word),
+		validateLanguageCode("word_language", req.WordLanguage),
+		validateLanguageCode("translation_language", req.TranslationLanguage),
+		validateHint("translation_hint", req.TranslationHint),
+	)
 }
 
 func (resp *GenerateSentenceResponse) validate() error {
-	if resp.OriginalSentence == "" || resp.TranslatedSentence == "" {
+	switch {
+	case resp.OriginalSentence == "" && resp.TranslatedSentence == "":
+		return ErrWordNotFound
+	case resp.OriginalSentence == "" || resp.TranslatedSentence == "":
 		return ErrInvalidResponse
 	}
 	return nil
 }
 
 func (req *GenerateDefinitionRequest) validate() error {
-	if err := validateWord(req.Word); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
-
-	if err := validateLanguageCode(req.Language); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
-
-	if err := validateHint(req.DefinitionHint); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
-	return nil
+	return errors.Join(
+		validateWord("word", req.Word),
+		validateLanguageCode("language", req.Language),
+		validateHint("definition_hint", req.DefinitionHint),
+	)
 }
 
 func (resp *GenerateDefinitionResponse) validate() error {
 	if resp.Definition == "" {
-		return ErrInvalidResponse
+		return ErrWordNotFound
 	}
 	return nil
 }
 
 func (req *TranslateRequest) validate() error {
-	if err := validateWord(req.Word); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
-
-	if err := validateLanguageCode(req.FromLanguage); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
-
-	if err := validateLanguageCode(req.ToLanguage); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
-
-	if err := validateHint(req.TranslationHint); err != nil {
-		return errors.Join(err, ErrInvalidRequest)
-	}
-	return nil
+	return errors.Join(
+		validateWord("word", req.Word),
+		validateLanguageCode("from_language", req.FromLanguage),
+		validateLanguageCode("to_language", req.ToLanguage),
+		validateHint("translation_hint", req.TranslationHint),
+	)
 }
 
 func (resp *TranslateResponse) validate() error {
 	if resp.Translation == "" {
-		return ErrInvalidResponse
+		return ErrWordNotFound
 	}
 	return nil
 }
 
-func validateWord(word string) error {
+func validateWord(field, word string) error {
 	switch {
 	case word == "":
-		return ErrEmptyWord
+		return &FieldError{Field: field, Err: ErrEmptyWord}
 	case len([]rune(word)) > maxWordLength:
-		return ErrWordTooLong
+		return &FieldError{Field: field, Err: ErrWordTooLong}
+	}
+	return nil
+}
+
+func validateLanguageCode(field, languageCode string) error {
+	if tag, err := language.Parse(languageCode); err != nil || !namesLanguage(tag) {
+		return &FieldError{Field: field, Err: fmt.Errorf("%w %q", ErrUnsupportedLanguage, languageCode)}
 	}
 	return nil
 }
 
-func validateLanguageCode(languageCode string) error {
-	_, err := language.Parse(languageCode)
-	return err
+// namesLanguage reports whether the tag names a language to write in. Well-formed tags like "und", "x-foo",
+// the special codes "mul", "mis" and "zxx" and the private use codes "qaa" to "qtz" don't
+func namesLanguage(tag language.Tag) bool {
+	base, confidence := tag.Base()
+	code := base.String()
+	switch {
+	case tag == language.Und || confidence == language.No:
+		return false
+	case code == "mul" || code == "mis" || code == "zxx":
+		return false
+	case code >= "qaa" && code <= "qtz":
+		return false
+	}
+	return true
 }
 
-func validateHint(hint string) error {
+func validateHint(field, hint string) error {
 	if len([]rune(hint)) > maxHintLength {
-		return ErrHintTooLong
+		return &FieldError{Field: field, Err: ErrHintTooLong}
 	}
 	return nil
 }
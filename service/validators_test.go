@@ -0,0 +1,20 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLanguageCode(t *testing.T) {
+	for _, code := range []string{"en", "en-US", "de", "pt-BR", "zh-Hant", "EN"} {
+		assert.NoError(t, validateLanguageCode("language", code), code)
+	}
+
+	//Malformed tags and well-formed tags that don't name a language are both unsupported
+	for _, code := range []string{"", "xx-!", "xx", "und", "x-foo", "mul", "mis", "zxx", "qaa", "qtz"} {
+		err := validateLanguageCode("language", code)
+		assert.ErrorIs(t, err, ErrUnsupportedLanguage, code)
+		assert.ErrorIs(t, err, ErrInvalidRequest, code)
+	}
+}
@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+
+	serviceName = "sentence-gen-grpc-server"
+)
+
+var (
+	ErrUnknownExporter = errors.New("unknown trace exporter")
+)
+
+// Setup installs the global tracer provider exporting spans with the exporter (otlp or stdout) and
+// the w3c trace context propagator. The otlp exporter is configured with the standard OTEL_EXPORTER_OTLP_* variables.
+// The returned function flushes the pending spans and must be called on shutdown
+func Setup(ctx context.Context, exporter string, sampleRatio float64, logger *zap.SugaredLogger) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterOTLP:
+		exp, err = otlptracegrpc.New(ctx)
+	case ExporterStdout:
+		exp, err = stdouttrace.New()
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownExporter, exporter)
+	}
+	if err != nil {
+		logger.Errorw("failed to create trace exporter", "exporter", exporter, "error", err)
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		//Follow the caller's sampling decision, sample new traces at the ratio
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	logger.Infow("tracing enabled", "exporter", exporter, "sample_ratio", sampleRatio)
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer of a package of the server. It is a no-op until Setup is called
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer("github.com/dafraer/sentence-gen-grpc-server/" + name)
+}
+
+// End records the error on the span if there is one and ends the span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
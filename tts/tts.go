@@ -7,7 +7,14 @@ import (
 
 	texttospeech "cloud.google.com/go/texttospeech/apiv1"
 	"cloud.google.com/go/texttospeech/apiv1/texttospeechpb"
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	"github.com/dafraer/sentence-gen-grpc-server/tracing"
+	"github.com/dafraer/sentence-gen-grpc-server/upstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -21,26 +28,44 @@ var (
 	ErrNoSuchVoice = errors.New("no such voice")
 )
 
+var tracer = tracing.Tracer("tts")
+
 type Client struct {
-	tts    *texttospeech.Client
-	logger *zap.SugaredLogger
+	tts      *texttospeech.Client
+	upstream *upstream.Caller
+	logger   *zap.SugaredLogger
 }
 
-// New creates new tts client
-func New(ctx context.Context, logger *zap.SugaredLogger) (*Client, error) {
+// New creates new tts client. policy sets the timeout, the retries and the circuit breaker of the calls
+func New(ctx context.Context, logger *zap.SugaredLogger, policy upstream.Config) (*Client, error) {
 	logger.Infow("initializing tts client")
 	client, err := texttospeech.NewClient(ctx)
 	if err != nil {
 		logger.Errorw("failed to initialize tts client", "error", err)
 		return nil, err
 	}
+	//The default call options retry with their own timeouts, the policy replaces them
+	client.CallOptions = &texttospeech.CallOptions{}
 	logger.Infow("tts client initialized")
 	return &Client{
-		tts:    client,
-		logger: logger,
+		tts:      client,
+		upstream: upstream.New("tts", policy, classify, logger),
+		logger:   logger,
 	}, nil
 }
 
+// classify returns the kind of the errors the api returns without synthesizing and billing anything, so the call can be retried
+func classify(err error) error {
+	switch status.Code(err) {
+	case codes.ResourceExhausted:
+		return upstream.ErrThrottled
+	case codes.Unavailable:
+		return upstream.ErrUnavailable
+	default:
+		return nil
+	}
+}
+
 // Close closes tts client
 func (c *Client) Close() error {
 	c.logger.Infow("closing tts client")
@@ -52,16 +77,46 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// log returns the logger with the request id of ctx
+func (c *Client) log(ctx context.Context) *zap.SugaredLogger {
+	return logging.FromContext(ctx, c.logger)
+}
+
 // Generate generates mp3 audio based on the text and language provided
 func (c *Client) Generate(ctx context.Context, text, languageCode, gender, model string) ([]byte, error) {
-	c.logger.Debugw("tts generation started", "language_code", languageCode, "gender", gender, "model", model, "text_len", len([]rune(text)))
+	c.log(ctx).Debugw("tts generation started", "language_code", languageCode, "gender", gender, "model", model, "text_len", len([]rune(text)))
+	ctx, span := tracer.Start(ctx, "tts.Generate", trace.WithAttributes(
+		attribute.String("tts.language_code", languageCode),
+		attribute.String("tts.gender", gender),
+		attribute.String("tts.model", model),
+	))
+	audio, err := c.generate(ctx, text, languageCode, gender, model)
+	if errors.Is(err, ErrNoSuchVoice) {
+		//A missing voice skips the audio, it isn't a failure
+		span.SetAttributes(attribute.Bool("tts.no_such_voice", true))
+		span.End()
+		return nil, err
+	}
+	tracing.End(span, err)
+	return audio, err
+}
 
+// generate picks the voice and synthesizes the text, each call in its own span
+func (c *Client) generate(ctx context.Context, text, languageCode, gender, model string) ([]byte, error) {
 	//Select a voice
-	voices, err := c.tts.ListVoices(ctx, &texttospeechpb.ListVoicesRequest{
-		LanguageCode: languageCode,
+	listCtx, span := tracer.Start(ctx, "tts.ListVoices", trace.WithSpanKind(trace.SpanKindClient))
+	var voices *texttospeechpb.ListVoicesResponse
+	//Listing voices is free, so timed out calls are retried too
+	err := c.upstream.CallIdempotent(listCtx, func(ctx context.Context) error {
+		var err error
+		voices, err = c.tts.ListVoices(ctx, &texttospeechpb.ListVoicesRequest{
+			LanguageCode: languageCode,
+		})
+		return err
 	})
+	tracing.End(span, err)
 	if err != nil {
-		c.logger.Errorw("failed to list tts voices", "error", err)
+		c.log(ctx).Errorw("failed to list tts voices", "error", err)
 		return nil, err
 	}
 
@@ -73,10 +128,10 @@ func (c *Client) Generate(ctx context.Context, text, languageCode, gender, model
 		}
 	}
 	if name == "" {
-		c.logger.Debugw("no matching tts voice found", "language_code", languageCode, "gender", gender, "model", model)
+		c.log(ctx).Debugw("no matching tts voice found", "language_code", languageCode, "gender", gender, "model", model)
 		return nil, ErrNoSuchVoice
 	}
-	c.logger.Debugw("voice picked", "name", name)
+	c.log(ctx).Debugw("voice picked", "name", name)
 
 	// Perform the text-to-speech request on the text input with the selected voice parameters and audio file type.
 	req := texttospeechpb.SynthesizeSpeechRequest{
@@ -98,11 +153,21 @@ func (c *Client) Generate(ctx context.Context, text, languageCode, gender, model
 	}
 
 	//Generate speech
-	resp, err := c.tts.SynthesizeSpeech(ctx, &req)
+	ctx, span = tracer.Start(ctx, "tts.SynthesizeSpeech", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("tts.voice", name),
+		attribute.Int("tts.characters", len([]rune(text))),
+	))
+	var resp *texttospeechpb.SynthesizeSpeechResponse
+	err = c.upstream.Call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.tts.SynthesizeSpeech(ctx, &req)
+		return err
+	})
+	tracing.End(span, err)
 	if err != nil {
-		c.logger.Errorw("tts synthesize speech failed", "error", err)
+		c.log(ctx).Errorw("tts synthesize speech failed", "error", err)
 		return nil, err
 	}
-	c.logger.Debugw("tts generation completed", "audio_size_bytes", len(resp.AudioContent))
+	c.log(ctx).Debugw("tts generation completed", "audio_size_bytes", len(resp.AudioContent))
 	return resp.AudioContent, nil
 }
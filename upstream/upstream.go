@@ -0,0 +1,193 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/dafraer/sentence-gen-grpc-server/logging"
+	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
+)
+
+var (
+	//ErrThrottled and ErrUnavailable are the kinds of the errors upstreams return without doing or billing the work
+	ErrThrottled   = errors.New("upstream throttled the call")
+	ErrUnavailable = errors.New("upstream unavailable")
+	//ErrCircuitOpen is returned without calling the upstream while its circuit breaker is open
+	ErrCircuitOpen   = errors.New("upstream circuit breaker is open")
+	ErrInvalidConfig = errors.New("invalid upstream config")
+)
+
+// Error reports a call the upstream didn't do. It matches its kind: ErrThrottled, ErrUnavailable, ErrCircuitOpen or
+// context.DeadlineExceeded for attempts that timed out
+type Error struct {
+	Upstream string
+	Kind     error
+	//Err is the error of the last attempt, nil if the circuit breaker was open
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Upstream + ": " + e.Kind.Error()
+	}
+	return e.Upstream + ": " + e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Config configures the calls to an upstream
+type Config struct {
+	//Timeout bounds every attempt, zero leaves it to the caller's deadline
+	Timeout time.Duration
+	//MaxAttempts is the number of attempts of a call including the first one
+	MaxAttempts int
+	//InitialBackoff is the longest wait before the first retry. It doubles on every retry up to MaxBackoff, the wait is a random duration below it
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	//BreakerFailures is the number of consecutive failed attempts that opens the circuit breaker, zero disables it
+	BreakerFailures uint32
+	//BreakerOpenTimeout is how long the breaker stays open before a trial call is let through
+	BreakerOpenTimeout time.Duration
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if c.Timeout < 0 || c.MaxAttempts < 1 || c.InitialBackoff < 0 || c.MaxBackoff < c.InitialBackoff {
+		return errors.Join(ErrInvalidConfig, errors.New("timeout and backoffs must not be negative, max backoff must not be below the initial backoff and there must be at least one attempt"))
+	}
+	if c.BreakerFailures > 0 && c.BreakerOpenTimeout <= 0 {
+		return errors.Join(ErrInvalidConfig, errors.New("breaker open timeout must be positive"))
+	}
+	return nil
+}
+
+// Caller calls an upstream with a timeout per attempt, retries the failures that weren't billed with jittered exponential backoff
+// and fails fast with ErrCircuitOpen while the upstream keeps failing
+type Caller struct {
+	name     string
+	cfg      Config
+	classify func(error) error
+	breaker  *gobreaker.TwoStepCircuitBreaker
+	logger   *zap.SugaredLogger
+}
+
+// New creates new caller of the named upstream. classify returns ErrThrottled or ErrUnavailable for the errors the upstream
+// returns without doing or billing the work and nil for the others. Those errors are retried and, together with the attempt timeouts,
+// count as failures of the upstream
+func New(name string, cfg Config, classify func(error) error, logger *zap.SugaredLogger) *Caller {
+	c := &Caller{name: name, cfg: cfg, classify: classify, logger: logger}
+	if cfg.BreakerFailures > 0 {
+		c.breaker = gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+			Name:        name,
+			MaxRequests: 1,
+			Timeout:     cfg.BreakerOpenTimeout,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= cfg.BreakerFailures
+			},
+			OnStateChange: func(name string, from, to gobreaker.State) {
+				if to == gobreaker.StateOpen {
+					logger.Warnw("upstream circuit breaker opened", "upstream", name, "from", from.String())
+					return
+				}
+				logger.Infow("upstream circuit breaker state changed", "upstream", name, "from", from.String(), "to", to.String())
+			},
+		})
+	}
+	return c
+}
+
+// Open reports whether the circuit breaker is open
+func (c *Caller) Open() bool {
+	return c.breaker != nil && c.breaker.State() == gobreaker.StateOpen
+}
+
+// Call calls fn until it succeeds, fails with an error that isn't retryable or runs out of attempts and returns its last error.
+// Retryable errors and timeouts are returned as an Error. Attempts that time out aren't retried, the upstream may have done and billed the work
+func (c *Caller) Call(ctx context.Context, fn func(context.Context) error) error {
+	return c.call(ctx, false, fn)
+}
+
+// CallIdempotent is Call for calls that are free to repeat, so attempts that time out are retried too
+func (c *Caller) CallIdempotent(ctx context.Context, fn func(context.Context) error) error {
+	return c.call(ctx, true, fn)
+}
+
+func (c *Caller) call(ctx context.Context, idempotent bool, fn func(context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var timedOut bool
+		timedOut, err = c.attempt(ctx, fn)
+		if err == nil || attempt >= c.cfg.MaxAttempts || !(c.retryable(err) || (idempotent && timedOut)) {
+			return err
+		}
+		wait := c.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		logging.FromContext(ctx, c.logger).Infow("retrying upstream call", "upstream", c.name, "attempt", attempt, "wait", wait, "error", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt calls fn once through the circuit breaker. It reports whether the attempt timed out while the caller was still waiting
+func (c *Caller) attempt(ctx context.Context, fn func(context.Context) error) (bool, error) {
+	done := func(bool) {}
+	if c.breaker != nil {
+		var err error
+		done, err = c.breaker.Allow()
+		if err != nil {
+			return false, &Error{Upstream: c.name, Kind: ErrCircuitOpen}
+		}
+	}
+
+	attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+	if c.cfg.Timeout > 0 {
+		attemptCtx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+	}
+	defer cancel()
+	err := fn(attemptCtx)
+	timedOut := err != nil && attemptCtx.Err() != nil && ctx.Err() == nil
+
+	//Only the upstream's own failures count against it, not bad requests or callers giving up
+	kind := c.classify(err)
+	if timedOut {
+		kind = context.DeadlineExceeded
+	}
+	done(err == nil || kind == nil)
+	if err != nil && kind != nil {
+		err = &Error{Upstream: c.name, Kind: kind, Err: err}
+	}
+	return timedOut, err
+}
+
+// retryable reports whether the attempt failed with an error the upstream returned without doing the work
+func (c *Caller) retryable(err error) bool {
+	return errors.Is(err, ErrThrottled) || errors.Is(err, ErrUnavailable)
+}
+
+// backoff returns the wait before the retry after the attempt
+func (c *Caller) backoff(attempt int) time.Duration {
+	ceiling := c.cfg.InitialBackoff << (attempt - 1)
+	if ceiling > c.cfg.MaxBackoff || ceiling <= 0 {
+		ceiling = c.cfg.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
@@ -0,0 +1,157 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var (
+	errThrottled  = errors.New("throttled")
+	errBadRequest = errors.New("bad request")
+)
+
+func classify(err error) error {
+	if errors.Is(err, errThrottled) {
+		return ErrThrottled
+	}
+	return nil
+}
+
+func testConfig() Config {
+	return Config{Timeout: 50 * time.Millisecond, MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, testConfig().Validate())
+	assert.NoError(t, Config{MaxAttempts: 1}.Validate())
+	assert.ErrorIs(t, Config{}.Validate(), ErrInvalidConfig)
+	assert.ErrorIs(t, Config{MaxAttempts: 2, InitialBackoff: time.Second, MaxBackoff: time.Millisecond}.Validate(), ErrInvalidConfig)
+	assert.ErrorIs(t, Config{MaxAttempts: 1, BreakerFailures: 3}.Validate(), ErrInvalidConfig)
+}
+
+func TestCaller_Call(t *testing.T) {
+	c := New("test", testConfig(), classify, zap.NewNop().Sugar())
+
+	//Retryable errors are retried until the call succeeds
+	calls := 0
+	err := c.Call(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errThrottled
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	//The last error is returned when the attempts run out
+	calls = 0
+	err = c.Call(context.Background(), func(context.Context) error {
+		calls++
+		return errThrottled
+	})
+	assert.ErrorIs(t, err, errThrottled)
+	assert.ErrorIs(t, err, ErrThrottled)
+	var upstreamErr *Error
+	assert.ErrorAs(t, err, &upstreamErr)
+	assert.Equal(t, "test", upstreamErr.Upstream)
+	assert.Equal(t, 3, calls)
+
+	//Other errors are returned at once
+	calls = 0
+	err = c.Call(context.Background(), func(context.Context) error {
+		calls++
+		return errBadRequest
+	})
+	assert.ErrorIs(t, err, errBadRequest)
+	assert.NotErrorIs(t, err, ErrThrottled)
+	assert.Equal(t, 1, calls)
+}
+
+func TestCaller_Timeout(t *testing.T) {
+	c := New("test", testConfig(), classify, zap.NewNop().Sugar())
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	//A timed out attempt may have been billed, so it is only retried if the call is idempotent
+	calls := 0
+	err := c.Call(context.Background(), func(ctx context.Context) error {
+		calls++
+		return hang(ctx)
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	err = c.CallIdempotent(context.Background(), func(ctx context.Context) error {
+		calls++
+		return hang(ctx)
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 3, calls)
+
+	//The caller's own cancellation isn't retried
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	err = c.CallIdempotent(ctx, func(ctx context.Context) error {
+		calls++
+		return hang(ctx)
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
+
+func TestCaller_Breaker(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxAttempts = 1
+	cfg.BreakerFailures = 2
+	cfg.BreakerOpenTimeout = 50 * time.Millisecond
+	c := New("test", cfg, classify, zap.NewNop().Sugar())
+
+	calls := 0
+	fail := func(err error) func(context.Context) error {
+		return func(context.Context) error {
+			calls++
+			return err
+		}
+	}
+
+	//Bad requests aren't failures of the upstream
+	for range 3 {
+		assert.ErrorIs(t, c.Call(context.Background(), fail(errBadRequest)), errBadRequest)
+	}
+	assert.False(t, c.Open())
+
+	assert.ErrorIs(t, c.Call(context.Background(), fail(errThrottled)), errThrottled)
+	assert.ErrorIs(t, c.Call(context.Background(), fail(errThrottled)), errThrottled)
+	assert.True(t, c.Open())
+
+	//The open breaker fails fast without calling the upstream
+	calls = 0
+	assert.ErrorIs(t, c.Call(context.Background(), fail(nil)), ErrCircuitOpen)
+	assert.Equal(t, 0, calls)
+
+	//A trial call is let through after the open timeout and closes the breaker
+	time.Sleep(cfg.BreakerOpenTimeout)
+	assert.NoError(t, c.Call(context.Background(), fail(nil)))
+	assert.Equal(t, 1, calls)
+	assert.False(t, c.Open())
+}
+
+func TestCaller_backoff(t *testing.T) {
+	c := New("test", Config{MaxAttempts: 10, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}, classify, zap.NewNop().Sugar())
+	for attempt := 1; attempt < 10; attempt++ {
+		wait := c.backoff(attempt)
+		assert.GreaterOrEqual(t, wait, time.Duration(0))
+		assert.Less(t, wait, min(10*time.Millisecond<<(attempt-1), 50*time.Millisecond))
+	}
+	assert.Zero(t, New("test", Config{MaxAttempts: 2}, classify, zap.NewNop().Sugar()).backoff(1))
+}